@@ -0,0 +1,358 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// absorbPatchFile is the file, relative to the .git directory, where plz
+// absorb saves the staged changes before moving them into fixup commits, so
+// they can be recovered if something goes wrong.
+const absorbPatchFile = "plz/absorb.patch"
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+
+// stagedFile is a file's section of the staged diff.
+type stagedFile struct {
+	path   string
+	header []string
+	hunks  []stagedHunk
+	// absorbable is false for added, deleted, renamed and binary files, whose
+	// changes can't be traced back to a commit line by line.
+	absorbable bool
+}
+
+type stagedHunk struct {
+	lines []string
+	// removed lists the lines of the HEAD version that the hunk removes or
+	// replaces. For hunks that only add lines, near lists the lines around
+	// the insertion instead.
+	removed []int
+	near    []int
+}
+
+// Absorb moves each staged hunk into the commit in the stack that last changed
+// the lines it touches, like git absorb. A fixup commit is created for each
+// commit that absorbs hunks, and the stack is then rebased with Git to squash
+// them in, unless --no-rebase is given. Hunks that can't be traced to a single
+// commit in the stack are left in the worktree.
+func Absorb(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !headRef.Name().IsBranch() {
+		return errors.New("HEAD is detached, check out the stack's branch first")
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defaultBranch, err := localDefaultBranch(ctx, repo)
+	if err != nil {
+		return err
+	}
+	commits, err := stack.LocalCommits(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return err
+	}
+	inStack := map[string]int{}
+	for i, commit := range commits {
+		inStack[commit.Hash.String()] = i
+	}
+
+	patch, err := exec.CommandContext(ctx, "git", "diff", "--cached", "--binary", "--no-color", "--no-ext-diff").Output()
+	if err != nil {
+		return errors.Wrap(err, "git diff failed")
+	}
+	if len(patch) == 0 {
+		return errors.New("no staged changes")
+	}
+	files := parseStagedDiff(string(patch))
+
+	// Assign each hunk to the index of the commit absorbing it, or -1.
+	targets := map[int][]*stagedFile{}
+	var remaining []*stagedFile
+	numAbsorbed := 0
+	for _, file := range files {
+		var blame map[int]string
+		if file.absorbable {
+			blame, err = blameLines(ctx, file.path)
+			if err != nil {
+				return err
+			}
+		}
+		byTarget := map[int]*stagedFile{}
+		for _, hunk := range file.hunks {
+			target := -1
+			if file.absorbable {
+				target = hunkTarget(hunk, blame, inStack)
+			}
+			if target < 0 {
+				deps.StackDebugLog.Printf("leaving hunk in %s unabsorbed", file.path)
+			} else {
+				deps.StackDebugLog.Printf("absorbing hunk in %s into %s", file.path, commits[target].Hash)
+				numAbsorbed++
+			}
+			f, ok := byTarget[target]
+			if !ok {
+				f = &stagedFile{path: file.path, header: file.header}
+				byTarget[target] = f
+				if target < 0 {
+					remaining = append(remaining, f)
+				} else {
+					targets[target] = append(targets[target], f)
+				}
+			}
+			f.hunks = append(f.hunks, hunk)
+		}
+		if len(file.hunks) == 0 {
+			remaining = append(remaining, file)
+		}
+	}
+	if numAbsorbed == 0 {
+		return errors.New("none of the staged hunks can be traced to a single commit in the stack")
+	}
+
+	if err := saveAbsorbPatch(repo, patch); err != nil {
+		return err
+	}
+	if err := runGit(ctx, "reset", "--quiet"); err != nil {
+		return err
+	}
+	bottom := 0
+	for i := len(commits) - 1; i >= 0; i-- {
+		if _, ok := targets[i]; !ok {
+			continue
+		}
+		if i > bottom {
+			bottom = i
+		}
+		if err := applyStaged(ctx, targets[i]); err != nil {
+			return err
+		}
+		if err := runGit(ctx, "commit", "--quiet", "--no-verify", "-m", "fixup! "+commits[i].Hash.String()); err != nil {
+			return err
+		}
+		deps.InfoLog.Printf("absorbed %s into %s", countHunks(targets[i]), shortSHA(commits[i].Hash.String()))
+	}
+	if len(remaining) > 0 {
+		if err := applyStaged(ctx, remaining); err != nil {
+			return err
+		}
+		deps.InfoLog.Printf("left %s that couldn't be absorbed", countHunks(remaining))
+	}
+	if err := removeAbsorbPatch(repo); err != nil {
+		return err
+	}
+
+	if c.Bool("no-rebase") {
+		deps.InfoLog.Println("squash the fixup commits with git rebase --interactive --autosquash")
+		return nil
+	}
+	base := commits[bottom].ParentHashes[0].String()
+	cmd := exec.CommandContext(ctx, "git", "rebase", "--quiet", "--interactive", "--autosquash", "--autostash", base)
+	cmd.Env = append(os.Environ(), "GIT_SEQUENCE_EDITOR=true")
+	cmd.Stdout = deps.InfoLog.Writer()
+	cmd.Stderr = deps.ErrorLog.Writer()
+	if err := cmd.Run(); err != nil {
+		return errors.New("git rebase stopped, resolve it with git rebase --continue or git rebase --abort")
+	}
+	deps.InfoLog.Println("run plz review to publish the changes")
+	return nil
+}
+
+// parseStagedDiff splits the output of git diff into files and hunks.
+func parseStagedDiff(patch string) []*stagedFile {
+	var files []*stagedFile
+	var file *stagedFile
+	var hunk *stagedHunk
+	old := 0
+	lastRemoved := false
+	s := bufio.NewScanner(strings.NewReader(patch))
+	s.Buffer(nil, 1<<30)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file = &stagedFile{header: []string{line}, absorbable: true}
+			files = append(files, file)
+			hunk = nil
+		case file == nil:
+		case hunk == nil && !strings.HasPrefix(line, "@@"):
+			file.header = append(file.header, line)
+			switch {
+			case strings.HasPrefix(line, "new file mode"),
+				strings.HasPrefix(line, "deleted file mode"),
+				strings.HasPrefix(line, "rename from"),
+				strings.HasPrefix(line, "copy from"),
+				strings.HasPrefix(line, "GIT binary patch"):
+				file.absorbable = false
+			case strings.HasPrefix(line, "--- a/"):
+				file.path = strings.TrimPrefix(line, "--- a/")
+			}
+		case strings.HasPrefix(line, "@@"):
+			m := hunkHeaderRegex.FindStringSubmatch(line)
+			if m == nil {
+				file.absorbable = false
+				continue
+			}
+			old, _ = strconv.Atoi(m[1])
+			if m[2] == "0" {
+				// An empty range refers to the line before the insertion.
+				old++
+			}
+			file.hunks = append(file.hunks, stagedHunk{lines: []string{line}})
+			hunk = &file.hunks[len(file.hunks)-1]
+			lastRemoved = false
+		default:
+			hunk.lines = append(hunk.lines, line)
+			switch {
+			case strings.HasPrefix(line, "-"):
+				hunk.removed = append(hunk.removed, old)
+				old++
+				lastRemoved = true
+			case strings.HasPrefix(line, "+"):
+				if !lastRemoved {
+					hunk.near = append(hunk.near, old-1, old)
+				}
+			case strings.HasPrefix(line, " "):
+				old++
+				lastRemoved = false
+			}
+		}
+	}
+	return files
+}
+
+// hunkTarget returns the index of the commit in the stack that the hunk
+// should be absorbed into, or -1 if there isn't exactly one. Removed lines
+// must all come from the same commit in the stack. Added lines are placed
+// next to lines that come from a single commit in the stack.
+func hunkTarget(hunk stagedHunk, blame map[int]string, inStack map[string]int) int {
+	candidates := map[int]bool{}
+	for _, line := range hunk.removed {
+		i, ok := inStack[blame[line]]
+		if !ok {
+			return -1
+		}
+		candidates[i] = true
+	}
+	for _, line := range hunk.near {
+		if i, ok := inStack[blame[line]]; ok {
+			candidates[i] = true
+		}
+	}
+	if len(candidates) != 1 {
+		return -1
+	}
+	for i := range candidates {
+		return i
+	}
+	return -1
+}
+
+// blameLines returns the commit that last changed each line of the HEAD
+// version of a file, keyed by line number.
+func blameLines(ctx context.Context, path string) (map[int]string, error) {
+	out, err := exec.CommandContext(ctx, "git", "blame", "--porcelain", "HEAD", "--", path).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git blame %s failed", path)
+	}
+	lines := map[int]string{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	s.Buffer(nil, 1<<30)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || len(fields[0]) != 40 || !plumbing.IsHash(fields[0]) {
+			continue
+		}
+		if n, err := strconv.Atoi(fields[2]); err == nil {
+			lines[n] = fields[0]
+		}
+	}
+	return lines, nil
+}
+
+// applyStaged stages the given hunks.
+func applyStaged(ctx context.Context, files []*stagedFile) error {
+	var b strings.Builder
+	for _, file := range files {
+		for _, line := range file.header {
+			b.WriteString(line + "\n")
+		}
+		for _, hunk := range file.hunks {
+			for _, line := range hunk.lines {
+				b.WriteString(line + "\n")
+			}
+		}
+	}
+	cmd := exec.CommandContext(ctx, "git", "apply", "--cached")
+	cmd.Stdin = strings.NewReader(b.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf(
+			"git apply failed: %s\nthe staged changes were saved to .git/%s",
+			strings.TrimSpace(string(out)),
+			absorbPatchFile,
+		)
+	}
+	return nil
+}
+
+func countHunks(files []*stagedFile) string {
+	n := 0
+	for _, file := range files {
+		n += len(file.hunks)
+		if len(file.hunks) == 0 {
+			n++
+		}
+	}
+	if n == 1 {
+		return "1 hunk"
+	}
+	return strconv.Itoa(n) + " hunks"
+}
+
+func saveAbsorbPatch(repo *git.Repository, patch []byte) error {
+	fs, ok := stack.DotGitFilesystem(repo)
+	if !ok {
+		return errors.New("cannot save the staged changes for this repository")
+	}
+	if err := fs.MkdirAll("plz", 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(util.WriteFile(fs, absorbPatchFile, patch, 0o644))
+}
+
+func removeAbsorbPatch(repo *git.Repository) error {
+	fs, ok := stack.DotGitFilesystem(repo)
+	if !ok {
+		return nil
+	}
+	err := fs.Remove(absorbPatchFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
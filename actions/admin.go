@@ -0,0 +1,196 @@
+package actions
+
+import (
+	"context"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// reviewBranchPattern is the branch protection pattern matching all review
+// branches.
+const reviewBranchPattern = reviewBranchPrefix + "**"
+
+// CreateBranchProtectionRuleInput is the input to GitHub's
+// createBranchProtectionRule mutation. The name must match the GraphQL type.
+type CreateBranchProtectionRuleInput struct {
+	RepositoryID graphql.ID `json:"repositoryId"`
+	BranchProtectionRuleSettings
+}
+
+// UpdateBranchProtectionRuleInput is the input to GitHub's
+// updateBranchProtectionRule mutation. The name must match the GraphQL type.
+type UpdateBranchProtectionRuleInput struct {
+	BranchProtectionRuleID graphql.ID `json:"branchProtectionRuleId"`
+	BranchProtectionRuleSettings
+}
+
+// BranchProtectionRuleSettings are the branch protection settings that plz
+// manages for review branches.
+type BranchProtectionRuleSettings struct {
+	Pattern                  graphql.String  `json:"pattern"`
+	AllowsForcePushes        graphql.Boolean `json:"allowsForcePushes"`
+	AllowsDeletions          graphql.Boolean `json:"allowsDeletions"`
+	RequiresStatusChecks     graphql.Boolean `json:"requiresStatusChecks"`
+	RequiresApprovingReviews graphql.Boolean `json:"requiresApprovingReviews"`
+	RestrictsPushes          graphql.Boolean `json:"restrictsPushes"`
+	PushActorIDs             []graphql.ID    `json:"pushActorIds,omitempty"`
+}
+
+// ProtectReviewBranches creates or updates a branch protection rule for the
+// plz.review/** namespace. Review branches are rewritten on every publish, so
+// the rule allows force-pushes and deletions and doesn't require status checks
+// or approvals, which would otherwise be inherited from broader rules. With
+// --app, pushes are restricted to the given GitHub App and the teams and
+// direct collaborators with write access to the repo, as of when the rule is
+// set, so run it again after granting more people access.
+func ProtectReviewBranches(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return err
+	}
+	ghRepo, err := gitHubRepo.Repository(ctx)
+	if err != nil {
+		return err
+	}
+	gitHubGraphQLClient := newGitHubGraphQLClient(token)
+
+	settings := BranchProtectionRuleSettings{
+		Pattern:                  reviewBranchPattern,
+		AllowsForcePushes:        true,
+		AllowsDeletions:          true,
+		RequiresStatusChecks:     false,
+		RequiresApprovingReviews: false,
+	}
+	if appSlug := c.String("app"); appSlug != "" {
+		app, _, err := gitHubRepo.Client().Apps.Get(ctx, appSlug)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		// plz pushes review branches with the user's own token, so the users
+		// who can write to the repo have to stay allowed alongside the app.
+		actors, err := repoWriters(ctx, gitHubRepo)
+		if err != nil {
+			return err
+		}
+		settings.RestrictsPushes = true
+		settings.PushActorIDs = append([]graphql.ID{app.GetNodeID()}, actors...)
+	}
+
+	var query struct {
+		Repository struct {
+			BranchProtectionRules struct {
+				Nodes []struct {
+					ID      graphql.ID `graphql:"id"`
+					Pattern string     `graphql:"pattern"`
+				} `graphql:"nodes"`
+			} `graphql:"branchProtectionRules(first: 100)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	err = gitHubGraphQLClient.Query(ctx, &query, map[string]interface{}{
+		"owner": graphql.String(gitHubRepo.Owner()),
+		"name":  graphql.String(gitHubRepo.Name()),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, rule := range query.Repository.BranchProtectionRules.Nodes {
+		if rule.Pattern != reviewBranchPattern {
+			continue
+		}
+		deps.GraphQLDebugLog.Println("updating branch protection rule", rule.ID)
+		var mutation struct {
+			UpdateBranchProtectionRule struct {
+				ClientMutationID string `graphql:"clientMutationId"`
+			} `graphql:"updateBranchProtectionRule(input: $input)"`
+		}
+		err := gitHubGraphQLClient.Mutate(ctx, &mutation, map[string]interface{}{
+			"input": UpdateBranchProtectionRuleInput{
+				BranchProtectionRuleID:       rule.ID,
+				BranchProtectionRuleSettings: settings,
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		deps.InfoLog.Printf("updated branch protection for %s", reviewBranchPattern)
+		return nil
+	}
+
+	deps.GraphQLDebugLog.Println("creating branch protection rule")
+	var mutation struct {
+		CreateBranchProtectionRule struct {
+			ClientMutationID string `graphql:"clientMutationId"`
+		} `graphql:"createBranchProtectionRule(input: $input)"`
+	}
+	err = gitHubGraphQLClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"input": CreateBranchProtectionRuleInput{
+			RepositoryID:                 ghRepo.GetNodeID(),
+			BranchProtectionRuleSettings: settings,
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	deps.InfoLog.Printf("created branch protection for %s", reviewBranchPattern)
+	return nil
+}
+
+// repoWriters returns the node IDs of the teams and direct collaborators that
+// have write access to the repo.
+func repoWriters(ctx context.Context, gitHubRepo *gitHubRepo) ([]graphql.ID, error) {
+	client := gitHubRepo.Client()
+	var actors []graphql.ID
+	teamOpts := &github.ListOptions{PerPage: 100}
+	for {
+		teams, resp, err := client.Repositories.ListTeams(ctx, gitHubRepo.Owner(), gitHubRepo.Name(), teamOpts)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, team := range teams {
+			switch team.GetPermission() {
+			case "push", "maintain", "admin":
+				actors = append(actors, team.GetNodeID())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		teamOpts.Page = resp.NextPage
+	}
+	collaboratorOpts := &github.ListCollaboratorsOptions{
+		Affiliation: "direct",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		users, resp, err := client.Repositories.ListCollaborators(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			collaboratorOpts,
+		)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, user := range users {
+			if user.GetPermissions()["push"] {
+				actors = append(actors, user.GetNodeID())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		collaboratorOpts.Page = resp.NextPage
+	}
+	return actors, nil
+}
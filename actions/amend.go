@@ -0,0 +1,148 @@
+package actions
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// Amend folds the staged changes into HEAD or another commit in the stack,
+// keeping its message and review, and rewrites the commits above it. The
+// staged paths must not be changed by any commit above the amended one, since
+// that would need a merge. The index and worktree are left as they are, so
+// unstaged changes are kept.
+func Amend(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !headRef.Name().IsBranch() {
+		return errors.New("HEAD is detached, check out the stack's branch first")
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	out, err := exec.CommandContext(ctx, "git", "write-tree").Output()
+	if err != nil {
+		return errors.New("cannot amend with unmerged files in the index")
+	}
+	indexTree, err := repo.TreeObject(plumbing.NewHash(strings.TrimSpace(string(out))))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	changes, err := object.DiffTree(headTree, indexTree)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(changes) == 0 {
+		return errors.New("no staged changes")
+	}
+
+	commits := []*object.Commit{headCommit}
+	index := 0
+	if rev := c.String("commit"); rev != "" {
+		defaultBranch, err := localDefaultBranch(ctx, repo)
+		if err != nil {
+			return err
+		}
+		commits, err = stack.LocalCommits(ctx, repo, headCommit, defaultBranch)
+		if err != nil {
+			return err
+		}
+		index, err = stackCommitIndex(repo, commits, rev)
+		if err != nil {
+			return err
+		}
+	}
+	target := commits[index]
+	targetTree, err := target.Tree()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Each staged path maps to its new entry, or nil if it was deleted. Since
+	// none of the paths change between the amended commit and HEAD, the same
+	// updates apply to every commit in between.
+	updates := map[string]*object.TreeEntry{}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name == "" {
+				continue
+			}
+			if !sameEntry(findEntry(targetTree, name), findEntry(headTree, name)) {
+				return errors.Errorf(
+					"%s is changed by a commit above %s, amend that commit instead",
+					name,
+					shortSHA(target.Hash.String()),
+				)
+			}
+		}
+		if change.From.Name != "" {
+			updates[change.From.Name] = nil
+		}
+		if change.To.Name != "" {
+			entry := change.To.TreeEntry
+			updates[change.To.Name] = &entry
+		}
+	}
+
+	parentHash := target.ParentHashes
+	for i := index; i >= 0; i-- {
+		commit := commits[i]
+		tree, err := commit.Tree()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		treeHash, err := updateTree(repo, tree, updates)
+		if err != nil {
+			return err
+		}
+		message := commit.Message
+		if i == index {
+			message = stripAttestation(message)
+		}
+		amended := &object.Commit{
+			Author:       commit.Author,
+			Committer:    commit.Committer,
+			Message:      message,
+			TreeHash:     treeHash,
+			ParentHashes: parentHash,
+		}
+		hash, err := storeCommit(ctx, repo, amended)
+		if err != nil {
+			return err
+		}
+		deps.GitDebugLog.Println("rewrote", commit.Hash, "as", hash)
+		parentHash = []plumbing.Hash{hash}
+	}
+	deps.GitDebugLog.Println("repointing", headRef.Name(), "to", parentHash[0])
+	err = repo.Storer.SetReference(plumbing.NewHashReference(headRef.Name(), parentHash[0]))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !c.Bool("review") {
+		deps.InfoLog.Printf("amended %s, run plz review to publish it", shortSHA(target.Hash.String()))
+		return nil
+	}
+	deps.InfoLog.Printf("amended %s", shortSHA(target.Hash.String()))
+	return RunReview(ctx, &ReviewOptions{})
+}
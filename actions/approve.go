@@ -0,0 +1,104 @@
+package actions
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+var reviewArgRegex = regexp.MustCompile(`^(?:https://plz\.review/review/)?(\w+)/?$`)
+
+// ReviewEvent is the plz GraphQL enum of review actions. The name must match
+// the GraphQL type.
+type ReviewEvent string
+
+const (
+	reviewEventApprove        ReviewEvent = "APPROVE"
+	reviewEventRequestChanges ReviewEvent = "REQUEST_CHANGES"
+)
+
+// SubmitReviewInput is the input to the submitReview mutation. The name must
+// match the GraphQL type.
+type SubmitReviewInput struct {
+	ReviewID graphql.ID  `json:"reviewID"`
+	Event    ReviewEvent `json:"event"`
+	Body     string      `json:"body,omitempty"`
+}
+
+// Approve approves the review of the HEAD commit or the given review.
+func Approve(c *cli.Context) error {
+	return submitReview(c, reviewEventApprove)
+}
+
+// RequestChanges requests changes on the review of the HEAD commit or the
+// given review.
+func RequestChanges(c *cli.Context) error {
+	return submitReview(c, reviewEventRequestChanges)
+}
+
+func submitReview(c *cli.Context, event ReviewEvent) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	if c.NArg() > 1 {
+		return errors.Errorf("usage: plz %s [<review-id>]", c.Command.Name)
+	}
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+
+	var reviewID string
+	if c.NArg() == 1 {
+		reviewID, err = parseReviewArg(c.Args().First())
+	} else {
+		var repo *git.Repository
+		repo, err = openGitRepo()
+		if err == nil {
+			reviewID, _, err = headReviewID(repo)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var mutation struct {
+		SubmitReview struct {
+			ID string `graphql:"id"`
+		} `graphql:"submitReview(input: $input)"`
+	}
+	err = graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"input": SubmitReviewInput{
+			ReviewID: graphql.ID(reviewID),
+			Event:    event,
+			Body:     c.String("message"),
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	verb := "approved"
+	if event == reviewEventRequestChanges {
+		verb = "requested changes on"
+	}
+	deps.InfoLog.Printf("%s https://plz.review/review/%s", verb, reviewID)
+	return nil
+}
+
+// parseReviewArg returns the review ID from a command-line argument that is
+// either a review ID or a plz.review URL.
+func parseReviewArg(arg string) (string, error) {
+	matches := reviewArgRegex.FindStringSubmatch(arg)
+	if matches == nil {
+		return "", errors.Errorf("invalid review %q, expected a review ID or plz.review URL", arg)
+	}
+	return matches[1], nil
+}
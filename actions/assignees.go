@@ -0,0 +1,71 @@
+package actions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+)
+
+// resolveAssignees returns the assignees for the review PRs, defaulting to the
+// authenticated user if none were given.
+func resolveAssignees(ctx context.Context, gitHubRepo *gitHubRepo, assignees []string) ([]string, error) {
+	if len(assignees) > 0 {
+		for _, assignee := range assignees {
+			if !reviewerUsernameRegex.MatchString(assignee) {
+				return nil, errors.Errorf("invalid assignee username: %q", assignee)
+			}
+		}
+		return assignees, nil
+	}
+	user, _, err := gitHubRepo.Client().Users.Get(ctx, "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return []string{user.GetLogin()}, nil
+}
+
+// assigneesToAdd returns the assignees that aren't yet assigned to the review's
+// PR.
+func assigneesToAdd(ri *reviewInfo, assignees []string) []string {
+	if ri.pr == nil {
+		return assignees
+	}
+	var toAdd []string
+	for _, a := range assignees {
+		needToAdd := true
+		for _, existing := range ri.pr.Assignees {
+			if strings.EqualFold(existing.GetLogin(), a) {
+				needToAdd = false
+				break
+			}
+		}
+		if needToAdd {
+			toAdd = append(toAdd, a)
+		}
+	}
+	return toAdd
+}
+
+// syncAssignees assigns the review's PR to any assignees it doesn't have yet,
+// returning whether the PR was updated.
+func syncAssignees(ctx context.Context, gitHubRepo *gitHubRepo, ri *reviewInfo, opts *prOptions) (bool, error) {
+	deps := deps.FromContext(ctx)
+	toAdd := assigneesToAdd(ri, opts.assignees)
+	if len(toAdd) == 0 {
+		return false, nil
+	}
+	deps.APIDebugLog.Println("adding assignees", toAdd, "to PR", ri.prNumber())
+	_, _, err := gitHubRepo.Client().Issues.AddAssignees(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		ri.prNumber(),
+		toAdd,
+	)
+	if err != nil {
+		return true, errors.WithStack(err)
+	}
+	return true, nil
+}
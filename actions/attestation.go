@@ -0,0 +1,185 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+var (
+	attestationTrailerRegex = regexp.MustCompile(
+		`^\s*((?i)plz-attestation)\s*:\s*(.*?)\s*$`,
+	)
+	attestationSigTrailerRegex = regexp.MustCompile(
+		`^\s*((?i)plz-attestation-sig)\s*:\s*(\S*)\s*$`,
+	)
+)
+
+// attestor signs attestations recording who published a revision, from which
+// machine and from which source commit. Attestations are added to published
+// commits as a pair of trailers:
+//
+//	plz-attestation: review=<id> source=<sha> publisher=<login> host=<hostname>
+//	plz-attestation-sig: <base64 detached PGP signature of the above value>
+//
+// Signing is delegated to gpg, like Git does for signed commits.
+type attestor struct {
+	key       string
+	publisher string
+	host      string
+}
+
+// newAttestor returns an attestor if plz.attest is enabled, or nil otherwise.
+// The signing key is set with plz.attestationKey and defaults to gpg's default
+// key.
+func newAttestor(ctx context.Context, gitHubRepo *gitHubRepo) (*attestor, error) {
+	deps := deps.FromContext(ctx)
+	if !deps.Config.GetBool("attest", false) {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return nil, errors.New("plz.attest is enabled but gpg is not installed")
+	}
+	user, _, err := gitHubRepo.Client().Users.Get(ctx, "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &attestor{
+		key:       deps.Config.Get("attestationKey"),
+		publisher: user.GetLogin(),
+		host:      host,
+	}, nil
+}
+
+// needsAttestation reports whether the commit should be rewritten to add an
+// attestation. It is safe to call on a nil attestor.
+func (a *attestor) needsAttestation(commit *object.Commit) bool {
+	if a == nil {
+		return false
+	}
+	_, _, ok, _ := attestationFromCommitMessage(commit.Message)
+	return !ok
+}
+
+// attest replaces any attestation trailers in message with a newly signed
+// attestation for the given review and source commit.
+func (a *attestor) attest(message string, reviewID string, source string) (string, error) {
+	payload := fmt.Sprintf(
+		"review=%s source=%s publisher=%s host=%s",
+		reviewID,
+		source,
+		a.publisher,
+		a.host,
+	)
+	args := []string{"--batch", "--detach-sign"}
+	if a.key != "" {
+		args = append(args, "--local-user", a.key)
+	}
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = strings.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Errorf("gpg failed to sign attestation: %s", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRightFunc(stripAttestation(message), unicode.IsSpace) +
+		"\nplz-attestation: " + payload +
+		"\nplz-attestation-sig: " + base64.StdEncoding.EncodeToString(stdout.Bytes()), nil
+}
+
+// stripAttestation removes attestation trailers from a commit message.
+func stripAttestation(message string) string {
+	var b strings.Builder
+	s := bufio.NewScanner(strings.NewReader(message))
+	for s.Scan() {
+		line := s.Text()
+		if attestationTrailerRegex.MatchString(line) || attestationSigTrailerRegex.MatchString(line) {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// attestationFromCommitMessage returns the attestation payload and signature
+// from a commit message. ok is false if the message has no attestation.
+func attestationFromCommitMessage(message string) (payload string, sig []byte, ok bool, err error) {
+	var encodedSig string
+	s := bufio.NewScanner(strings.NewReader(message))
+	for s.Scan() {
+		if matches := attestationSigTrailerRegex.FindStringSubmatch(s.Text()); matches != nil {
+			encodedSig = matches[2]
+		} else if matches := attestationTrailerRegex.FindStringSubmatch(s.Text()); matches != nil {
+			payload = matches[2]
+		}
+	}
+	if payload == "" && encodedSig == "" {
+		return "", nil, false, nil
+	}
+	if payload == "" || encodedSig == "" {
+		return "", nil, true, errors.New("incomplete attestation")
+	}
+	sig, err = base64.StdEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return "", nil, true, errors.New("malformed attestation signature")
+	}
+	return payload, sig, true, nil
+}
+
+// attestationField returns the value of the given field of an attestation
+// payload.
+func attestationField(payload string, field string) string {
+	for _, kv := range strings.Fields(payload) {
+		if v := strings.TrimPrefix(kv, field+"="); v != kv {
+			return v
+		}
+	}
+	return ""
+}
+
+// verifyAttestation checks the attestation signature with gpg and returns the
+// signer's user ID.
+func verifyAttestation(payload string, sig []byte) (string, error) {
+	f, err := os.CreateTemp("", "plz-attestation-*.sig")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(sig)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	cmd := exec.Command("gpg", "--batch", "--status-fd=1", "--verify", f.Name(), "-")
+	cmd.Stdin = strings.NewReader(payload)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	runErr := cmd.Run()
+	s := bufio.NewScanner(&stdout)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 4)
+		if runErr == nil && len(fields) == 4 && fields[0] == "[GNUPG:]" && fields[1] == "GOODSIG" {
+			return fields[3], nil
+		}
+	}
+	return "", errors.New("bad signature")
+}
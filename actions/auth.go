@@ -1,16 +1,25 @@
 package actions
 
 import (
-	"github.com/bitcomplete/plz-cli/client/auth"
 	"github.com/bitcomplete/plz-cli/client/deps"
 	"github.com/urfave/cli/v2"
 )
 
 func Auth(c *cli.Context) error {
 	deps := deps.FromContext(c.Context)
-	auth, err := auth.Prompt(deps.PlzAPIBaseURL)
-	if err != nil {
+	if store := c.String("store"); store != "" {
+		if err := deps.Auth.SetStore(store); err != nil {
+			return err
+		}
+	}
+	if err := deps.Auth.Prompt(deps.Color); err != nil {
+		return err
+	}
+	if err := deps.Auth.Save(); err != nil {
 		return err
 	}
-	return auth.SaveToKeyRing()
+	if profile := deps.Auth.Profile(); profile != "" {
+		deps.InfoLog.Printf("signed in for profile %s", profile)
+	}
+	return nil
 }
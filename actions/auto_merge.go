@@ -0,0 +1,106 @@
+package actions
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// AutoMergeMethod is the value of the --auto-merge flag. It may be given
+// without a value, in which case PRs are squash merged.
+type AutoMergeMethod struct {
+	method string
+}
+
+func (m *AutoMergeMethod) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "true", "squash":
+		m.method = "SQUASH"
+	case "merge":
+		m.method = "MERGE"
+	case "rebase":
+		m.method = "REBASE"
+	case "false":
+		m.method = ""
+	default:
+		return errors.Errorf("invalid auto-merge method %q, must be one of squash, merge or rebase", value)
+	}
+	return nil
+}
+
+func (m *AutoMergeMethod) String() string {
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(m.method)
+}
+
+// IsBoolFlag allows the flag to be given without a value.
+func (m *AutoMergeMethod) IsBoolFlag() bool {
+	return true
+}
+
+// autoMergeMethod returns the merge method selected with --auto-merge, as
+// accepted by ReviewOptions, or an empty string if auto-merge wasn't requested.
+func autoMergeMethod(c *cli.Context) string {
+	m, ok := c.Generic("auto-merge").(*AutoMergeMethod)
+	if !ok || m == nil {
+		return ""
+	}
+	return m.String()
+}
+
+// PullRequestMergeMethod is GitHub's GraphQL enum of merge methods. The name
+// must match the GraphQL type.
+type PullRequestMergeMethod string
+
+// EnablePullRequestAutoMergeInput is the input to GitHub's
+// enablePullRequestAutoMerge mutation. The name must match the GraphQL type.
+type EnablePullRequestAutoMergeInput struct {
+	PullRequestID graphql.ID             `json:"pullRequestId"`
+	MergeMethod   PullRequestMergeMethod `json:"mergeMethod"`
+}
+
+// newGitHubGraphQLClient returns a client for GitHub's GraphQL API, as opposed
+// to the plz API.
+func newGitHubGraphQLClient(token string) *graphql.Client {
+	return graphql.NewClient("https://api.github.com/graphql", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+}
+
+// enableAutoMerge enables auto-merge on the review's PR. Failures are only
+// warnings since the PR has been published either way, and GitHub refuses to
+// enable auto-merge on PRs that can already be merged.
+func enableAutoMerge(
+	ctx context.Context,
+	gitHubGraphQLClient *graphql.Client,
+	ri *reviewInfo,
+	method string,
+) {
+	deps := deps.FromContext(ctx)
+	nodeID := ri.createdPR.GetNodeID()
+	if ri.pr != nil {
+		nodeID = ri.pr.GetNodeID()
+	}
+	deps.GraphQLDebugLog.Println("enabling auto-merge on PR", ri.prNumber(), "with method", method)
+	var mutation struct {
+		EnablePullRequestAutoMerge struct {
+			ClientMutationID string `graphql:"clientMutationId"`
+		} `graphql:"enablePullRequestAutoMerge(input: $input)"`
+	}
+	err := gitHubGraphQLClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"input": EnablePullRequestAutoMergeInput{
+			PullRequestID: nodeID,
+			MergeMethod:   PullRequestMergeMethod(method),
+		},
+	})
+	if err != nil {
+		deps.ErrorLog.Printf("warning: could not enable auto-merge on PR #%d: %v", ri.prNumber(), err)
+	}
+}
@@ -0,0 +1,149 @@
+package actions
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// autostashFlag returns whether to autostash, from --autostash if given and
+// otherwise from plz.autostash.
+func autostashFlag(c *cli.Context) bool {
+	if c.IsSet("autostash") {
+		return c.Bool("autostash")
+	}
+	return deps.FromContext(c.Context).Config.GetBool("autostash", false)
+}
+
+// requireCleanWorktree fails if the worktree has uncommitted changes, unless
+// autostash is set, in which case changes to tracked files are stashed like
+// git rebase --autostash does. It returns the stash commit, if any, which the
+// caller must restore with applyAutostash when it's done.
+func requireCleanWorktree(ctx context.Context, autostash bool) (string, error) {
+	isClean, err := isCleanWorktree(ctx)
+	if err != nil {
+		return "", err
+	}
+	if isClean {
+		return "", nil
+	}
+	if !autostash {
+		return "", errors.Errorf("index is not clean, commit or stash your changes, or use --autostash")
+	}
+	stash, err := createAutostash(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Untracked files aren't stashed, as with git rebase --autostash.
+	isClean, err = isCleanWorktree(ctx)
+	if err == nil && !isClean {
+		err = errors.New("index is not clean, --autostash doesn't stash untracked files, see --ignore-untracked")
+	}
+	if err != nil {
+		applyAutostash(ctx, stash)
+		return "", err
+	}
+	return stash, nil
+}
+
+// createAutostash stashes changes to tracked files without adding them to the
+// stash list, and resets the worktree to HEAD. It returns an empty string if
+// there was nothing to stash.
+func createAutostash(ctx context.Context) (string, error) {
+	deps := deps.FromContext(ctx)
+	out, err := exec.CommandContext(ctx, "git", "stash", "create", "plz autostash").Output()
+	if err != nil {
+		return "", errors.Errorf("cannot stash changes: %v", err)
+	}
+	stash := strings.TrimSpace(string(out))
+	if stash == "" {
+		return "", nil
+	}
+	if err := runGit(ctx, "reset", "--hard", "--quiet"); err != nil {
+		// The reset may have got part way, so keep the changes safe.
+		storeAutostash(ctx, stash)
+		return "", err
+	}
+	deps.InfoLog.Println("Created autostash:", shortSHA(stash))
+	return stash, nil
+}
+
+// applyAutostash restores changes stashed by createAutostash. If they don't
+// apply cleanly, they're kept in the stash list instead, so nothing is lost.
+// Unlike go-git, git stash apply runs the LFS smudge filter itself.
+// Failures are reported rather than returned, since the operation that the
+// changes were stashed for has already happened.
+func applyAutostash(ctx context.Context, stash string) {
+	ctx = withoutCancel(ctx)
+	deps := deps.FromContext(ctx)
+	if stash == "" {
+		return
+	}
+	if err := runGit(ctx, "stash", "apply", "--quiet", stash); err == nil {
+		deps.InfoLog.Println("Applied autostash.")
+		return
+	}
+	deps.ErrorLog.Println("Applying autostash resulted in conflicts.")
+	storeAutostash(ctx, stash)
+}
+
+// storeAutostash adds changes stashed by createAutostash to the stash list.
+func storeAutostash(ctx context.Context, stash string) {
+	ctx = withoutCancel(ctx)
+	deps := deps.FromContext(ctx)
+	if err := runGit(ctx, "stash", "store", "--message", "plz autostash", stash); err != nil {
+		deps.ErrorLog.Printf("warning: cannot store autostash %s: %v", stash, err)
+		return
+	}
+	deps.ErrorLog.Println("Your changes are safe in the stash, run git stash pop or git stash drop at any time.")
+}
+
+// finishSyncAutostash restores changes stashed for plz sync, unless the sync
+// stopped on a conflict, in which case they're recorded in the sync state to
+// be restored by plz sync --continue or --abort.
+func finishSyncAutostash(ctx context.Context, repo *git.Repository, stash string) {
+	ctx = withoutCancel(ctx)
+	deps := deps.FromContext(ctx)
+	if stash == "" {
+		return
+	}
+	state, err := loadSyncState(repo)
+	if err == nil && state == nil {
+		applyAutostash(ctx, stash)
+		return
+	}
+	if err == nil {
+		state.Autostash = stash
+		err = saveSyncState(repo, state)
+	}
+	if err == nil {
+		deps.InfoLog.Println("Your changes are stashed until plz sync --continue or --abort.")
+		return
+	}
+	deps.ErrorLog.Printf("warning: cannot record autostash: %v", err)
+	storeAutostash(ctx, stash)
+}
+
+// uncanceledContext has the values of its parent, but isn't canceled with it,
+// like context.WithoutCancel.
+type uncanceledContext struct {
+	parent context.Context
+}
+
+// withoutCancel returns a context with the values of ctx that isn't canceled
+// when ctx is, so that stashed changes are still restored or stored after the
+// command is interrupted with Ctrl-C.
+func withoutCancel(ctx context.Context) context.Context {
+	return uncanceledContext{parent: ctx}
+}
+
+func (uncanceledContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (uncanceledContext) Done() <-chan struct{}               { return nil }
+func (uncanceledContext) Err() error                          { return nil }
+func (c uncanceledContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,125 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// Checkout fetches the head branch of any review, along with the stack below
+// it, and checks it out on a local branch, even if the stack was never local.
+func Checkout(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	if c.NArg() != 1 {
+		return errors.New("usage: plz checkout <review-id>")
+	}
+	reviewID, err := parseReviewArg(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+
+	isClean, err := isCleanWorktree(ctx)
+	if err != nil {
+		return err
+	}
+	if !isClean {
+		return errors.Errorf("index is not clean")
+	}
+
+	var query struct {
+		Review struct {
+			HeadBranch string             `graphql:"headBranch"`
+			Status     stack.ReviewStatus `graphql:"status"`
+		} `graphql:"review(id: $reviewId)"`
+	}
+	err = graphqlClient.Query(ctx, &query, map[string]interface{}{
+		"reviewId": graphql.ID(reviewID),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if query.Review.Status != stack.ReviewStatusOpen {
+		deps.ErrorLog.Printf("warning: review %s is %s", reviewID, query.Review.Status)
+	}
+	if err := pullBranch(ctx, gitHubRepo, query.Review.HeadBranch); err != nil {
+		return err
+	}
+	repo := gitHubRepo.GitRepo()
+	reviewRef, err := repo.Reference(plumbing.NewBranchReferenceName(query.Review.HeadBranch), true)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	branch := c.String("branch")
+	if branch == "" {
+		branch = "plz/" + reviewID
+	}
+	branchRefName := plumbing.NewBranchReferenceName(branch)
+	existing, err := repo.Reference(branchRefName, true)
+	if err == nil && existing.Hash() != reviewRef.Hash() && !c.Bool("force") {
+		// Only fast-forward an existing branch, so that local work on it
+		// isn't lost.
+		existingCommit, err := repo.CommitObject(existing.Hash())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		reviewCommit, err := repo.CommitObject(reviewRef.Hash())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		isAncestor, err := existingCommit.IsAncestor(reviewCommit)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !isAncestor {
+			return errors.Errorf(
+				"branch %s has commits that aren't part of review %s, use --force to overwrite it or --branch to pick another name",
+				branch,
+				reviewID,
+			)
+		}
+	} else if err != nil && err != plumbing.ErrReferenceNotFound {
+		return errors.WithStack(err)
+	}
+	deps.GitDebugLog.Println("pointing", branchRefName, "to", reviewRef.Hash())
+	err = repo.Storer.SetReference(plumbing.NewHashReference(branchRefName, reviewRef.Hash()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = worktree.Checkout(&git.CheckoutOptions{Branch: branchRefName})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !c.Bool("no-lfs") {
+		if err := checkoutLFSFiles(ctx, repo); err != nil {
+			return err
+		}
+	}
+	deps.InfoLog.Printf("checked out review %s on branch %s", reviewID, branch)
+	return nil
+}
@@ -0,0 +1,136 @@
+package actions
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// checkState summarizes the CI checks and commit statuses of a review's head
+// commit.
+type checkState string
+
+const (
+	checkStateNone    checkState = ""
+	checkStatePassing checkState = "passing"
+	checkStateFailing checkState = "failing"
+	checkStatePending checkState = "pending"
+)
+
+// maxConcurrentCheckQueries bounds the number of reviews whose checks are
+// fetched from GitHub at once.
+const maxConcurrentCheckQueries = 8
+
+// role returns the color role used to render the check state.
+func (s checkState) role() colorRole {
+	switch s {
+	case checkStatePassing:
+		return roleOK
+	case checkStateFailing:
+		return roleError
+	case checkStatePending:
+		return roleWarn
+	}
+	return roleInfo
+}
+
+// loadCheckStates returns the check state of the latest revision of each open
+// review in the stack, keyed by review ID.
+func loadCheckStates(
+	ctx context.Context,
+	client *github.Client,
+	owner string,
+	repo string,
+	s stack.CommitStack,
+) (map[string]checkState, error) {
+	var mu sync.Mutex
+	states := map[string]checkState{}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentCheckQueries)
+	for _, ci := range s {
+		if ci.Review == nil || ci.Review.Status != stack.ReviewStatusOpen {
+			continue
+		}
+		reviewID := ci.Review.ID
+		sha := ci.Review.LatestRevision.HeadCommitSHA
+		g.Go(func() error {
+			state, err := loadCheckState(gctx, client, owner, repo, sha)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			states[reviewID] = state
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// loadCheckState combines the check runs and commit statuses for a commit. Any
+// failure makes the commit failing, otherwise anything incomplete makes it
+// pending.
+func loadCheckState(
+	ctx context.Context,
+	client *github.Client,
+	owner string,
+	repo string,
+	sha string,
+) (checkState, error) {
+	var passing, pending, failing bool
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, nil)
+	if err != nil {
+		return checkStateNone, errors.WithStack(err)
+	}
+	if combined.GetTotalCount() > 0 {
+		switch combined.GetState() {
+		case "success":
+			passing = true
+		case "pending":
+			pending = true
+		default:
+			failing = true
+		}
+	}
+	opts := &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		runs, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return checkStateNone, errors.WithStack(err)
+		}
+		for _, run := range runs.CheckRuns {
+			if run.GetStatus() != "completed" {
+				pending = true
+				continue
+			}
+			switch run.GetConclusion() {
+			case "success", "neutral", "skipped":
+				passing = true
+			default:
+				failing = true
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	switch {
+	case failing:
+		return checkStateFailing, nil
+	case pending:
+		return checkStatePending, nil
+	case passing:
+		return checkStatePassing, nil
+	}
+	return checkStateNone, nil
+}
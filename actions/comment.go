@@ -0,0 +1,114 @@
+package actions
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// AddReviewCommentInput is the input to the addReviewComment mutation. The name
+// must match the GraphQL type.
+type AddReviewCommentInput struct {
+	ReviewID      graphql.ID `json:"reviewID"`
+	HeadCommitSHA string     `json:"headCommitSha"`
+	Body          string     `json:"body"`
+	Path          string     `json:"path,omitempty"`
+	Line          int        `json:"line,omitempty"`
+}
+
+// Comment posts a comment on the review of the HEAD commit. The comment is
+// taken from -m, from stdin if it isn't a terminal, or otherwise from the
+// user's editor. With --file and --line the comment is an inline comment on
+// that line of the HEAD commit.
+func Comment(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	if c.IsSet("line") && c.String("file") == "" {
+		return errors.New("--line requires --file")
+	}
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	reviewID, headHash, err := headReviewID(repo)
+	if err != nil {
+		return err
+	}
+
+	body := c.String("message")
+	if body == "" {
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			body = strings.TrimSpace(string(b))
+		} else {
+			body, err = editText(
+				"\n# Write a comment for https://plz.review/review/" + reviewID + ".\n" +
+					"# Lines starting with # are ignored, and an empty comment aborts.\n",
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if body == "" {
+		return errors.New("empty comment, aborting")
+	}
+
+	var mutation struct {
+		AddReviewComment struct {
+			ID string `graphql:"id"`
+		} `graphql:"addReviewComment(input: $input)"`
+	}
+	err = graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"input": AddReviewCommentInput{
+			ReviewID:      graphql.ID(reviewID),
+			HeadCommitSHA: headHash,
+			Body:          body,
+			Path:          c.String("file"),
+			Line:          c.Int("line"),
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	deps.InfoLog.Println("commented on https://plz.review/review/" + reviewID)
+	return nil
+}
+
+// headReviewID returns the ID of the review that the HEAD commit belongs to,
+// along with the HEAD commit's SHA.
+func headReviewID(repo *git.Repository) (string, string, error) {
+	headRef, err := repo.Head()
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	reviewID := stack.ReviewIDFromCommitMessage(headCommit.Message)
+	if reviewID == "" {
+		return "", "", errors.New("HEAD is not part of a review, publish it with plz review first")
+	}
+	return reviewID, headCommit.Hash.String(), nil
+}
@@ -0,0 +1,48 @@
+package actions
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+const (
+	// committerPreserve keeps the committer of rewritten commits as it was.
+	committerPreserve = "preserve"
+	// committerReset makes the current user the committer of rewritten
+	// commits, with the current time, like git commit --amend.
+	committerReset = "reset"
+)
+
+var committerIdentRegex = regexp.MustCompile(`^(.*) <(.*)> \d+ [+-]\d{4}$`)
+
+// setCommitter applies plz.committer to a commit about to be written. The
+// author is always preserved.
+func setCommitter(ctx context.Context, commit *object.Commit) error {
+	deps := deps.FromContext(ctx)
+	switch mode := deps.Config.Get("committer"); mode {
+	case "", committerPreserve:
+		return nil
+	case committerReset:
+	default:
+		return errors.Errorf("invalid plz.committer %q, must be %s or %s", mode, committerPreserve, committerReset)
+	}
+	// git var honors user.name, user.email and the GIT_COMMITTER_*
+	// environment variables, the same way git commit does.
+	out, err := exec.CommandContext(ctx, "git", "var", "GIT_COMMITTER_IDENT").Output()
+	if err != nil {
+		return errors.New("cannot determine the committer, set user.name and user.email")
+	}
+	m := committerIdentRegex.FindStringSubmatch(strings.TrimSpace(string(out)))
+	if m == nil {
+		return errors.Errorf("cannot parse committer identity %q", strings.TrimSpace(string(out)))
+	}
+	commit.Committer = object.Signature{Name: m[1], Email: m[2], When: time.Now()}
+	return nil
+}
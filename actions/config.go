@@ -0,0 +1,53 @@
+package actions
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// Config gets or sets a plz setting. Settings live in the plz section of the
+// Git config, so this is shorthand for git config plz.<key> [<value>].
+func Config(c *cli.Context) error {
+	deps := deps.FromContext(c.Context)
+	args := c.Args().Slice()
+	if len(args) == 0 || len(args) > 2 || (c.Bool("unset") && len(args) != 1) {
+		return errors.New("usage: plz config [--global] [--unset] <key> [<value>]")
+	}
+	key := strings.TrimPrefix(args[0], "plz.")
+
+	if len(args) == 1 && !c.Bool("unset") {
+		value := deps.Config.Get(key)
+		if value == "" {
+			return errors.Errorf("plz.%s is not set", key)
+		}
+		deps.InfoLog.Println(value)
+		return nil
+	}
+
+	gitArgs := []string{"config"}
+	if c.Bool("global") {
+		gitArgs = append(gitArgs, "--global")
+	}
+	if c.Bool("unset") {
+		gitArgs = append(gitArgs, "--unset")
+	}
+	gitArgs = append(gitArgs, "plz."+key)
+	if len(args) == 2 {
+		gitArgs = append(gitArgs, args[1])
+	}
+	cmd := exec.Command("git", gitArgs...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.Errorf("git config failed: %s", msg)
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package actions
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+)
+
+// confirmPublish shows what plz review is about to push and which PRs it will
+// open or edit, and asks for confirmation before anything on the remote is
+// changed. This happens on the first publish from a machine, recorded in the
+// global plz.publishConfirmed setting, and whenever always is set by
+// --confirm. The first-publish prompt is skipped when stdin isn't a terminal
+// so that scripts keep working. Like other prompts, it goes to the ErrorLog so
+// that it isn't hidden by --quiet.
+func confirmPublish(ctx context.Context, always bool, gitHubRepo *gitHubRepo, ris []*reviewInfo, opts *prOptions) error {
+	deps := deps.FromContext(ctx)
+	firstPublish := !deps.Config.GetBool("publishConfirmed", false)
+	if !always && !firstPublish {
+		return nil
+	}
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		if always {
+			return errors.New("--confirm needs an interactive terminal")
+		}
+		return nil
+	}
+
+	if firstPublish {
+		deps.ErrorLog.Print(
+			"plz review rewrites commits to add plz-review-url trailers, force-pushes a branch per\n" +
+				"commit and opens a PR for each. This is what it will do:\n\n",
+		)
+	}
+	if err := printReviewPlan(ctx, deps.ErrorLog.Writer(), gitHubRepo, ris, opts); err != nil {
+		return err
+	}
+	deps.ErrorLog.Writer().Write([]byte("\npublish? [y/N] "))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return errors.New("not confirmed, nothing was published")
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+	default:
+		return errors.New("not confirmed, nothing was published")
+	}
+
+	if firstPublish {
+		cmd := exec.Command("git", "config", "--global", "plz.publishConfirmed", "true")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			deps.ErrorLog.Printf(
+				"warning: failed to record confirmation, you will be asked again: %s",
+				strings.TrimSpace(string(out)),
+			)
+		}
+	}
+	return nil
+}
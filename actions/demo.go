@@ -0,0 +1,174 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// demo is a guided tour of the stacking workflow in a scratch repository.
+type demo struct {
+	c    *cli.Context
+	dir  string
+	live bool
+}
+
+// Demo walks the user through creating, publishing, amending and syncing a
+// stack in a scratch repository. By default the scratch repository's remote is
+// a local bare repository and the plz commands are only described; with
+// --remote, the scratch repository pushes to the given sandbox GitHub repo,
+// which must be empty, and the plz commands are run for real.
+func Demo(c *cli.Context) error {
+	deps := deps.FromContext(c.Context)
+	dir, err := os.MkdirTemp("", "plz-demo-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if c.Bool("keep") {
+		deps.InfoLog.Println("the scratch repository will be kept in", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	d := &demo{c: c, dir: filepath.Join(dir, "repo"), live: c.String("remote") != ""}
+
+	d.step("Welcome to plz! This demo creates a scratch repository in %s and walks through a stacked review workflow.", d.dir)
+	remote := c.String("remote")
+	if remote != "" {
+		// The demo pushes its own main branch, so only use a remote that
+		// doesn't have anything that could be overwritten.
+		refs, err := exec.CommandContext(c.Context, "git", "ls-remote", remote).Output()
+		if err != nil {
+			return errors.Wrapf(err, "git ls-remote %s failed", remote)
+		}
+		if len(strings.TrimSpace(string(refs))) > 0 {
+			return errors.Errorf("%s isn't empty, use a new, empty sandbox repo for the demo", remote)
+		}
+	} else {
+		remote = filepath.Join(dir, "origin.git")
+		if err := d.git(dir, "init", "--quiet", "--bare", "--initial-branch=main", remote); err != nil {
+			return err
+		}
+	}
+	if err := d.git(dir, "init", "--quiet", "--initial-branch=main", d.dir); err != nil {
+		return err
+	}
+	if err := d.commitFile("README.md", "# plz demo\n", "Initial commit"); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "remote", "add", "origin", remote); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "push", "--quiet", "--set-upstream", "origin", "main"); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "remote", "set-head", "origin", "main"); err != nil {
+		return err
+	}
+
+	d.step("A stack is just a series of commits on a branch, one commit per review. Let's create a branch with two commits.")
+	if err := d.git(d.dir, "checkout", "--quiet", "-b", "greeting"); err != nil {
+		return err
+	}
+	if err := d.commitFile("greeting.txt", "Hello\n", "Add a greeting"); err != nil {
+		return err
+	}
+	if err := d.commitFile("farewell.txt", "Goodbye\n", "Add a farewell"); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "log", "--oneline", "main..HEAD"); err != nil {
+		return err
+	}
+
+	d.step("plz review publishes every commit in the stack as its own review. Each commit gets a plz-review-url trailer, a review branch and a GitHub PR based on the review below it.")
+	if err := d.plz("review"); err != nil {
+		return err
+	}
+	if err := d.plz("status"); err != nil {
+		return err
+	}
+
+	d.step("To address feedback on a review, amend its commit, e.g. with a fixup commit and an autosquash rebase, then run plz review again. Only the changed reviews get new revisions.")
+	if err := d.writeFile("greeting.txt", "Hello, world\n"); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "commit", "--quiet", "--all", "--fixup=HEAD~1"); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "-c", "sequence.editor=true", "rebase", "--quiet", "--interactive", "--autosquash", "main"); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "log", "--oneline", "main..HEAD"); err != nil {
+		return err
+	}
+	if err := d.plz("review"); err != nil {
+		return err
+	}
+
+	d.step("When reviews are merged or updated by someone else, plz sync pulls the changes and restacks the remaining commits on top.")
+	if err := d.plz("sync"); err != nil {
+		return err
+	}
+
+	d.step("That's it! Run plz --help to see the other commands.")
+	return nil
+}
+
+// step explains the next step and waits for the user to continue.
+func (d *demo) step(format string, args ...interface{}) {
+	deps := deps.FromContext(d.c.Context)
+	deps.InfoLog.Print("\n" + bold(deps.Color, fmt.Sprintf(format, args...)))
+	deps.InfoLog.Print("Press Enter to continue...")
+	fmt.Scanln()
+}
+
+// git runs a Git command in dir, echoing it first.
+func (d *demo) git(dir string, args ...string) error {
+	deps := deps.FromContext(d.c.Context)
+	deps.InfoLog.Println("$ git", strings.Join(args, " "))
+	cmd := exec.CommandContext(d.c.Context, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = deps.InfoLog.Writer()
+	cmd.Stderr = deps.ErrorLog.Writer()
+	return errors.Wrapf(cmd.Run(), "git %s failed", strings.Join(args, " "))
+}
+
+// plz runs a plz command in the scratch repository if the demo is live, and
+// otherwise just shows it.
+func (d *demo) plz(args ...string) error {
+	deps := deps.FromContext(d.c.Context)
+	deps.InfoLog.Println("$ plz", strings.Join(args, " "))
+	if !d.live {
+		deps.InfoLog.Println("(not run since the scratch repository isn't on GitHub, use --remote to try it for real)")
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	cmd := exec.CommandContext(d.c.Context, self, args...)
+	cmd.Dir = d.dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = deps.InfoLog.Writer()
+	cmd.Stderr = deps.ErrorLog.Writer()
+	return errors.Wrapf(cmd.Run(), "plz %s failed", args[0])
+}
+
+func (d *demo) writeFile(name string, contents string) error {
+	return errors.WithStack(os.WriteFile(filepath.Join(d.dir, name), []byte(contents), 0644))
+}
+
+func (d *demo) commitFile(name string, contents string, message string) error {
+	if err := d.writeFile(name, contents); err != nil {
+		return err
+	}
+	if err := d.git(d.dir, "add", name); err != nil {
+		return err
+	}
+	return d.git(d.dir, "commit", "--quiet", "--message", message)
+}
@@ -0,0 +1,178 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// Diff prints the changes between two revisions of a review, computed locally
+// from the revisions' head commits. Revisions are given as rN or N; with one
+// revision the diff is against the latest revision, and with --latest it is
+// between the latest revision and the one before.
+func Diff(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+
+	reviewID := c.String("review")
+	if reviewID == "" {
+		reviewID, _, err = headReviewID(repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	revisions, err := loadRevisions(ctx, graphqlClient, reviewID)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return errors.Errorf("review %s has no revisions", reviewID)
+	}
+	latest := revisions[len(revisions)-1].Number
+
+	var from, to int
+	args := c.Args().Slice()
+	switch {
+	case c.Bool("latest") && len(args) == 0:
+		from, to = latest-1, latest
+	case !c.Bool("latest") && len(args) == 1:
+		from, err = parseRevisionNumber(args[0])
+		to = latest
+	case !c.Bool("latest") && len(args) == 2:
+		from, err = parseRevisionNumber(args[0])
+		if err == nil {
+			to, err = parseRevisionNumber(args[1])
+		}
+	default:
+		return errors.New("usage: plz diff [--review <id>] (--latest | <from> [<to>])")
+	}
+	if err != nil {
+		return err
+	}
+
+	fromRevision, err := findRevision(revisions, from)
+	if err != nil {
+		return err
+	}
+	toRevision, err := findRevision(revisions, to)
+	if err != nil {
+		return err
+	}
+	fromCommit, err := ensureCommit(ctx, repo, fromRevision.HeadCommitSHA)
+	if err != nil {
+		return err
+	}
+	toCommit, err := ensureCommit(ctx, repo, toRevision.HeadCommitSHA)
+	if err != nil {
+		return err
+	}
+	if fromRevision.BaseCommitSHA != toRevision.BaseCommitSHA {
+		deps.ErrorLog.Printf(
+			"warning: revisions %d and %d have different bases, the diff includes changes from the base",
+			from,
+			to,
+		)
+	}
+	patch, err := fromCommit.Patch(toCommit)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(patch.Encode(deps.InfoLog.Writer()))
+}
+
+// loadRevisions returns the revisions of a review in ascending order.
+func loadRevisions(ctx context.Context, graphqlClient *graphql.Client, reviewID string) ([]stack.Revision, error) {
+	var query struct {
+		Review struct {
+			RevisionList struct {
+				Revisions []stack.Revision `graphql:"revisions"`
+			} `graphql:"revisionList(options: {count: 100})"`
+		} `graphql:"review(id: $reviewId)"`
+	}
+	err := graphqlClient.Query(ctx, &query, map[string]interface{}{
+		"reviewId": graphql.ID(reviewID),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	revisions := query.Review.RevisionList.Revisions
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	return revisions, nil
+}
+
+func parseRevisionNumber(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(s), "r"))
+	if err != nil {
+		return 0, errors.Errorf("invalid revision %q, expected e.g. r3", s)
+	}
+	return n, nil
+}
+
+func findRevision(revisions []stack.Revision, number int) (*stack.Revision, error) {
+	for i := range revisions {
+		if revisions[i].Number == number {
+			return &revisions[i], nil
+		}
+	}
+	return nil, errors.Errorf("revision %d not found", number)
+}
+
+// ensureCommit returns the commit with the given SHA, fetching it from the
+// remote if it isn't available locally, e.g. because the review branch has
+// since been force-pushed. go-git can't fetch by SHA, so this shells out.
+func ensureCommit(ctx context.Context, repo *git.Repository, sha string) (*object.Commit, error) {
+	deps := deps.FromContext(ctx)
+	hash := plumbing.NewHash(sha)
+	commit, err := repo.CommitObject(hash)
+	if err == nil {
+		return commit, nil
+	} else if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, errors.WithStack(err)
+	}
+	deps.GitDebugLog.Println("fetching commit", sha)
+	fetchCtx, cancel := withPushTimeout(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(fetchCtx, "git", "fetch", "--quiet", git.DefaultRemoteName, sha)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if timeoutErr := pushTimeoutError(fetchCtx, "fetch of "+sha); timeoutErr != nil {
+		return nil, timeoutErr
+	}
+	if err != nil {
+		return nil, errors.Errorf("could not fetch commit %s: %s", sha, strings.TrimSpace(stderr.String()))
+	}
+	commit, err = repo.CommitObject(hash)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return commit, nil
+}
@@ -0,0 +1,190 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitcomplete/plz-cli/client/auth"
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// doctorCheck is the outcome of one of the checks run by plz doctor. fix says
+// what to do about a failed check.
+type doctorCheck struct {
+	name   string
+	ok     bool
+	detail string
+	fix    string
+}
+
+// Doctor checks that plz can work in the current environment and prints what
+// to do about anything that's wrong. Checks that depend on an earlier check
+// that failed are skipped.
+func Doctor(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	var checks []doctorCheck
+	pass := func(name, detail string) {
+		checks = append(checks, doctorCheck{name: name, ok: true, detail: detail})
+	}
+	fail := func(name, detail, fix string) {
+		checks = append(checks, doctorCheck{name: name, detail: detail, fix: fix})
+	}
+
+	if out, err := exec.CommandContext(ctx, "git", "--version").Output(); err != nil {
+		fail("git", "git not found", "install Git and make sure it's on your PATH")
+	} else {
+		pass("git", strings.TrimSpace(string(out)))
+	}
+
+	repo, repoErr := openGitRepo()
+	var owner, repoName string
+	if repoErr != nil {
+		fail("repository", "not in a Git repository", "run plz from inside a clone of a GitHub repository")
+	} else {
+		var err error
+		_, owner, repoName, err = parseRemote(repo)
+		if err != nil {
+			fail(
+				"remote",
+				fmt.Sprintf("%s is missing or isn't a GitHub URL: %v", git.DefaultRemoteName, err),
+				"git remote set-url "+git.DefaultRemoteName+" git@github.com:<owner>/<repo>.git",
+			)
+		} else {
+			pass("remote", fmt.Sprintf("%s is github.com/%s/%s", git.DefaultRemoteName, owner, repoName))
+		}
+		if order, err := remoteOrder(ctx, repo); err != nil {
+			fail("remotes", err.Error(), "fix plz.remotes with plz config remotes <names>")
+		} else if len(order) > 1 {
+			pass("remotes", "review branches are looked up in "+strings.Join(order, ", "))
+		}
+	}
+
+	if profile := deps.Auth.Profile(); profile != "" {
+		pass("profile", "using profile "+profile)
+	}
+	store := deps.Auth.Store()
+	if store == auth.StoreKeyring {
+		if err := auth.CheckKeyring(); err != nil {
+			fail("keyring", err.Error(), "run plz auth --store=file to store credentials in a file instead")
+		} else {
+			pass("keyring", "credentials are stored in the system keyring")
+		}
+	} else {
+		pass("keyring", "credentials are stored in a file, run plz auth --store=keyring to use the keyring")
+	}
+
+	httpClient := &http.Client{Transport: deps.Transport}
+	if resp, err := httpClient.Get(deps.PlzAPIBaseURL + "/clientid"); err != nil {
+		fail("plz API", err.Error(), "check your network connection and proxy settings")
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fail("plz API", deps.PlzAPIBaseURL+" returned "+resp.Status, "try again later")
+		} else {
+			pass("plz API", deps.PlzAPIBaseURL+" is reachable")
+		}
+	}
+
+	token, err := deps.Auth.Token()
+	if errors.Is(err, auth.ErrNoAuthCredentials) {
+		fail("auth", "not signed in or the sign-in expired", "run plz auth")
+	} else if err != nil {
+		fail("auth", err.Error(), "")
+	} else {
+		pass("auth", "token is valid or was refreshed")
+		gitHubClient := github.NewClient(&http.Client{
+			Transport: &authTransport{Token: token},
+		})
+		user, resp, err := gitHubClient.Users.Get(ctx, "")
+		if err != nil {
+			fail("GitHub", err.Error(), "check your network connection, or run plz auth if the token was revoked")
+		} else {
+			detail := "signed in as " + user.GetLogin()
+			scopes := resp.Header.Get("X-OAuth-Scopes")
+			if scopes == "" {
+				scopes = deps.Auth.Scope()
+			}
+			if scopes != "" {
+				detail += " with scopes " + scopes
+			}
+			pass("GitHub", detail)
+			if owner != "" {
+				checks = append(checks, checkDefaultBranch(ctx, gitHubClient, repo, owner, repoName))
+			}
+		}
+	}
+
+	numFailed := 0
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	for _, check := range checks {
+		status := "ok"
+		if !check.ok {
+			status = "FAIL"
+			numFailed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, check.name, check.detail)
+		if check.fix != "" {
+			fmt.Fprintf(w, "\t\tfix: %s\n", check.fix)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	if numFailed > 0 {
+		return errors.Errorf("%d of %d checks failed", numFailed, len(checks))
+	}
+	return nil
+}
+
+// checkDefaultBranch checks that the remote's HEAD symref names GitHub's
+// default branch and that the local copy of the default branch is current.
+func checkDefaultBranch(
+	ctx context.Context,
+	gitHubClient *github.Client,
+	repo *git.Repository,
+	owner string,
+	repoName string,
+) doctorCheck {
+	check := doctorCheck{name: "default branch"}
+	ghRepo, _, err := gitHubClient.Repositories.Get(ctx, owner, repoName)
+	if err != nil {
+		check.detail = err.Error()
+		check.fix = "make sure you have access to github.com/" + owner + "/" + repoName
+		return check
+	}
+	defaultBranch := ghRepo.GetDefaultBranch()
+	if local := remoteDefaultBranch(repo); local != defaultBranch {
+		if local == "" {
+			check.detail = git.DefaultRemoteName + "/HEAD isn't set, so plz asks GitHub every time"
+		} else {
+			check.detail = git.DefaultRemoteName + "/HEAD is " + local + " but GitHub's default branch is " + defaultBranch
+		}
+		check.fix = "git remote set-head " + git.DefaultRemoteName + " --auto"
+		return check
+	}
+	branch, _, err := gitHubClient.Repositories.GetBranch(ctx, owner, repoName, defaultBranch)
+	if err != nil {
+		check.detail = err.Error()
+		return check
+	}
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, defaultBranch), true)
+	if err != nil || ref.Hash().String() != branch.GetCommit().GetSHA() {
+		check.detail = git.DefaultRemoteName + "/" + defaultBranch + " is out of date"
+		check.fix = "git fetch " + git.DefaultRemoteName
+		return check
+	}
+	check.ok = true
+	check.detail = git.DefaultRemoteName + "/" + defaultBranch + " is up to date"
+	return check
+}
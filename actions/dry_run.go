@@ -0,0 +1,146 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// printReviewPlan prints what plz review would do for the given reviews to w
+// without changing the local repo, the remote or any PRs.
+func printReviewPlan(
+	ctx context.Context,
+	w io.Writer,
+	gitHubRepo *gitHubRepo,
+	ris []*reviewInfo,
+	opts *prOptions,
+) error {
+	deps := deps.FromContext(ctx)
+	repo := gitHubRepo.GitRepo()
+	style, err := reviewTrailerStyle(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Work out which commits would be rewritten. Once a commit is rewritten,
+	// every commit above it has to be rewritten too since its parent changes.
+	plans := make([][]string, len(ris))
+	parentHash := ris[0].Commit.ParentHashes[0]
+	rewritten := false
+	for i, ri := range ris {
+		var steps []string
+		switch {
+		case ri.pr == nil:
+			steps = append(steps, "rewrite commit to add "+describeReviewTrailers(style))
+			rewritten = true
+		case rewritten || parentHash != ri.Commit.ParentHashes[0]:
+			steps = append(steps, "rewrite commit onto new parent")
+			rewritten = true
+		}
+		if deps.Config.GetBool("attest", false) {
+			if _, _, ok, _ := attestationFromCommitMessage(ri.Commit.Message); rewritten || !ok {
+				steps = append(steps, "sign attestation")
+				rewritten = true
+			}
+		}
+
+		pushed := rewritten
+		if !pushed {
+			remoteRefName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ri.headBranch)
+			remoteRef, err := repo.Reference(remoteRefName, true)
+			pushed = err != nil || remoteRef.Hash() != ri.Commit.Hash
+		}
+		if pushed {
+			steps = append(steps, "force-push branch "+ri.headBranch)
+		}
+
+		title, body := prTitleAndBody(ri, opts)
+		if ri.pr == nil {
+			kind := "PR"
+			if opts.draft {
+				kind = "draft PR"
+			}
+			steps = append(steps, fmt.Sprintf("create %s %s -> %s", kind, ri.headBranch, ri.baseBranch))
+		} else {
+			var changes []string
+			if ri.pr.Base.GetRef() != ri.baseBranch {
+				changes = append(changes, fmt.Sprintf("base %s -> %s", ri.pr.Base.GetRef(), ri.baseBranch))
+			}
+			if ri.pr.GetTitle() != title {
+				changes = append(changes, "title")
+			}
+			if ri.pr.GetBody() != body {
+				changes = append(changes, "body")
+			}
+			if len(changes) > 0 {
+				steps = append(steps, fmt.Sprintf(
+					"edit PR #%d (%s)",
+					ri.pr.GetNumber(),
+					strings.Join(changes, ", "),
+				))
+			}
+		}
+		if reviewers := reviewersToRequest(ri, opts.reviewers); len(reviewers) > 0 {
+			steps = append(steps, "request reviewers "+strings.Join(reviewers, ", "))
+		}
+		if reviewers := reviewersToRemove(ri, opts.removeReviewers); len(reviewers) > 0 {
+			steps = append(steps, "remove reviewers "+strings.Join(reviewers, ", "))
+		}
+		toAdd, toRemove := labelChanges(ctx, gitHubRepo, ri, opts)
+		if len(toAdd) > 0 {
+			steps = append(steps, "add labels "+strings.Join(toAdd, ", "))
+		}
+		if len(toRemove) > 0 {
+			steps = append(steps, "remove labels "+strings.Join(toRemove, ", "))
+		}
+		if assignees := assigneesToAdd(ri, opts.assignees); len(assignees) > 0 {
+			steps = append(steps, "assign "+strings.Join(assignees, ", "))
+		}
+		if needsMilestone(ri, opts.milestone) {
+			steps = append(steps, "set milestone "+opts.milestone.GetTitle())
+		}
+		if opts.autoMerge != "" {
+			steps = append(steps, "enable auto-merge ("+strings.ToLower(opts.autoMerge)+")")
+		}
+		plans[i] = steps
+		parentHash = ri.Commit.Hash
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for i := len(ris) - 1; i >= 0; i-- {
+		ri := ris[i]
+		parts := strings.SplitN(ri.Commit.Message, "\n", 2)
+		title := strings.TrimSpace(parts[0])
+		if len(title) > 47 {
+			title = title[:47] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", ri.Commit.Hash.String()[:8], title)
+		if len(plans[i]) == 0 {
+			fmt.Fprintf(tw, "\tunchanged\n")
+		}
+		for _, step := range plans[i] {
+			fmt.Fprintf(tw, "\t%s\n", step)
+		}
+	}
+	return tw.Flush()
+}
+
+// describeReviewTrailers names the trailers that plz review adds to commits
+// in the given style, one of the stack.ReviewTrailer constants.
+func describeReviewTrailers(style string) string {
+	switch style {
+	case stack.ReviewTrailerChangeID:
+		return "Change-Id trailer"
+	case stack.ReviewTrailerBoth:
+		return "plz-review-url and Change-Id trailers"
+	default:
+		return "plz-review-url trailer"
+	}
+}
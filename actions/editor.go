@@ -0,0 +1,94 @@
+package actions
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// scissorsLine separates the text to edit from instructions in editTextAbove,
+// like git commit --cleanup=scissors.
+const scissorsLine = "# ------------------------ >8 ------------------------"
+
+// editText opens the user's editor on the given text and returns the result
+// with lines starting with # removed, like git commit does.
+func editText(text string) (string, error) {
+	edited, err := runEditor(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	s := bufio.NewScanner(strings.NewReader(edited))
+	for s.Scan() {
+		if !strings.HasPrefix(s.Text(), "#") {
+			b.WriteString(s.Text())
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// editTextAbove opens the user's editor on the given text followed by the
+// instructions, commented out below a scissors line, and returns what's above
+// the scissors line. Unlike editText, lines starting with # are kept, e.g. for
+// Markdown headings.
+func editTextAbove(text string, instructions string) (string, error) {
+	var b strings.Builder
+	b.WriteString(text)
+	b.WriteString("\n\n" + scissorsLine + "\n")
+	b.WriteString("# Do not modify or remove the line above.\n# Everything below it will be ignored.\n")
+	for _, line := range strings.Split(instructions, "\n") {
+		b.WriteString("# " + line + "\n")
+	}
+	edited, err := runEditor(b.String())
+	if err != nil {
+		return "", err
+	}
+	if i := strings.Index(edited, scissorsLine+"\n"); i >= 0 {
+		edited = edited[:i]
+	}
+	return strings.TrimSpace(edited), nil
+}
+
+// runEditor opens the user's editor on the given text and returns the result.
+// The editor is chosen the same way Git chooses it, falling back to vi.
+func runEditor(text string) (string, error) {
+	editor := os.Getenv("GIT_EDITOR")
+	if editor == "" {
+		out, err := exec.Command("git", "var", "GIT_EDITOR").Output()
+		if err == nil {
+			editor = strings.TrimSpace(string(out))
+		}
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := os.CreateTemp("", "PLZ_EDITMSG-*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	// Run the editor through the shell since it may include arguments.
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, "editor failed")
+	}
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(edited), nil
+}
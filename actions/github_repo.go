@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/gitrepo"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -19,24 +22,27 @@ type gitHubRepo struct {
 	gitHubClient     *github.Client
 	gitRepo          *git.Repository
 	gitAuth          transport.AuthMethod
-	gitHubRepo       *github.Repository
+	owner            string
+	name             string
+	defaultBranch    string
 	defaultBranchRef *plumbing.Reference
+	// gitHubRepo is only fetched when needed, see Repository.
+	gitHubRepo *github.Repository
 }
 
 func newGitHubRepo(ctx context.Context, authToken string) (*gitHubRepo, error) {
+	deps := deps.FromContext(ctx)
+
 	// Initialize clients and Git repo.
 	httpClient := &http.Client{
 		Transport: &authTransport{Token: authToken},
 	}
 	gitHubClient := github.NewClient(httpClient)
-	gitRepo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{
-		DetectDotGit: true,
-	})
+	gitRepo, err := openGitRepo()
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 
-	// Get the default branch from the GitHub repo
 	proto, owner, repoName, err := parseRemote(gitRepo)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -45,26 +51,36 @@ func newGitHubRepo(ctx context.Context, authToken string) (*gitHubRepo, error) {
 	if proto == "https" {
 		gitAuth = &gitHTTP.BasicAuth{Username: authToken}
 	}
-	ghRepo, _, err := gitHubClient.Repositories.Get(ctx, owner, repoName)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	r := &gitHubRepo{
+		gitHubClient: gitHubClient,
+		gitRepo:      gitRepo,
+		gitAuth:      gitAuth,
+		owner:        owner,
+		name:         repoName,
+	}
+
+	// Prefer the remote's HEAD symref for the default branch, and only ask
+	// GitHub if it's missing, e.g. in clones made with git init and git fetch.
+	r.defaultBranch = remoteDefaultBranch(gitRepo)
+	if r.defaultBranch == "" {
+		ghRepo, err := r.Repository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.defaultBranch = ghRepo.GetDefaultBranch()
+		deps.GitDebugLog.Println("default branch from GitHub is", r.defaultBranch)
+	} else {
+		deps.GitDebugLog.Println("default branch from remote HEAD is", r.defaultBranch)
 	}
 	defaultBranchRefName := plumbing.NewRemoteReferenceName(
 		git.DefaultRemoteName,
-		ghRepo.GetDefaultBranch(),
+		r.defaultBranch,
 	)
-	defaultBranchRef, err := gitRepo.Reference(defaultBranchRefName, true)
+	r.defaultBranchRef, err = gitRepo.Reference(defaultBranchRefName, true)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-
-	return &gitHubRepo{
-		gitHubClient:     gitHubClient,
-		gitRepo:          gitRepo,
-		gitAuth:          gitAuth,
-		gitHubRepo:       ghRepo,
-		defaultBranchRef: defaultBranchRef,
-	}, nil
+	return r, nil
 }
 
 func (r *gitHubRepo) Client() *github.Client {
@@ -80,29 +96,122 @@ func (r *gitHubRepo) GitAuth() transport.AuthMethod {
 }
 
 func (r *gitHubRepo) Owner() string {
-	return r.gitHubRepo.Owner.GetLogin()
+	return r.owner
 }
 
 func (r *gitHubRepo) Name() string {
-	return r.gitHubRepo.GetName()
+	return r.name
+}
+
+// Repository fetches the repo's details from GitHub, the first time it is
+// called.
+func (r *gitHubRepo) Repository(ctx context.Context) (*github.Repository, error) {
+	if r.gitHubRepo == nil {
+		ghRepo, _, err := r.gitHubClient.Repositories.Get(ctx, r.owner, r.name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r.gitHubRepo = ghRepo
+	}
+	return r.gitHubRepo, nil
 }
 
 func (r *gitHubRepo) DefaultBranch() string {
-	return r.gitHubRepo.GetDefaultBranch()
+	return r.defaultBranch
 }
 
 func (r *gitHubRepo) DefaultBranchRef() *plumbing.Reference {
 	return r.defaultBranchRef
 }
 
+// openGitRepo opens the local Git repository containing the current directory,
+// see gitrepo.Open.
+func openGitRepo() (*git.Repository, error) {
+	return gitrepo.Open()
+}
+
+// remoteDefaultBranch returns the default branch according to the remote's
+// HEAD symref, i.e. refs/remotes/origin/HEAD, without making any network
+// requests. It returns an empty string if the symref isn't present.
+func remoteDefaultBranch(gitRepo *git.Repository) string {
+	headRefName := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	ref, err := gitRepo.Reference(headRefName, false)
+	if err != nil || ref.Type() != plumbing.SymbolicReference {
+		return ""
+	}
+	prefix := fmt.Sprintf("refs/remotes/%s/", git.DefaultRemoteName)
+	return strings.TrimPrefix(ref.Target().String(), prefix)
+}
+
+// localDefaultBranch returns the default branch for commands that otherwise
+// work offline, only asking GitHub if remoteDefaultBranch can't tell.
+func localDefaultBranch(ctx context.Context, gitRepo *git.Repository) (string, error) {
+	if defaultBranch := remoteDefaultBranch(gitRepo); defaultBranch != "" {
+		return defaultBranch, nil
+	}
+	token, err := deps.FromContext(ctx).Auth.Token()
+	if err != nil {
+		return "", err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return gitHubRepo.DefaultBranch(), nil
+}
+
+// authTransport authenticates requests with a token and sends them with the
+// Transport from the request context's Deps.
 type authTransport struct {
-	http.Transport
 	Token string
 }
 
 func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	r.Header.Add("Authorization", "token "+t.Token)
-	return t.Transport.RoundTrip(r)
+	// GraphQL requests are all POSTs to a single endpoint, so they're logged
+	// separately from REST API requests.
+	deps := deps.FromContext(r.Context())
+	debugLog := deps.APIDebugLog
+	isPlzAPI := r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/api/v1")
+	if r.Method == http.MethodPost && (strings.HasSuffix(r.URL.Path, "/graphql") || isPlzAPI) {
+		debugLog = deps.GraphQLDebugLog
+	}
+	start := time.Now()
+	resp, err := deps.Transport.RoundTrip(r)
+	if debugLog != nil {
+		if err != nil {
+			debugLog.Printf("%s %s failed after %v: %v", r.Method, r.URL, time.Since(start), err)
+		} else {
+			debugLog.Printf("%s %s %s in %v", r.Method, r.URL, resp.Status, time.Since(start))
+		}
+	}
+	if err == nil && isPlzAPI {
+		return rewriteGraphQLErrors(r.Context(), resp)
+	}
+	return resp, err
+}
+
+// withPushTimeout returns a context for pushing or fetching, which is canceled
+// after plz.pushTimeout.
+func withPushTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := deps.FromContext(ctx).PushTimeout
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// pushTimeoutError returns a clearer error than the one from the push or
+// fetch that used ctx if it timed out, and otherwise nil.
+func pushTimeoutError(ctx context.Context, what string) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	return errors.Errorf(
+		"%s timed out after %v, set plz.pushTimeout to allow more time",
+		what,
+		deps.FromContext(ctx).PushTimeout,
+	)
 }
 
 func parseRemote(repo *git.Repository) (string, string, string, error) {
@@ -0,0 +1,146 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+)
+
+// Error codes that the plz API puts in the extensions of GraphQL errors.
+const (
+	graphQLCodeUnauthenticated = "UNAUTHENTICATED"
+	graphQLCodeForbidden       = "FORBIDDEN"
+	graphQLCodeNotFound        = "NOT_FOUND"
+	graphQLCodeBadUserInput    = "BAD_USER_INPUT"
+	graphQLCodeRateLimited     = "RATE_LIMITED"
+	graphQLCodeInternal        = "INTERNAL_SERVER_ERROR"
+)
+
+// graphQLError is an error in a response from the plz API, with the
+// extensions that the GraphQL client ignores.
+type graphQLError struct {
+	Message string `json:"message"`
+	// Path is the field that the error is for, e.g. ["review", "revisions"].
+	Path       []interface{} `json:"path"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+// field returns the path of the field that the error is for, e.g.
+// review.revisions, or an empty string if it isn't for a field.
+func (e *graphQLError) field() string {
+	parts := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		parts[i] = fmt.Sprint(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// plzServerName returns the name of the plz server to show in messages, e.g.
+// plz.review for https://api.plz.review.
+func plzServerName(plzAPIBaseURL string) string {
+	u, err := url.Parse(plzAPIBaseURL)
+	if err != nil || u.Hostname() == "" {
+		return plzAPIBaseURL
+	}
+	return strings.TrimPrefix(u.Hostname(), "api.")
+}
+
+// friendlyMessage turns the error into something the user can act on, based
+// on its code. server is the name of the plz server, see plzServerName.
+func (e *graphQLError) friendlyMessage(server string) string {
+	// The path is the field in the query, e.g. review, which makes a
+	// reasonable name for what's missing or inaccessible.
+	what := "it"
+	if len(e.Path) > 0 {
+		if s, ok := e.Path[0].(string); ok {
+			what = s
+		}
+	}
+	switch e.Extensions.Code {
+	case graphQLCodeUnauthenticated:
+		return server + " didn't accept your credentials, run plz auth to sign in again"
+	case graphQLCodeForbidden:
+		return fmt.Sprintf(
+			"no access to %s, check that the %s GitHub app is installed on the repository and that you're signed in as the right user with plz auth",
+			what,
+			server,
+		)
+	case graphQLCodeNotFound:
+		if what == "it" {
+			return e.Message
+		}
+		return what + " not found"
+	case graphQLCodeRateLimited:
+		return server + " is limiting the rate of requests, try again in a minute"
+	case graphQLCodeInternal:
+		return server + " had an internal error, try again later, or run with --debug=graphql for details"
+	case graphQLCodeBadUserInput:
+		if field := e.field(); field != "" {
+			return fmt.Sprintf("invalid %s: %s", field, e.Message)
+		}
+	}
+	return e.Message
+}
+
+// rewriteGraphQLErrors replaces the messages of any errors in a response
+// from the plz API with friendly ones, since the GraphQL client only returns
+// the message of the first error. The codes and field paths are logged to
+// the GraphQLDebugLog.
+func rewriteGraphQLErrors(ctx context.Context, resp *http.Response) (*http.Response, error) {
+	deps := deps.FromContext(ctx)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(body, &out); err != nil || len(out["errors"]) == 0 {
+		// Leave it for the GraphQL client to report.
+		return resp, nil
+	}
+	var gqlErrors []graphQLError
+	var rawErrors []map[string]interface{}
+	if json.Unmarshal(out["errors"], &gqlErrors) != nil || json.Unmarshal(out["errors"], &rawErrors) != nil {
+		return resp, nil
+	}
+	if len(gqlErrors) == 0 {
+		return resp, nil
+	}
+	server := plzServerName(deps.PlzAPIBaseURL)
+	var messages []string
+	seen := map[string]bool{}
+	for i := range gqlErrors {
+		e := &gqlErrors[i]
+		deps.GraphQLDebugLog.Printf("error %q, code %q, path %q", e.Message, e.Extensions.Code, e.field())
+		message := e.friendlyMessage(server)
+		rawErrors[i]["message"] = message
+		if !seen[message] {
+			seen[message] = true
+			messages = append(messages, message)
+		}
+	}
+	rawErrors[0]["message"] = strings.Join(messages, "; ")
+	if out["errors"], err = json.Marshal(rawErrors); err != nil {
+		return resp, nil
+	}
+	if body, err = json.Marshal(out); err != nil {
+		return resp, nil
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
@@ -0,0 +1,154 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// Handoff transfers the open reviews in the current stack to another GitHub
+// user, e.g. before going on vacation, and prints instructions for the
+// recipient to pick up the stack.
+func Handoff(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	if c.NArg() != 1 {
+		return errors.New("usage: plz handoff <github-user>")
+	}
+	recipient := c.Args().First()
+	if !reviewerUsernameRegex.MatchString(recipient) {
+		return errors.Errorf("invalid GitHub username: %q", recipient)
+	}
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+
+	recipientUser, resp, err := gitHubRepo.Client().Users.Get(ctx, recipient)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return errors.Errorf("GitHub user %q not found", recipient)
+		}
+		return errors.WithStack(err)
+	}
+	recipient = recipientUser.GetLogin()
+
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	if err != nil {
+		return err
+	}
+
+	var handedOff []stack.CommitInfo
+	for _, ci := range s {
+		if ci.Review == nil {
+			if len(handedOff) == 0 {
+				deps.ErrorLog.Printf(
+					"warning: commit %s hasn't been published and won't be handed off",
+					ci.Commit.Hash.String()[:8],
+				)
+			}
+			continue
+		}
+		if ci.Review.Status != stack.ReviewStatusOpen {
+			continue
+		}
+		if ci.Status() != stack.CommitStatusCurrent {
+			deps.ErrorLog.Printf(
+				"warning: review %s has local changes that haven't been published and won't be handed off",
+				ci.Review.ID,
+			)
+		}
+		handedOff = append(handedOff, ci)
+	}
+	if len(handedOff) == 0 {
+		return errors.New("no open reviews to hand off")
+	}
+
+	for _, ci := range handedOff {
+		deps.GraphQLDebugLog.Println("transferring review", ci.Review.ID, "to", recipient)
+		var mutation struct {
+			TransferReview struct {
+				ID string `graphql:"id"`
+			} `graphql:"transferReview(reviewID: $reviewID, author: $author)"`
+		}
+		err := graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+			"reviewID": graphql.ID(ci.Review.ID),
+			"author":   graphql.String(recipient),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = reassignPR(ctx, gitHubRepo, ci.GitHubPR, recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The stack is listed from the top down, so the first review's branch
+	// contains the whole stack.
+	top := handedOff[0].Review
+	var b strings.Builder
+	fmt.Fprintf(&b, "handed off %d reviews to %s, who can pick up the stack with:\n\n", len(handedOff), recipient)
+	fmt.Fprintf(&b, "    git fetch %s %s\n", git.DefaultRemoteName, top.HeadBranch)
+	fmt.Fprintf(&b, "    git checkout -b <branch> FETCH_HEAD\n")
+	fmt.Fprintf(&b, "    plz status\n")
+	deps.InfoLog.Print(b.String())
+	return nil
+}
+
+// reassignPR makes the recipient the only assignee of the given PR.
+func reassignPR(ctx context.Context, gitHubRepo *gitHubRepo, prNumber int, recipient string) error {
+	client := gitHubRepo.Client()
+	issue, _, err := client.Issues.Get(ctx, gitHubRepo.Owner(), gitHubRepo.Name(), prNumber)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var toRemove []string
+	hasRecipient := false
+	for _, assignee := range issue.Assignees {
+		if strings.EqualFold(assignee.GetLogin(), recipient) {
+			hasRecipient = true
+		} else {
+			toRemove = append(toRemove, assignee.GetLogin())
+		}
+	}
+	if len(toRemove) > 0 {
+		_, _, err := client.Issues.RemoveAssignees(ctx, gitHubRepo.Owner(), gitHubRepo.Name(), prNumber, toRemove)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if !hasRecipient {
+		_, _, err := client.Issues.AddAssignees(ctx, gitHubRepo.Owner(), gitHubRepo.Name(), prNumber, []string{recipient})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// commitMsgHookMarker identifies commit-msg hooks installed by plz init-hooks,
+// which may be overwritten.
+const commitMsgHookMarker = "# Installed by plz init-hooks."
+
+// InitHooks installs a commit-msg hook that runs plz hook commit-msg, with the
+// current profile and plz server.
+func InitHooks(c *cli.Context) error {
+	deps := deps.FromContext(c.Context)
+
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks/commit-msg").Output()
+	if err != nil {
+		return errors.New("cannot find the hooks directory, run plz init-hooks in a Git repository")
+	}
+	path, err := filepath.Abs(strings.TrimSpace(string(out)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if existing, err := os.ReadFile(path); err == nil {
+		if !bytes.Contains(existing, []byte(commitMsgHookMarker)) && !c.Bool("force") {
+			return errors.Errorf("%s already exists, use --force to replace it", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	// The hook runs with whatever profile and plz server are configured when
+	// committing, so pin the ones in use now, which any reserved review IDs
+	// have to come from.
+	args := []string{"plz", "--plz-api-base-url", deps.PlzAPIBaseURL}
+	if profile := deps.Auth.Profile(); profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	args = append(args, "hook", "commit-msg")
+	if c.Bool("reserve") {
+		args = append(args, "--reserve")
+	}
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	script := "#!/bin/sh\n" + commitMsgHookMarker + "\nexec " + strings.Join(args, " ") + ` "$1"` + "\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	// WriteFile doesn't change the mode of an existing file.
+	if err := os.Chmod(path, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	deps.InfoLog.Println("installed commit-msg hook in", path)
+	return nil
+}
+
+// CommitMsgHook checks the review trailers of a commit message being
+// committed, as the commit-msg hook installed by plz init-hooks. It warns
+// about messages with several review trailers, and about messages without one
+// that appear to be amending a published commit. With --reserve, messages
+// without a review trailer get one with a newly reserved review ID, so that
+// plz review doesn't have to rewrite the commit to add it.
+func CommitMsgHook(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	path := c.Args().First()
+	if path == "" {
+		return errors.New("usage: plz hook commit-msg <message file>")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	message := string(b)
+
+	reviewIDs := stack.ReviewIDsFromCommitMessage(message)
+	if len(reviewIDs) > 1 {
+		deps.ErrorLog.Printf(
+			"warning: commit message has trailers for reviews %s; plz review will treat it as review %s",
+			strings.Join(reviewIDs, ", "),
+			reviewIDs[0],
+		)
+		return nil
+	}
+	if len(reviewIDs) == 1 {
+		return nil
+	}
+
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	if headRef, err := repo.Head(); err == nil {
+		headCommit, err := repo.CommitObject(headRef.Hash())
+		if err == nil && commitTitle(headCommit.Message) == commitTitle(message) {
+			if reviewID := stack.ReviewIDFromCommitMessage(headCommit.Message); reviewID != "" {
+				deps.ErrorLog.Printf(
+					"warning: commit message has no review trailer but HEAD belongs to review %s; "+
+						"if you're amending it, plz review will publish it as a new review",
+					reviewID,
+				)
+			}
+		}
+	}
+	if !c.Bool("reserve") {
+		return nil
+	}
+	// Failing the hook would abort the commit, so failing to reserve an ID,
+	// e.g. while offline, is only a warning. plz review adds one later.
+	if err := addReservedTrailer(ctx, path); err != nil {
+		deps.ErrorLog.Printf("warning: failed to reserve a review ID: %v", err)
+	}
+	return nil
+}
+
+// addReservedTrailer reserves a review ID and adds trailers for it to the
+// commit message in the given file. Unlike the IDs that plz review reserves,
+// it isn't recorded for release if unused, since the commit may be published
+// from any branch at any time.
+func addReservedTrailer(ctx context.Context, path string) error {
+	deps := deps.FromContext(ctx)
+
+	style, err := reviewTrailerStyle(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+	var mutation struct {
+		ReserveReviewIDs []string `graphql:"reserveReviewIDs(count: $count)"`
+	}
+	err = graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"count": graphql.Int(1),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(mutation.ReserveReviewIDs) != 1 {
+		return errors.New("failed to reserve a review ID")
+	}
+	reviewID := mutation.ReserveReviewIDs[0]
+	// git interpret-trailers knows where the message ends, e.g. before the
+	// diff of git commit --verbose, which is removed after this hook runs.
+	args := []string{"interpret-trailers", "--in-place"}
+	for _, trailer := range strings.Split(stack.ReviewTrailers(reviewID, style), "\n") {
+		args = append(args, "--trailer", trailer)
+	}
+	return runGit(ctx, append(args, path)...)
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// isReservedReviewID reports whether the review ID, found in the trailer of an
+// unpublished commit, is a review that has been reserved on the plz server in
+// use but not published yet. Trailers may come from anywhere, e.g. a commit
+// cherry-picked from someone else's stack, or a hook installed for another
+// server, so they're only trusted once checked.
+func isReservedReviewID(ctx context.Context, graphqlClient *graphql.Client, reviewID string) bool {
+	deps := deps.FromContext(ctx)
+	var query struct {
+		Review *struct {
+			ID       string `graphql:"id"`
+			GitHubPR int    `graphql:"gitHubPR"`
+		} `graphql:"review(id: $reviewId)"`
+	}
+	err := graphqlClient.Query(ctx, &query, map[string]interface{}{
+		"reviewId": graphql.ID(reviewID),
+	})
+	if err != nil {
+		deps.GraphQLDebugLog.Printf("failed to look up review %s: %v", reviewID, err)
+		return false
+	}
+	return query.Review != nil && query.Review.ID == reviewID && query.Review.GitHubPR == 0
+}
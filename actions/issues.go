@@ -0,0 +1,106 @@
+package actions
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/config"
+	"github.com/pkg/errors"
+)
+
+// issueTrailerRegex matches plz-issue trailers, which list the issues a commit
+// is for, overriding plz.issuePattern. plz-issue: none links no issues.
+var issueTrailerRegex = regexp.MustCompile(`^\s*((?i)plz-issue)\s*:\s*(.*?)\s*$`)
+
+// issueLinker adds links to the issues that a commit is for to PR bodies,
+// configured by plz.issuePattern, plz.issueURL and plz.issueKeyword.
+type issueLinker struct {
+	// pattern finds issue keys in commit messages, or is nil to only use
+	// plz-issue trailers.
+	pattern *regexp.Regexp
+	// url is the URL of an issue with {key} in place of its key, or empty to
+	// not link keys.
+	url string
+	// keyword goes before each issue, e.g. Closes.
+	keyword string
+}
+
+// loadIssueLinker returns the issueLinker configured in cfg.
+func loadIssueLinker(cfg *config.Config) (*issueLinker, error) {
+	l := &issueLinker{
+		url:     cfg.Get("issueURL"),
+		keyword: cfg.Get("issueKeyword"),
+	}
+	if pattern := cfg.Get("issuePattern"); pattern != "" {
+		var err error
+		if l.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrapf(err, "invalid plz.issuePattern %q", pattern)
+		}
+	}
+	return l, nil
+}
+
+// keys returns the issue keys of a commit message, from its plz-issue trailers
+// if it has any, and otherwise found with the pattern.
+func (l *issueLinker) keys(message string) []string {
+	var keys, trailerKeys []string
+	hasTrailer := false
+	var text strings.Builder
+	s := bufio.NewScanner(strings.NewReader(message))
+	for s.Scan() {
+		matches := issueTrailerRegex.FindStringSubmatch(s.Text())
+		if matches == nil {
+			text.WriteString(s.Text() + "\n")
+			continue
+		}
+		hasTrailer = true
+		for _, key := range strings.FieldsFunc(matches[2], func(r rune) bool {
+			return r == ',' || r == ' '
+		}) {
+			if !strings.EqualFold(key, "none") {
+				trailerKeys = append(trailerKeys, key)
+			}
+		}
+	}
+	if hasTrailer {
+		keys = trailerKeys
+	} else if l.pattern != nil {
+		keys = l.pattern.FindAllString(text.String(), -1)
+	}
+	var unique []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// apply adds a line for each issue of the commit message to body, unless body
+// already has it. l may be nil to leave body unchanged.
+func (l *issueLinker) apply(body string, message string) string {
+	if l == nil {
+		return body
+	}
+	var lines []string
+	for _, key := range l.keys(message) {
+		ref := key
+		if l.url != "" {
+			ref = "[" + key + "](" + strings.ReplaceAll(l.url, "{key}", key) + ")"
+		}
+		line := strings.TrimSpace(l.keyword + " " + ref)
+		if !strings.Contains(body, line) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return body
+	}
+	if body == "" {
+		return strings.Join(lines, "\n")
+	}
+	return body + "\n\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+var labelsTrailerRegex = regexp.MustCompile(
+	`^\s*((?i)plz-labels)\s*:\s*(.*)$`,
+)
+
+// labelsFromCommitMessage returns the labels listed in plz-labels trailers in
+// the given commit message. Labels are comma separated, e.g.
+// "plz-labels: bug, needs-docs".
+func labelsFromCommitMessage(message string) []string {
+	var labels []string
+	s := bufio.NewScanner(strings.NewReader(message))
+	for s.Scan() {
+		matches := labelsTrailerRegex.FindStringSubmatch(s.Text())
+		if matches == nil {
+			continue
+		}
+		for _, label := range strings.Split(matches[2], ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = appendLabel(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// reviewLabels returns the labels that the review's PR should have, from the
+// --label flag and the commit's plz-labels trailers.
+func reviewLabels(ri *reviewInfo, opts *prOptions) []string {
+	var labels []string
+	for _, label := range opts.labels {
+		labels = appendLabel(labels, label)
+	}
+	for _, label := range labelsFromCommitMessage(ri.Commit.Message) {
+		labels = appendLabel(labels, label)
+	}
+	return labels
+}
+
+// labelChanges returns the labels to add to and remove from the review's PR.
+// Labels are only removed if they were listed in the trailer of the previously
+// published commit and no longer are, so that labels added on GitHub or with
+// --label are left alone.
+func labelChanges(ctx context.Context, gitHubRepo *gitHubRepo, ri *reviewInfo, opts *prOptions) ([]string, []string) {
+	deps := deps.FromContext(ctx)
+	want := reviewLabels(ri, opts)
+	if ri.pr == nil {
+		return want, nil
+	}
+	var toAdd, toRemove []string
+	for _, label := range want {
+		if !prHasLabel(ri, label) {
+			toAdd = append(toAdd, label)
+		}
+	}
+	prevCommit, err := gitHubRepo.GitRepo().CommitObject(plumbing.NewHash(ri.pr.GetHead().GetSHA()))
+	if err != nil {
+		deps.GitDebugLog.Println("previous commit unavailable, not removing labels:", err)
+		return toAdd, nil
+	}
+	for _, label := range labelsFromCommitMessage(prevCommit.Message) {
+		if !containsLabel(want, label) && prHasLabel(ri, label) {
+			toRemove = append(toRemove, label)
+		}
+	}
+	return toAdd, toRemove
+}
+
+// syncLabels applies the review's labels to its PR, returning whether the PR
+// was updated.
+func syncLabels(ctx context.Context, gitHubRepo *gitHubRepo, ri *reviewInfo, opts *prOptions) (bool, error) {
+	deps := deps.FromContext(ctx)
+	client := gitHubRepo.Client()
+	toAdd, toRemove := labelChanges(ctx, gitHubRepo, ri, opts)
+	if len(toAdd) > 0 {
+		deps.APIDebugLog.Println("adding labels", toAdd, "to PR", ri.prNumber())
+		_, _, err := client.Issues.AddLabelsToIssue(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			ri.prNumber(),
+			toAdd,
+		)
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+	}
+	for _, label := range toRemove {
+		deps.APIDebugLog.Println("removing label", label, "from PR", ri.prNumber())
+		_, err := client.Issues.RemoveLabelForIssue(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			ri.prNumber(),
+			label,
+		)
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+	}
+	return len(toAdd) > 0 || len(toRemove) > 0, nil
+}
+
+func prHasLabel(ri *reviewInfo, label string) bool {
+	for _, l := range ri.pr.Labels {
+		if strings.EqualFold(l.GetName(), label) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendLabel(labels []string, label string) []string {
+	if containsLabel(labels, label) {
+		return labels
+	}
+	return append(labels, label)
+}
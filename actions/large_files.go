@@ -0,0 +1,140 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultLargeFileWarning is the default size above which plz review warns
+	// about files added by a review.
+	defaultLargeFileWarning = 10 << 20
+	// defaultLargeFileLimit is the default size above which plz review refuses
+	// to publish a review. This matches GitHub's own file size limit.
+	defaultLargeFileLimit = 100 << 20
+)
+
+type largeFile struct {
+	commit *object.Commit
+	path   string
+	size   int64
+}
+
+// checkLargeFiles warns about files added or modified by the given reviews
+// that are larger than plz.largeFileWarning, and fails if any are larger than
+// plz.largeFileLimit unless force is set. Reviews whose tree hasn't changed
+// since their latest revision are skipped.
+func checkLargeFiles(ctx context.Context, repo *git.Repository, ris []*reviewInfo, force bool) error {
+	deps := deps.FromContext(ctx)
+	warning := deps.Config.GetBytes("largeFileWarning", defaultLargeFileWarning)
+	limit := deps.Config.GetBytes("largeFileLimit", defaultLargeFileLimit)
+	var tooLarge []largeFile
+	for _, ri := range ris {
+		if ri.treeUnchanged(repo) {
+			continue
+		}
+		files, err := findLargeFiles(ri.Commit, warning)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			deps.ErrorLog.Printf(
+				"warning: %s adds large file %s (%s), consider tracking it with Git LFS",
+				f.commit.Hash.String()[:8],
+				f.path,
+				formatSize(f.size),
+			)
+			if limit > 0 && f.size > limit {
+				tooLarge = append(tooLarge, f)
+			}
+		}
+	}
+	if len(tooLarge) > 0 && !force {
+		f := tooLarge[0]
+		return errors.Errorf(
+			"%s adds %s (%s) which exceeds plz.largeFileLimit of %s, use --force-large to publish anyway",
+			f.commit.Hash.String()[:8],
+			f.path,
+			formatSize(f.size),
+			formatSize(limit),
+		)
+	}
+	return nil
+}
+
+// treeUnchanged reports whether the commit's tree is the same as that of the
+// review's latest revision, in which case its files were already checked when
+// that revision was published.
+func (ri *reviewInfo) treeUnchanged(repo *git.Repository) bool {
+	hash := ri.lastRevisionHash()
+	if hash.IsZero() {
+		return false
+	}
+	if hash == ri.Commit.Hash {
+		return true
+	}
+	latest, err := repo.CommitObject(hash)
+	if err != nil {
+		// The latest revision hasn't been fetched.
+		return false
+	}
+	return latest.TreeHash == ri.Commit.TreeHash
+}
+
+// findLargeFiles returns the files added or modified by the commit that are
+// larger than threshold.
+func findLargeFiles(commit *object.Commit, threshold int64) ([]largeFile, error) {
+	if commit.TreeHash.IsZero() || len(commit.ParentHashes) == 0 {
+		// Commits that haven't been fetched have nothing to push.
+		return nil, nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var files []largeFile
+	for _, change := range changes {
+		if change.To.Name == "" {
+			// Deleted file.
+			continue
+		}
+		file, err := tree.TreeEntryFile(&change.To.TreeEntry)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if file.Size > threshold {
+			files = append(files, largeFile{commit: commit, path: change.To.Name, size: file.Size})
+		}
+	}
+	return files, nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1 << 10
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
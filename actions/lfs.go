@@ -0,0 +1,96 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+)
+
+// usesLFS reports whether any paths in the repo are tracked by Git LFS
+// according to any of its .gitattributes files, or .git/info/attributes.
+func usesLFS(repo *git.Repository) (bool, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	index, err := repo.Storer.Index()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	for _, entry := range index.Entries {
+		if path.Base(entry.Name) != ".gitattributes" {
+			continue
+		}
+		if isLFS, err := attributesUseLFS(worktree.Filesystem, entry.Name); err != nil || isLFS {
+			return isLFS, err
+		}
+	}
+	if fs, ok := stack.DotGitFilesystem(repo); ok {
+		return attributesUseLFS(fs, path.Join("info", "attributes"))
+	}
+	return false, nil
+}
+
+// attributesUseLFS reports whether the attributes file with the given name
+// sets filter=lfs on any paths. A missing file doesn't.
+func attributesUseLFS(fs billy.Filesystem, name string) (bool, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, attr := range strings.Fields(line) {
+			if attr == "filter=lfs" {
+				return true, nil
+			}
+		}
+	}
+	return false, errors.WithStack(s.Err())
+}
+
+// checkoutLFSFiles replaces the LFS pointer files left behind by go-git, which
+// doesn't run smudge filters, with their contents. Only the objects needed for
+// the current checkout are fetched.
+func checkoutLFSFiles(ctx context.Context, repo *git.Repository) error {
+	deps := deps.FromContext(ctx)
+	isLFS, err := usesLFS(repo)
+	if err != nil {
+		return err
+	}
+	if !isLFS {
+		return nil
+	}
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		deps.ErrorLog.Println(
+			"warning: repository uses Git LFS but git-lfs is not installed, large files were left as pointers",
+		)
+		return nil
+	}
+	deps.GitDebugLog.Println("pulling Git LFS files")
+	cmd := exec.CommandContext(ctx, "git", "lfs", "pull")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("git lfs pull failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// logPageSize is the number of revisions fetched per request by plz log.
+const logPageSize = 100
+
+// loggedRevision is a revision as listed by plz log.
+type loggedRevision struct {
+	stack.Revision
+	CreatedAt time.Time `graphql:"createdAt"`
+}
+
+// Log lists the published revisions of a review, newest first, with the
+// changes in each revision since the one before. With --author, it lists
+// those of each open review authored by the given GitHub user instead.
+func Log(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+
+	if author := c.String("author"); author != "" {
+		if c.IsSet("review") {
+			return errors.New("--author cannot be used with --review")
+		}
+		gitHubRepo, err := newGitHubRepo(ctx, token)
+		if err != nil {
+			return err
+		}
+		return logAuthorReviews(ctx, gitHubRepo, graphqlClient, author)
+	}
+
+	reviewID := c.String("review")
+	if reviewID == "" {
+		reviewID, _, err = headReviewID(repo)
+		if err != nil {
+			return err
+		}
+	}
+	revisions, err := loadAllRevisions(ctx, graphqlClient, reviewID)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return errors.Errorf("review %s has no revisions", reviewID)
+	}
+
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	printRevisions(ctx, w, repo, revisions, "")
+	return errors.WithStack(w.Flush())
+}
+
+// logAuthorReviews lists the published revisions of each open review
+// authored by the given GitHub user, like plz status --author.
+func logAuthorReviews(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	author string,
+) error {
+	deps := deps.FromContext(ctx)
+	prs, err := listReviewPRs(ctx, gitHubRepo)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	found := false
+	for _, pr := range prs {
+		if !strings.EqualFold(pr.GetUser().GetLogin(), author) {
+			continue
+		}
+		found = true
+		reviewID := strings.TrimPrefix(pr.GetHead().GetRef(), reviewBranchPrefix)
+		revisions, err := loadAllRevisions(ctx, graphqlClient, reviewID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "review %s, #%d %s:\n", reviewID, pr.GetNumber(), pr.GetTitle())
+		printRevisions(ctx, w, gitHubRepo.GitRepo(), revisions, "  ")
+	}
+	if !found {
+		deps.InfoLog.Printf("no open reviews authored by %s", author)
+		return nil
+	}
+	return errors.WithStack(w.Flush())
+}
+
+// printRevisions writes a line for each of the revisions, which are newest
+// first, with the changes in each revision since the one before. Each line
+// starts with indent.
+func printRevisions(ctx context.Context, w io.Writer, repo *git.Repository, revisions []loggedRevision, indent string) {
+	for i, revision := range revisions {
+		// The revisions are newest first, so the one before is next.
+		fromSHA := revision.BaseCommitSHA
+		if i+1 < len(revisions) {
+			fromSHA = revisions[i+1].HeadCommitSHA
+		}
+		stats := revisionStats(ctx, repo, fromSHA, revision.HeadCommitSHA)
+		if i+1 < len(revisions) && revisions[i+1].BaseCommitSHA != revision.BaseCommitSHA {
+			stats += ", rebased"
+		}
+		fmt.Fprintf(
+			w,
+			"%sr%d\t%s\t%s\t%s\n",
+			indent,
+			revision.Number,
+			shortSHA(revision.HeadCommitSHA),
+			revision.CreatedAt.Local().Format("2006-01-02 15:04"),
+			stats,
+		)
+	}
+}
+
+// loadAllRevisions returns all revisions of a review, newest first, fetching
+// them a page at a time.
+func loadAllRevisions(ctx context.Context, graphqlClient *graphql.Client, reviewID string) ([]loggedRevision, error) {
+	var revisions []loggedRevision
+	for {
+		var query struct {
+			Review struct {
+				RevisionList struct {
+					Revisions []loggedRevision `graphql:"revisions"`
+				} `graphql:"revisionList(options: {count: $count, offset: $offset})"`
+			} `graphql:"review(id: $reviewId)"`
+		}
+		err := graphqlClient.Query(ctx, &query, map[string]interface{}{
+			"reviewId": graphql.ID(reviewID),
+			"count":    graphql.Int(logPageSize),
+			"offset":   graphql.Int(len(revisions)),
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		page := query.Review.RevisionList.Revisions
+		revisions = append(revisions, page...)
+		if len(page) < logPageSize {
+			break
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number > revisions[j].Number
+	})
+	return revisions, nil
+}
+
+// revisionStats summarizes the changes between two commits, e.g. "3 files,
+// +20 -5". Commits missing locally are fetched, and if that fails the stats
+// are reported as unavailable rather than failing the whole log.
+func revisionStats(ctx context.Context, repo *git.Repository, fromSHA string, toSHA string) string {
+	deps := deps.FromContext(ctx)
+	fromCommit, err := ensureCommit(ctx, repo, fromSHA)
+	if err != nil {
+		deps.GitDebugLog.Println(err)
+		return "changes unavailable"
+	}
+	toCommit, err := ensureCommit(ctx, repo, toSHA)
+	if err != nil {
+		deps.GitDebugLog.Println(err)
+		return "changes unavailable"
+	}
+	patch, err := fromCommit.Patch(toCommit)
+	if err != nil {
+		deps.GitDebugLog.Println(err)
+		return "changes unavailable"
+	}
+	files, added, deleted := 0, 0, 0
+	for _, stat := range patch.Stats() {
+		files++
+		added += stat.Addition
+		deleted += stat.Deletion
+	}
+	if files == 1 {
+		return fmt.Sprintf("1 file, +%d -%d", added, deleted)
+	}
+	return fmt.Sprintf("%d files, +%d -%d", files, added, deleted)
+}
@@ -0,0 +1,66 @@
+package actions
+
+import (
+	"context"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+)
+
+// findMilestone returns the open milestone with the given title.
+func findMilestone(ctx context.Context, gitHubRepo *gitHubRepo, title string) (*github.Milestone, error) {
+	opts := &github.MilestoneListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		milestones, resp, err := gitHubRepo.Client().Issues.ListMilestones(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			opts,
+		)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, m := range milestones {
+			if m.GetTitle() == title {
+				return m, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, errors.Errorf("milestone %q not found", title)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// needsMilestone reports whether the review's PR needs its milestone set.
+func needsMilestone(ri *reviewInfo, milestone *github.Milestone) bool {
+	if milestone == nil {
+		return false
+	}
+	return ri.pr == nil || ri.pr.GetMilestone().GetNumber() != milestone.GetNumber()
+}
+
+// syncMilestone sets the milestone on the review's PR, returning whether the
+// PR was updated.
+func syncMilestone(ctx context.Context, gitHubRepo *gitHubRepo, ri *reviewInfo, opts *prOptions) (bool, error) {
+	deps := deps.FromContext(ctx)
+	if !needsMilestone(ri, opts.milestone) {
+		return false, nil
+	}
+	deps.APIDebugLog.Println("setting milestone", opts.milestone.GetTitle(), "on PR", ri.prNumber())
+	_, _, err := gitHubRepo.Client().Issues.Edit(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		ri.prNumber(),
+		&github.IssueRequest{Milestone: opts.milestone.Number},
+	)
+	if err != nil {
+		return true, errors.WithStack(err)
+	}
+	return true, nil
+}
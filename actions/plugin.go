@@ -0,0 +1,80 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"os/exec"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// pluginPrefix is the prefix of the executables that plz runs for commands it
+// doesn't know, like git runs git-<name>.
+const pluginPrefix = "plz-"
+
+// RunPlugin runs plz-<name> from the PATH with the given arguments, for a
+// command that plz doesn't have. The plugin gets what it needs to act like
+// plz from the environment:
+//
+//	PLZ_API_BASE_URL  the plz API base URL
+//	PLZ_PROFILE       the profile, if any, see --profile
+//	PLZ_TOKEN         the auth token, if signed in
+//	PLZ_WORKTREE      the top of the worktree, if in a repository
+//	PLZ_GIT_DIR       the Git directory, if in a repository
+//	PLZ_REPO_OWNER    the GitHub owner of origin, if in a repository
+//	PLZ_REPO_NAME     the GitHub name of origin, if in a repository
+//
+// A plugin that fails makes plz exit with the same status.
+func RunPlugin(ctx context.Context, name string, args []string) error {
+	deps := deps.FromContext(ctx)
+
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return errors.Errorf("%s is not a plz command and there's no %s%[1]s on the PATH, see plz --help", name, pluginPrefix)
+	}
+	env := append(os.Environ(), "PLZ_API_BASE_URL="+deps.PlzAPIBaseURL)
+	if profile := deps.Auth.Profile(); profile != "" {
+		env = append(env, "PLZ_PROFILE="+profile)
+	}
+	if token, err := deps.Auth.Token(); err == nil {
+		env = append(env, "PLZ_TOKEN="+token)
+	} else {
+		deps.APIDebugLog.Println("not passing credentials to plugin:", err)
+	}
+	if repo, err := openGitRepo(); err == nil {
+		env = append(env, pluginRepoEnv(repo)...)
+	}
+
+	deps.GitDebugLog.Println("running plugin", path)
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return cli.Exit("", exitErr.ExitCode())
+	}
+	return errors.WithStack(err)
+}
+
+// pluginRepoEnv returns the environment variables describing the repository
+// for RunPlugin.
+func pluginRepoEnv(repo *git.Repository) []string {
+	var env []string
+	if worktree, err := repo.Worktree(); err == nil {
+		env = append(env, "PLZ_WORKTREE="+worktree.Filesystem.Root())
+	}
+	if fs, ok := stack.DotGitFilesystem(repo); ok {
+		env = append(env, "PLZ_GIT_DIR="+fs.Root())
+	}
+	if _, owner, name, err := parseRemote(repo); err == nil {
+		env = append(env, "PLZ_REPO_OWNER="+owner, "PLZ_REPO_NAME="+name)
+	}
+	return env
+}
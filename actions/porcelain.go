@@ -0,0 +1,116 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/pkg/errors"
+)
+
+// porcelainVersion is the first field of every line of --porcelain output. It
+// only changes if the meaning of existing fields changes. New fields are added
+// at the end of lines without changing it, so parsers should ignore extra
+// fields. See the README for the format.
+const porcelainVersion = "v1"
+
+// porcelainContext prepares for --porcelain output. It returns the writer for
+// the porcelain output, which is always stdout since scripts rely on it even
+// with --quiet, and a context whose InfoLog is the ErrorLog so that messages
+// meant for people don't get mixed into it. With --quiet those messages are
+// still discarded.
+func porcelainContext(ctx context.Context) (context.Context, io.Writer) {
+	d := *deps.FromContext(ctx)
+	if d.InfoLog.Writer() != io.Discard {
+		d.InfoLog = d.ErrorLog
+	}
+	return deps.ContextWithDeps(ctx, &d), os.Stdout
+}
+
+// writePorcelainLine writes a line of tab separated fields, prefixed with the
+// porcelain version. Empty fields are written as "-", and tabs and newlines
+// in fields are replaced with spaces.
+func writePorcelainLine(w io.Writer, fields ...string) error {
+	for i, field := range fields {
+		if field == "" {
+			fields[i] = "-"
+		} else {
+			fields[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(field)
+		}
+	}
+	_, err := fmt.Fprintln(w, porcelainVersion+"\t"+strings.Join(fields, "\t"))
+	return errors.WithStack(err)
+}
+
+// writePorcelainStatus writes plz status --porcelain output for the given
+// stacks. checks may be nil if checks weren't loaded.
+func writePorcelainStatus(w io.Writer, stacks []stack.CommitStack, checks map[string]checkState) error {
+	for _, s := range stacks {
+		for _, ci := range s {
+			var reviewStatus, revision, reviewID, prNumber, checksState string
+			if ci.Review != nil {
+				reviewStatus = string(ci.Review.Status)
+				if ci.Review.LocalRevision != nil {
+					revision = strconv.Itoa(ci.Review.LocalRevision.Number)
+				}
+				reviewID = ci.Review.ID
+				if ci.Review.GitHubPR != 0 {
+					prNumber = strconv.Itoa(ci.Review.GitHubPR)
+				}
+				checksState = string(checks[ci.Review.ID])
+			}
+			err := writePorcelainLine(
+				w,
+				ci.Commit.Hash.String(),
+				string(ci.Status()),
+				reviewStatus,
+				revision,
+				reviewID,
+				prNumber,
+				checksState,
+				s.Name(),
+				commitTitle(ci.Commit.Message),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writePorcelainReview writes plz review --porcelain output for the published
+// reviews, from the top of the stack down like the regular output.
+func writePorcelainReview(w io.Writer, ris []*reviewInfo, stackName string) error {
+	for i := len(ris) - 1; i >= 0; i-- {
+		ri := ris[i]
+		action := ri.publishAction()
+		commit := ri.Commit
+		if ri.updatedCommit != nil {
+			commit = ri.updatedCommit
+		}
+		err := writePorcelainLine(
+			w,
+			commit.Hash.String(),
+			action,
+			ri.reviewID,
+			strconv.Itoa(ri.prNumber()),
+			stackName,
+			commitTitle(commit.Message),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitTitle returns the first line of a commit message.
+func commitTitle(message string) string {
+	return strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+}
@@ -0,0 +1,94 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+)
+
+// Values for the plz.prBodySync setting, which controls what happens when a
+// PR's title or body has drifted from the commit message.
+const (
+	// prBodySyncCommit overwrites the PR with the commit message. This is the
+	// default.
+	prBodySyncCommit = "commit"
+	// prBodySyncPR leaves the PR title and body alone once the PR is created.
+	prBodySyncPR = "pr"
+	// prBodySyncMerge keeps the commit message body in a managed section of
+	// the PR body, leaving anything outside of that section untouched.
+	prBodySyncMerge = "merge"
+)
+
+const (
+	managedSectionBegin = "<!-- plz:begin -->"
+	managedSectionEnd   = "<!-- plz:end -->"
+)
+
+func validatePRBodySync(policy string) error {
+	switch policy {
+	case prBodySyncCommit, prBodySyncPR, prBodySyncMerge:
+		return nil
+	}
+	return errors.Errorf(
+		"invalid plz.prBodySync value %q, must be one of %s, %s or %s",
+		policy,
+		prBodySyncCommit,
+		prBodySyncPR,
+		prBodySyncMerge,
+	)
+}
+
+// syncPRTitleAndBody returns the title and body that a PR should have given
+// the title and body derived from the commit message. pr is nil if the PR
+// doesn't exist yet. template may be nil. The template is only added when the
+// PR is created, outside a managed section, so that it can be filled in on
+// GitHub; after that only the managed section is updated. Without a template,
+// the commit policy overwrites the whole body.
+func syncPRTitleAndBody(
+	policy string,
+	pr *github.PullRequest,
+	template *prTemplate,
+	title string,
+	body string,
+) (string, string) {
+	switch policy {
+	case prBodySyncPR:
+		if pr != nil {
+			return pr.GetTitle(), pr.GetBody()
+		}
+		return title, template.apply(body)
+	case prBodySyncCommit:
+		if template == nil {
+			return title, body
+		}
+	}
+	if pr == nil {
+		return title, template.apply(managedSection(body))
+	}
+	if strings.TrimSpace(pr.GetBody()) == template.apply(body) {
+		// Created before plz managed a section of templated PRs.
+		return title, template.apply(managedSection(body))
+	}
+	return title, mergeManagedSection(pr.GetBody(), body)
+}
+
+func managedSection(body string) string {
+	return managedSectionBegin + "\n" + body + "\n" + managedSectionEnd
+}
+
+// mergeManagedSection replaces the managed section of prBody with body. If
+// prBody has no managed section, one is added above the existing text unless
+// that text is just the old commit message body.
+func mergeManagedSection(prBody string, body string) string {
+	begin := strings.Index(prBody, managedSectionBegin)
+	end := strings.Index(prBody, managedSectionEnd)
+	if begin < 0 || end < begin {
+		existing := strings.TrimSpace(prBody)
+		if existing == "" || existing == body {
+			return managedSection(body)
+		}
+		return managedSection(body) + "\n\n" + existing
+	}
+	return prBody[:begin] + managedSection(body) + prBody[end+len(managedSectionEnd):]
+}
@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// Values for the plz.prTemplate setting, which controls where the repo's PR
+// template goes relative to the commit message body.
+const (
+	// prTemplateBelow puts the template below the commit message body. This is
+	// the default.
+	prTemplateBelow = "below"
+	// prTemplateAbove puts the template above the commit message body.
+	prTemplateAbove = "above"
+	// prTemplateOff ignores the template.
+	prTemplateOff = "off"
+)
+
+// prTemplatePaths are the locations GitHub looks for a PR template, in order.
+var prTemplatePaths = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+}
+
+// prTemplate is a repo's PR template and where to place it in PR bodies.
+type prTemplate struct {
+	text      string
+	placement string
+}
+
+// loadPRTemplate returns the PR template in the given commit, or nil if there
+// isn't one or plz.prTemplate is off.
+func loadPRTemplate(commit *object.Commit, placement string) (*prTemplate, error) {
+	switch placement {
+	case "":
+		placement = prTemplateBelow
+	case prTemplateBelow, prTemplateAbove:
+	case prTemplateOff:
+		return nil, nil
+	default:
+		return nil, errors.Errorf(
+			"invalid plz.prTemplate value %q, must be one of %s, %s or %s",
+			placement,
+			prTemplateBelow,
+			prTemplateAbove,
+			prTemplateOff,
+		)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, path := range prTemplatePaths {
+		f, err := tree.File(path)
+		if err == object.ErrFileNotFound {
+			continue
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		text := strings.TrimSpace(string(b))
+		if text == "" {
+			return nil, nil
+		}
+		return &prTemplate{text: text, placement: placement}, nil
+	}
+	return nil, nil
+}
+
+// apply combines the PR body derived from the commit message with the
+// template. It is safe to call on a nil template.
+func (t *prTemplate) apply(body string) string {
+	if t == nil {
+		return body
+	}
+	if body == "" {
+		return t.text
+	}
+	if t.placement == prTemplateAbove {
+		return t.text + "\n\n" + body
+	}
+	return body + "\n\n" + t.text
+}
@@ -0,0 +1,72 @@
+package actions
+
+import (
+	"context"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// pruneReviewBranches deletes the local review branches of merged and deleted
+// reviews, and if pruneRemote is set, their remote-tracking branches too. The
+// branch that HEAD points to is never deleted. With dryRun, the branches are
+// listed rather than deleted.
+func pruneReviewBranches(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	pruneRemote bool,
+	dryRun bool,
+) error {
+	deps := deps.FromContext(ctx)
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	branches, err := localReviewBranches(repo)
+	if err != nil {
+		return err
+	}
+	var candidates []*plumbing.Reference
+	for _, ref := range branches {
+		if ref.Name() != headRef.Name() {
+			candidates = append(candidates, ref)
+		}
+	}
+	states, err := loadReviewBranchStates(ctx, graphqlClient, candidates)
+	if err != nil {
+		return err
+	}
+	numPruned := 0
+	for i, ref := range candidates {
+		status := states[i].Status
+		if status != stack.ReviewStatusMerged && status != stack.ReviewStatusDeleted {
+			continue
+		}
+		if dryRun {
+			deps.InfoLog.Printf("would delete %s of %s review", ref.Name().Short(), status)
+			continue
+		}
+		deps.GitDebugLog.Println("deleting", ref.Name(), "of", status, "review")
+		if err := repo.Storer.RemoveReference(ref.Name()); err != nil {
+			return errors.WithStack(err)
+		}
+		if pruneRemote {
+			remoteRefName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref.Name().Short())
+			deps.GitDebugLog.Println("deleting", remoteRefName)
+			if err := repo.Storer.RemoveReference(remoteRefName); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		numPruned++
+	}
+	if numPruned > 0 {
+		deps.InfoLog.Printf("deleted %d review branches of merged or deleted reviews", numPruned)
+	}
+	return nil
+}
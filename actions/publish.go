@@ -0,0 +1,150 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// MarkPullRequestReadyForReviewInput is the input to GitHub's
+// markPullRequestReadyForReview mutation. The name must match the GraphQL
+// type.
+type MarkPullRequestReadyForReviewInput struct {
+	PullRequestID graphql.ID `json:"pullRequestId"`
+}
+
+// ConvertPullRequestToDraftInput is the input to GitHub's
+// convertPullRequestToDraft mutation. The name must match the GraphQL type.
+type ConvertPullRequestToDraftInput struct {
+	PullRequestID graphql.ID `json:"pullRequestId"`
+}
+
+// Publish marks the PRs of the given reviews in the stack ready for review,
+// or with --draft converts them back to drafts, so that a stack can be opened
+// up to reviewers a piece at a time. Reviews are identified by commit or
+// review ID, and default to every open review in the stack.
+func Publish(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+	draft := c.Bool("draft")
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	if err != nil {
+		return err
+	}
+
+	// Select from the bottom of the stack up, which is the order reviewers
+	// read it in.
+	var selected []stack.CommitInfo
+	if c.Args().Present() {
+		commits := make([]*object.Commit, len(s))
+		for i, ci := range s {
+			commits[i] = ci.Commit
+		}
+		seen := map[int]bool{}
+		for _, arg := range c.Args().Slice() {
+			i, err := stackCommitIndex(repo, commits, arg)
+			if err != nil {
+				return err
+			}
+			seen[i] = true
+		}
+		for i := len(s) - 1; i >= 0; i-- {
+			if seen[i] {
+				selected = append(selected, s[i])
+			}
+		}
+	} else {
+		for i := len(s) - 1; i >= 0; i-- {
+			if s[i].Review != nil && s[i].Review.Status == stack.ReviewStatusOpen {
+				selected = append(selected, s[i])
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return errors.New("no open reviews in the stack")
+	}
+	for _, ci := range selected {
+		if ci.Review == nil || ci.Review.GitHubPR == 0 {
+			return errors.Errorf(
+				"commit %s has no review, publish it with plz review first",
+				shortSHA(ci.Commit.Hash.String()),
+			)
+		}
+		if ci.Review.Status != stack.ReviewStatusOpen {
+			return errors.Errorf("review %s is %s", ci.Review.ID, ci.Review.Status)
+		}
+	}
+
+	gitHubGraphQLClient := newGitHubGraphQLClient(token)
+	for _, ci := range selected {
+		number := ci.Review.GitHubPR
+		pr, _, err := gitHubRepo.Client().PullRequests.Get(ctx, gitHubRepo.Owner(), gitHubRepo.Name(), number)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		url := "https://plz.review/review/" + ci.Review.ID
+		if pr.GetDraft() == draft {
+			deps.InfoLog.Printf("PR #%d is already %s: %s", number, draftState(draft), url)
+			continue
+		}
+		if draft {
+			var mutation struct {
+				ConvertPullRequestToDraft struct {
+					ClientMutationID string `graphql:"clientMutationId"`
+				} `graphql:"convertPullRequestToDraft(input: $input)"`
+			}
+			err = gitHubGraphQLClient.Mutate(ctx, &mutation, map[string]interface{}{
+				"input": ConvertPullRequestToDraftInput{PullRequestID: pr.GetNodeID()},
+			})
+		} else {
+			var mutation struct {
+				MarkPullRequestReadyForReview struct {
+					ClientMutationID string `graphql:"clientMutationId"`
+				} `graphql:"markPullRequestReadyForReview(input: $input)"`
+			}
+			err = gitHubGraphQLClient.Mutate(ctx, &mutation, map[string]interface{}{
+				"input": MarkPullRequestReadyForReviewInput{PullRequestID: pr.GetNodeID()},
+			})
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot mark PR #%d as %s", number, draftState(draft))
+		}
+		deps.InfoLog.Printf("marked PR #%d as %s: %s", number, draftState(draft), url)
+	}
+	return nil
+}
+
+// draftState describes whether a PR is a draft.
+func draftState(draft bool) string {
+	if draft {
+		return "a draft"
+	}
+	return "ready for review"
+}
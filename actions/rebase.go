@@ -0,0 +1,206 @@
+package actions
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// rebaseConflictError is returned by rebaseCommits when a commit changes a
+// path that was also changed between its old and new base.
+type rebaseConflictError struct {
+	commit plumbing.Hash
+	path   string
+	// onto is the commit that the conflicting commit was being replayed onto,
+	// and index is the position of the conflicting commit in the commits
+	// passed to rebaseCommits.
+	onto  plumbing.Hash
+	index int
+}
+
+func (e *rebaseConflictError) Error() string {
+	return "commit " + shortSHA(e.commit.String()) + " conflicts in " + e.path
+}
+
+// rebaseCommits replays commits onto newBase and returns the new head commit.
+// The commits are ordered top first, like a stack. Since go-git can't merge
+// file contents, a commit is only replayed if none of the paths it changes
+// differ between its old and new base; otherwise a *rebaseConflictError is
+// returned and nothing is changed apart from writing unreferenced objects. See
+// startSyncConflict for how conflicts are handed over to Git.
+func rebaseCommits(ctx context.Context, repo *git.Repository, commits []*object.Commit, newBase plumbing.Hash) (plumbing.Hash, error) {
+	deps := deps.FromContext(ctx)
+	onto := newBase
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i]
+		if len(commit.ParentHashes) != 1 {
+			return plumbing.ZeroHash, errors.Errorf("cannot rebase merge commit %s", shortSHA(commit.Hash.String()))
+		}
+		rebased, err := rebaseCommit(ctx, repo, commit, onto)
+		var conflictErr *rebaseConflictError
+		if errors.As(err, &conflictErr) {
+			conflictErr.onto = onto
+			conflictErr.index = i
+		}
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		deps.GitDebugLog.Println("rebased", commit.Hash, "as", rebased)
+		onto = rebased
+	}
+	return onto, nil
+}
+
+func rebaseCommit(ctx context.Context, repo *git.Repository, commit *object.Commit, onto plumbing.Hash) (plumbing.Hash, error) {
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	ontoCommit, err := repo.CommitObject(onto)
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	ontoTree, err := ontoCommit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+
+	changes, err := object.DiffTree(parentTree, commitTree)
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	// Each changed path maps to its new entry, or nil if it was deleted.
+	updates := map[string]*object.TreeEntry{}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name == "" {
+				continue
+			}
+			if !sameEntry(findEntry(parentTree, name), findEntry(ontoTree, name)) {
+				return plumbing.ZeroHash, &rebaseConflictError{commit: commit.Hash, path: name}
+			}
+		}
+		if change.From.Name != "" {
+			updates[change.From.Name] = nil
+		}
+		if change.To.Name != "" {
+			entry := change.To.TreeEntry
+			updates[change.To.Name] = &entry
+		}
+	}
+
+	treeHash, err := updateTree(repo, ontoTree, updates)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	rebased := &object.Commit{
+		Author:       commit.Author,
+		Committer:    commit.Committer,
+		Message:      commit.Message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{onto},
+	}
+	return storeCommit(ctx, repo, rebased)
+}
+
+func findEntry(tree *object.Tree, path string) *object.TreeEntry {
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return nil
+	}
+	return entry
+}
+
+func sameEntry(a, b *object.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+// updateTree writes a copy of tree with the given paths replaced or, for nil
+// entries, removed, and returns the new tree's hash. tree may be nil for a new
+// directory.
+func updateTree(repo *git.Repository, tree *object.Tree, updates map[string]*object.TreeEntry) (plumbing.Hash, error) {
+	entries := map[string]object.TreeEntry{}
+	if tree != nil {
+		for _, entry := range tree.Entries {
+			entries[entry.Name] = entry
+		}
+	}
+	subUpdates := map[string]map[string]*object.TreeEntry{}
+	for path, entry := range updates {
+		dir, rest, isNested := strings.Cut(path, "/")
+		if !isNested {
+			if entry == nil {
+				delete(entries, dir)
+			} else {
+				entries[dir] = object.TreeEntry{Name: dir, Mode: entry.Mode, Hash: entry.Hash}
+			}
+			continue
+		}
+		if subUpdates[dir] == nil {
+			subUpdates[dir] = map[string]*object.TreeEntry{}
+		}
+		subUpdates[dir][rest] = entry
+	}
+	for dir, sub := range subUpdates {
+		var subtree *object.Tree
+		if entry, ok := entries[dir]; ok && entry.Mode == filemode.Dir {
+			var err error
+			subtree, err = repo.TreeObject(entry.Hash)
+			if err != nil {
+				return plumbing.ZeroHash, errors.WithStack(err)
+			}
+		}
+		hash, err := updateTree(repo, subtree, sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if hash.IsZero() {
+			delete(entries, dir)
+		} else {
+			entries[dir] = object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash}
+		}
+	}
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+
+	// Git sorts tree entries by name, comparing directories as if their names
+	// ended with a slash.
+	newTree := &object.Tree{}
+	for _, entry := range entries {
+		newTree.Entries = append(newTree.Entries, entry)
+	}
+	sortKey := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(newTree.Entries, func(i, j int) bool {
+		return sortKey(newTree.Entries[i]) < sortKey(newTree.Entries[j])
+	})
+	obj := repo.Storer.NewEncodedObject()
+	if err := newTree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	return hash, errors.WithStack(err)
+}
@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// RebaseOnto moves the commits of the stack from the given commit up to HEAD
+// onto a new base, like git rebase --onto <newbase> <commit>~ <branch>, and
+// points the branch at the result. The commit defaults to the bottom of the
+// stack. It's what plz sync --no-rebase suggests for unpublished commits, and
+// stops on conflicts the same way plz sync does, so they're resolved with plz
+// sync --continue or undone with plz sync --abort.
+func RebaseOnto(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return errors.New("usage: plz rebase-onto <newbase> [<first commit>]")
+	}
+	options := &SyncOptions{NoLFS: c.Bool("no-lfs")}
+
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	if state, err := loadSyncState(repo); err != nil {
+		return err
+	} else if state != nil {
+		return errors.New("a sync stopped on a conflict, run plz sync --continue or plz sync --abort")
+	}
+	stash, err := requireCleanWorktree(ctx, autostashFlag(c))
+	if err != nil {
+		return err
+	}
+	defer finishSyncAutostash(ctx, repo, stash)
+
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !headRef.Name().IsBranch() {
+		return errors.New("HEAD is detached, check out the stack's branch first")
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defaultBranch, err := localDefaultBranch(ctx, repo)
+	if err != nil {
+		return err
+	}
+	commits, err := stack.LocalCommits(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return errors.New("no commits in the stack")
+	}
+	first := len(commits) - 1
+	if c.NArg() == 2 {
+		first, err = stackCommitIndex(repo, commits, c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+	}
+	newBase, err := repo.ResolveRevision(plumbing.Revision(c.Args().First()))
+	if err != nil {
+		return errors.Errorf("cannot resolve %q to a commit", c.Args().First())
+	}
+	if _, err := repo.CommitObject(*newBase); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, commit := range commits[:first+1] {
+		if commit.Hash == *newBase {
+			return errors.Errorf("cannot rebase onto %s, which is one of the commits being moved", shortSHA(newBase.String()))
+		}
+	}
+
+	moving := make([]*object.Commit, first+1)
+	copy(moving, commits)
+	deps.StackDebugLog.Printf("rebasing %d commits starting at %s onto %s", len(moving), moving[first].Hash, newBase)
+	newHead, err := rebaseCommits(ctx, repo, moving, *newBase)
+	var conflictErr *rebaseConflictError
+	if errors.As(err, &conflictErr) {
+		return startSyncConflict(ctx, options, repo, nil, nil, headRef.Name(), headRef.Hash(), moving, conflictErr)
+	} else if err != nil {
+		return err
+	}
+	deps.GitDebugLog.Println("repointing", headRef.Name(), "to", newHead)
+	if err := resetBranch(repo, headRef.Name(), newHead); err != nil {
+		return err
+	}
+	if !options.NoLFS {
+		if err := checkoutLFSFiles(ctx, repo); err != nil {
+			return err
+		}
+	}
+	deps.InfoLog.Printf(
+		"rebased %d commits onto %s, run plz review to publish them",
+		len(moving),
+		shortSHA(newBase.String()),
+	)
+	return nil
+}
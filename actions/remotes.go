@@ -0,0 +1,122 @@
+package actions
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// remoteBranch is where the remote-tracking state of a review branch came
+// from when a repo has several remotes with review branches, e.g. origin and a
+// mirror.
+type remoteBranch struct {
+	remote string
+	hash   plumbing.Hash
+	// differs lists the lower priority remotes whose copy of the branch is at
+	// a different commit.
+	differs []string
+}
+
+// remoteOrder returns the remotes to look for review branches in, most
+// preferred first. It is set with plz.remotes as a comma separated list, and
+// defaults to origin followed by the other remotes in alphabetical order.
+func remoteOrder(ctx context.Context, repo *git.Repository) ([]string, error) {
+	deps := deps.FromContext(ctx)
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	exists := map[string]bool{}
+	for _, remote := range remotes {
+		exists[remote.Config().Name] = true
+	}
+	var order []string
+	if configured := deps.Config.Get("remotes"); configured != "" {
+		for _, name := range strings.Split(configured, ",") {
+			name = strings.TrimSpace(name)
+			if !exists[name] {
+				return nil, errors.Errorf("plz.remotes lists %q, which is not a remote", name)
+			}
+			order = append(order, name)
+		}
+		return order, nil
+	}
+	for name := range exists {
+		if name != git.DefaultRemoteName {
+			order = append(order, name)
+		}
+	}
+	sort.Strings(order)
+	if exists[git.DefaultRemoteName] {
+		order = append([]string{git.DefaultRemoteName}, order...)
+	}
+	return order, nil
+}
+
+// resolveRemoteBranches finds the remote-tracking branch of each open review
+// in the stack, taking it from the first remote in order that has it. It
+// returns nil if there is only one remote, since there is nothing to choose
+// between.
+func resolveRemoteBranches(
+	ctx context.Context,
+	repo *git.Repository,
+	order []string,
+	s stack.CommitStack,
+) map[string]remoteBranch {
+	deps := deps.FromContext(ctx)
+	if len(order) < 2 {
+		return nil
+	}
+	branches := map[string]remoteBranch{}
+	for _, ci := range s {
+		if ci.Review == nil || ci.Review.HeadBranch == "" {
+			continue
+		}
+		var rb *remoteBranch
+		for _, remote := range order {
+			ref, err := repo.Reference(plumbing.NewRemoteReferenceName(remote, ci.Review.HeadBranch), true)
+			if err != nil {
+				continue
+			}
+			if rb == nil {
+				rb = &remoteBranch{remote: remote, hash: ref.Hash()}
+			} else if ref.Hash() != rb.hash {
+				rb.differs = append(rb.differs, remote)
+			}
+		}
+		if rb == nil {
+			deps.GitDebugLog.Printf("review %s: branch %s not found on any of %v", ci.Review.ID, ci.Review.HeadBranch, order)
+			continue
+		}
+		deps.GitDebugLog.Printf(
+			"review %s: branch %s from %s at %s, differs on %v",
+			ci.Review.ID,
+			ci.Review.HeadBranch,
+			rb.remote,
+			shortSHA(rb.hash.String()),
+			rb.differs,
+		)
+		branches[ci.Review.ID] = *rb
+	}
+	return branches
+}
+
+// describe summarizes where a review branch came from for plz status, or
+// returns an empty string if it came from the preferred remote and no other
+// remote disagrees.
+func (rb remoteBranch) describe(preferred string) string {
+	var parts []string
+	if rb.remote != preferred {
+		parts = append(parts, "from "+rb.remote)
+	}
+	if len(rb.differs) > 0 {
+		parts = append(parts, strings.Join(rb.differs, ", ")+" differs")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,137 @@
+package actions
+
+import (
+	"context"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// reservationTTL is how long a reserved review ID is left alone, so that a
+// concurrent plz review, e.g. in another worktree, has the time to publish it.
+const reservationTTL = 24 * time.Hour
+
+// releaseOrphanedReservations releases review IDs that an earlier plz review
+// reserved but never published, e.g. because it crashed before the IDs were
+// added to commit trailers. Only reservations older than reservationTTL are
+// considered, and a reserved ID is still in use if a commit in the stack of
+// any local branch has it in a trailer or there is a PR for its review
+// branch. Cleanup is best effort, so failures are only warnings.
+func releaseOrphanedReservations(ctx context.Context, gitHubRepo *gitHubRepo, graphqlClient *graphql.Client) {
+	deps := deps.FromContext(ctx)
+	if err := reconcileReservations(ctx, gitHubRepo, graphqlClient); err != nil {
+		deps.ErrorLog.Printf("warning: failed to release unused review IDs: %v", err)
+	}
+}
+
+func reconcileReservations(ctx context.Context, gitHubRepo *gitHubRepo, graphqlClient *graphql.Client) error {
+	deps := deps.FromContext(ctx)
+	repo := gitHubRepo.GitRepo()
+	reservations, err := stack.Reservations(repo)
+	if err != nil {
+		return err
+	}
+	var reserved []string
+	for _, r := range reservations {
+		if time.Since(r.ReservedAt) > reservationTTL {
+			reserved = append(reserved, r.ID)
+		}
+	}
+	if len(reserved) == 0 {
+		return nil
+	}
+
+	inTrailer, err := localTrailerReviewIDs(ctx, gitHubRepo)
+	if err != nil {
+		return err
+	}
+
+	var used, orphaned []string
+	for _, id := range reserved {
+		if inTrailer[id] {
+			used = append(used, id)
+			continue
+		}
+		prs, _, err := gitHubRepo.Client().PullRequests.List(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			&github.PullRequestListOptions{
+				State: "all",
+				Head:  gitHubRepo.Owner() + ":" + reviewBranchPrefix + id,
+			},
+		)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(prs) > 0 {
+			used = append(used, id)
+		} else {
+			orphaned = append(orphaned, id)
+		}
+	}
+
+	if len(orphaned) > 0 {
+		deps.GraphQLDebugLog.Println("releasing orphaned review IDs:", orphaned)
+		ids := make([]graphql.ID, len(orphaned))
+		for i, id := range orphaned {
+			ids[i] = graphql.ID(id)
+		}
+		var mutation struct {
+			ReleaseReviewIDs []string `graphql:"releaseReviewIDs(ids: $ids)"`
+		}
+		err := graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+			"ids": ids,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return stack.RemoveReservations(repo, append(used, orphaned...))
+}
+
+// localTrailerReviewIDs returns the review IDs in the trailers of the commits
+// in the stacks of HEAD and every local branch.
+func localTrailerReviewIDs(ctx context.Context, gitHubRepo *gitHubRepo) (map[string]bool, error) {
+	deps := deps.FromContext(ctx)
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	heads := map[plumbing.Hash]bool{headRef.Hash(): true}
+	branches, err := repo.Branches()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		heads[ref.Hash()] = true
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	inTrailer := map[string]bool{}
+	for hash := range heads {
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		commits, err := stack.LocalCommits(ctx, repo, commit, gitHubRepo.DefaultBranch())
+		if err != nil {
+			// e.g. a branch that doesn't share history with the default
+			// branch, which can't have any of the reserved IDs anyway.
+			deps.StackDebugLog.Printf("skipping %s when looking for reserved review IDs: %v", hash, err)
+			continue
+		}
+		for _, commit := range commits {
+			inTrailer[stack.ReviewIDFromCommitMessage(commit.Message)] = true
+		}
+	}
+	return inTrailer, nil
+}
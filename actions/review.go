@@ -1,12 +1,11 @@
 package actions
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
-	"os/exec"
-	"regexp"
+	"os"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -18,6 +17,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	gitHTTP "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/google/go-github/v32/github"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/graphql"
@@ -28,21 +28,169 @@ type reviewInfo struct {
 	stack.CommitInfo
 	reviewID      string
 	pr            *github.PullRequest
+	createdPR     *github.PullRequest
 	headBranch    string
 	baseBranch    string
 	updatedCommit *object.Commit
 	isUpdated     bool
 	reviewer      *github.Reviewers
+	// titleOverride and bodyOverride replace the PR title and body derived
+	// from the commit message if set, see ReviewOptions.Title.
+	titleOverride string
+	bodyOverride  string
+	// editedTitle and editedBody are the PR title and body as edited with
+	// plz review --edit, used as is if set.
+	editedTitle string
+	editedBody  string
 }
 
-var (
-	reviewerUsernameRegex = regexp.MustCompile(
-		`^[A-Za-z0-9-]+$`,
-	)
-)
+// reviewBranchPrefix is the prefix of the names of branches that plz creates
+// for reviews.
+const reviewBranchPrefix = "plz.review/review/"
+
+// publishAction says what publishing did to the review's PR: created,
+// updated or unchanged.
+func (ri *reviewInfo) publishAction() string {
+	if ri.pr == nil {
+		return "created"
+	} else if ri.isUpdated {
+		return "updated"
+	}
+	return "unchanged"
+}
+
+// prNumber returns the number of the review's PR, whether it already existed
+// or was just created.
+func (ri *reviewInfo) prNumber() int {
+	if ri.pr != nil {
+		return ri.pr.GetNumber()
+	}
+	return ri.createdPR.GetNumber()
+}
+
+// ReviewOptions are the options of RunReview, which correspond to the flags of
+// plz review.
+type ReviewOptions struct {
+	Reviewers []string
+	// RemoveReviewers are reviewers to remove from the PRs' requested
+	// reviewers, like --remove-reviewer.
+	RemoveReviewers []string
+	Assignees       []string
+	Labels          []string
+	Milestone       string
+	// AutoMerge is squash, merge or rebase to enable auto-merge with that
+	// method, or empty to leave auto-merge alone.
+	AutoMerge string
+	StackName string
+	// UpTo publishes only the part of the stack up to this commit, which may
+	// be a revision or a position in the stack, like --up-to.
+	UpTo string
+	// Range publishes only the commits in <base>..<head>, like plz review
+	// <base>..<head>, leaving the commits below base alone. base must be on
+	// the base branch or be the head of an open review.
+	Range string
+	// Base is the branch on origin that the bottom of the stack is based on,
+	// like --base, e.g. the review branch of a teammate's unmerged stack. It
+	// defaults to the default branch.
+	Base string
+	// Branch is a branch to create at the top of the published stack and
+	// check out, like --branch, when HEAD is detached.
+	Branch string
+	// Title and Body, if set, are used for the PR of the top commit, or of
+	// the commit or review that For identifies, instead of the commit
+	// message, like --title, --body and --for. With plz.prBodySync set to
+	// commit, the next plz review without them restores the commit message.
+	Title string
+	Body  string
+	For   string
+	// Draft opens new PRs as drafts, like --draft. plz publish marks them
+	// ready for review.
+	Draft bool
+	// Edit opens the title and body of each new PR in the user's editor
+	// before the PR is created, like --edit.
+	Edit bool
+	// UpdateOnly refuses to publish commits that don't belong to an existing
+	// review, like --update-only, so that no new reviews are created.
+	UpdateOnly bool
+	// Force overwrites review branches that someone else has pushed to since
+	// their latest revision, like --force. The push still only succeeds if
+	// the branch is where GitHub last reported it.
+	Force bool
+	// Autostash stashes uncommitted changes to tracked files before
+	// publishing and restores them afterwards, like --autostash.
+	Autostash bool
+	// NoVerify skips the pre-review hook and commit title checks, like
+	// --no-verify.
+	NoVerify bool
+	DryRun   bool
+	Confirm  bool
+	// Porcelain prints the stable, tab separated format described in the
+	// README instead of the regular output.
+	Porcelain    bool
+	ForceLarge   bool
+	NoSecretScan bool
+}
 
 func Review(c *cli.Context) error {
-	ctx := c.Context
+	if c.NArg() > 1 {
+		return errors.New("usage: plz review [<base>..<head>]")
+	}
+	body := c.String("body")
+	if path := c.String("body-file"); path != "" {
+		if body != "" {
+			return errors.New("--body and --body-file cannot be used together")
+		}
+		var b []byte
+		var err error
+		if path == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		body = string(b)
+	}
+	return RunReview(c.Context, &ReviewOptions{
+		Reviewers:       c.StringSlice("reviewer"),
+		RemoveReviewers: c.StringSlice("remove-reviewer"),
+		Assignees:       c.StringSlice("assignee"),
+		Labels:          c.StringSlice("label"),
+		Milestone:       c.String("milestone"),
+		AutoMerge:       autoMergeMethod(c),
+		StackName:       c.String("stack-name"),
+		UpTo:            c.String("up-to"),
+		Range:           c.Args().First(),
+		Base:            c.String("base"),
+		Branch:          c.String("branch"),
+		Title:           c.String("title"),
+		Body:            body,
+		For:             c.String("for"),
+		Draft:           c.Bool("draft"),
+		Edit:            c.Bool("edit"),
+		UpdateOnly:      c.Bool("update-only"),
+		Force:           c.Bool("force"),
+		Autostash:       autostashFlag(c),
+		NoVerify:        c.Bool("no-verify"),
+		DryRun:          c.Bool("dry-run"),
+		Confirm:         c.Bool("confirm"),
+		Porcelain:       c.Bool("porcelain"),
+		ForceLarge:      c.Bool("force-large"),
+		NoSecretScan:    c.Bool("no-secret-scan"),
+	})
+}
+
+// RunReview publishes the stack under HEAD of the repository in the current
+// directory, like plz review. ctx must carry Deps, see deps.ContextWithDeps.
+func RunReview(ctx context.Context, options *ReviewOptions) error {
+	var porcelain io.Writer
+	if options.Porcelain {
+		if options.DryRun {
+			return errors.New("--porcelain cannot be used with --dry-run")
+		}
+		ctx, porcelain = porcelainContext(ctx)
+	}
 	deps := deps.FromContext(ctx)
 
 	token, err := deps.Auth.Token()
@@ -57,40 +205,122 @@ func Review(c *cli.Context) error {
 		Transport: &authTransport{Token: token},
 	})
 
-	isClean, err := isCleanWorktree(ctx, gitHubRepo)
-	if err != nil {
+	// A dry run doesn't touch the worktree, so it doesn't need to be clean
+	// and nothing is stashed.
+	if !options.DryRun {
+		stash, err := requireCleanWorktree(ctx, options.Autostash)
+		if err != nil {
+			return err
+		}
+		defer applyAutostash(ctx, stash)
+	}
+
+	prBodySync := deps.Config.Get("prBodySync")
+	if prBodySync == "" {
+		prBodySync = prBodySyncCommit
+	}
+	if err := validatePRBodySync(prBodySync); err != nil {
+		return err
+	}
+
+	reviewers := options.Reviewers
+	if err := validateReviewers(ctx, gitHubRepo, reviewers); err != nil {
 		return err
 	}
-	if !isClean {
-		return errors.Errorf("index is not clean")
+	if err := validateReviewersToRemove(options.RemoveReviewers, reviewers); err != nil {
+		return err
 	}
 
-	// Validate reviewer usernames.
-	reviewers := c.StringSlice("reviewer")
-	for _, reviewer := range reviewers {
-		if !reviewerUsernameRegex.MatchString(reviewer) {
-			return errors.Errorf("invalid reviewer username: %q", reviewer)
+	assignees, err := resolveAssignees(ctx, gitHubRepo, options.Assignees)
+	if err != nil {
+		return err
+	}
+
+	stackName := options.StackName
+	if stackName != "" {
+		if err := validateStackName(stackName); err != nil {
+			return err
 		}
-		_, resp, err := gitHubRepo.Client().Users.Get(ctx, reviewer)
+	}
+
+	var milestone *github.Milestone
+	if title := options.Milestone; title != "" {
+		milestone, err = findMilestone(ctx, gitHubRepo, title)
 		if err != nil {
-			if resp.StatusCode == http.StatusNotFound {
-				return errors.Errorf("reviewer %q not found", reviewer)
-			}
-			return errors.WithStack(err)
+			return err
 		}
 	}
 
+	var autoMerge AutoMergeMethod
+	if options.AutoMerge != "" {
+		if err := autoMerge.Set(options.AutoMerge); err != nil {
+			return err
+		}
+	}
+
+	if !options.DryRun {
+		releaseOrphanedReservations(ctx, gitHubRepo, graphqlClient)
+	}
+
 	headRef, err := gitHubRepo.GitRepo().Head()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	deps.DebugLog.Println("HEAD is at", headRef.Hash())
+	deps.GitDebugLog.Println("HEAD is at", headRef.Hash())
+
+	// The stack keeps the base it was last published with, until another is
+	// given.
+	base := options.Base
+	if base == "" {
+		base = loadStackBase(gitHubRepo.GitRepo(), headRef.Name())
+	}
+	if base == "" {
+		base = gitHubRepo.DefaultBranch()
+	} else if err := validateBase(gitHubRepo, base); err != nil {
+		return err
+	}
+	if options.Base != "" && !options.DryRun {
+		saveStackBase(ctx, headRef.Name(), options.Base, gitHubRepo.DefaultBranch())
+	}
+	if options.Branch != "" {
+		if err := validateNewBranch(gitHubRepo.GitRepo(), headRef, options.Branch); err != nil {
+			return err
+		}
+	}
+
+	// When only part of the stack is being published, the commits above the
+	// selected commit are set aside and restacked afterwards.
+	reviewHead := headRef.Hash()
+	var unpublished []*object.Commit
+	stackBase := base
+	if options.Range != "" {
+		if options.UpTo != "" {
+			return errors.New("--up-to cannot be used with a range, give the range's head instead")
+		}
+		r, err := resolveReviewRange(ctx, gitHubRepo, graphqlClient, base, headRef.Hash(), options.Range)
+		if err != nil {
+			return err
+		}
+		reviewHead, unpublished = r.head, r.unpublished
+		base, stackBase = r.prBase, r.stackBase
+		deps.GitDebugLog.Println("publishing", stackBase, "up to", reviewHead)
+	} else if upTo := options.UpTo; upTo != "" {
+		reviewHead, unpublished, err = resolveUpTo(ctx, gitHubRepo, base, headRef.Hash(), upTo)
+		if err != nil {
+			return err
+		}
+		deps.GitDebugLog.Println("publishing up to", reviewHead)
+	}
 
 	ris, err := getReviewInfo(
 		ctx,
 		gitHubRepo,
 		graphqlClient,
-		headRef.Hash(),
+		base,
+		stackBase,
+		reviewHead,
+		options.DryRun,
+		options.UpdateOnly,
 	)
 	if err != nil {
 		return err
@@ -99,29 +329,159 @@ func Review(c *cli.Context) error {
 	if numRIs == 0 {
 		return errors.New("no new commits")
 	}
+	if options.Title != "" || options.Body != "" {
+		ri, err := overriddenReview(gitHubRepo.GitRepo(), ris, options.For)
+		if err != nil {
+			return err
+		}
+		ri.titleOverride = strings.TrimSpace(options.Title)
+		ri.bodyOverride = strings.TrimSpace(options.Body)
+	} else if options.For != "" {
+		return errors.New("--for requires --title, --body or --body-file")
+	}
+	for _, ri := range ris {
+		// Check up front as well as before each push, so that nothing is
+		// published if any branch would be refused.
+		if !isReviewBranch(ri.headBranch) {
+			return errors.Errorf(
+				"PR #%d of review %s has head branch %s, which isn't a plz review branch, so plz won't force-push to it",
+				ri.prNumber(),
+				ri.reviewID,
+				ri.headBranch,
+			)
+		}
+		if !options.Force && ri.pr != nil {
+			err := checkReviewBranchDivergence(
+				ctx,
+				gitHubRepo.GitRepo(),
+				ri.headBranch,
+				ri.lastRevisionHash(),
+				plumbing.NewHash(ri.pr.GetHead().GetSHA()),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
+	defaultBranchCommit, err := gitHubRepo.GitRepo().CommitObject(gitHubRepo.DefaultBranchRef().Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	template, err := loadPRTemplate(defaultBranchCommit, deps.Config.Get("prTemplate"))
+	if err != nil {
+		return err
+	}
+	issues, err := loadIssueLinker(deps.Config)
+	if err != nil {
+		return err
+	}
+	opts := &prOptions{
+		reviewers:       reviewers,
+		removeReviewers: options.RemoveReviewers,
+		assignees:       assignees,
+		labels:          options.Labels,
+		milestone:       milestone,
+		autoMerge:       autoMerge.method,
+		prBodySync:      prBodySync,
+		prTemplate:      template,
+		issues:          issues,
+		draft:           options.Draft,
+	}
+	if err := checkLargeFiles(ctx, gitHubRepo.GitRepo(), ris, options.ForceLarge); err != nil {
+		return err
+	}
+	if !options.NoSecretScan {
+		if err := checkSecrets(ctx, ris); err != nil {
+			return err
+		}
+	}
+	if !options.NoVerify {
+		if err := lintTitles(ctx, ris); err != nil {
+			return err
+		}
+	}
+	if options.DryRun {
+		return printReviewPlan(ctx, deps.InfoLog.Writer(), gitHubRepo, ris, opts)
+	}
+	if !options.NoVerify {
+		if err := runReviewHook(ctx, gitHubRepo.GitRepo(), preReviewHook, ris, stackName); err != nil {
+			return err
+		}
+	}
+	if options.Edit {
+		for _, ri := range ris {
+			if ri.pr == nil {
+				if err := editPR(ri, opts); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := confirmPublish(ctx, options.Confirm, gitHubRepo, ris, opts); err != nil {
+		return err
+	}
+	attestor, err := newAttestor(ctx, gitHubRepo)
+	if err != nil {
+		return err
+	}
 	parentHash := ris[0].Commit.ParentHashes[0]
+	isBranchUpdated := make([]bool, numRIs)
+	pushes := make([]reviewBranchPush, numRIs)
 	for i, ri := range ris {
-		deps.DebugLog.Println("processing", ri.Commit.Hash)
+		deps.StackDebugLog.Println("processing", ri.Commit.Hash)
 		commit := ri.Commit
-		if ri.pr == nil || parentHash != ri.Commit.ParentHashes[0] {
-			deps.DebugLog.Println("commit out of date, creating new commit")
-			commit, err = createCommit(gitHubRepo, ri, parentHash)
+		if ri.pr == nil || parentHash != ri.Commit.ParentHashes[0] || attestor.needsAttestation(ri.Commit) {
+			deps.GitDebugLog.Println("commit out of date, creating new commit")
+			commit, err = createCommit(ctx, gitHubRepo, ri, parentHash, attestor)
 			if err != nil {
 				return err
 			}
 			ri.updatedCommit = commit
-			deps.DebugLog.Println("created new commit", commit.Hash)
+			deps.GitDebugLog.Println("created new commit", commit.Hash)
+		}
+		var expectedRemoteHash plumbing.Hash
+		if ri.pr != nil {
+			expectedRemoteHash = plumbing.NewHash(ri.pr.GetHead().GetSHA())
 		}
-		isBranchUpdated, err := updateReviewBranch(ctx, gitHubRepo, ri.headBranch, commit.Hash)
+		isBranchUpdated[i], err = updateReviewBranch(
+			ctx,
+			gitHubRepo,
+			ri.headBranch,
+			commit.Hash,
+			expectedRemoteHash,
+			ri.lastRevisionHash(),
+			options.Force,
+		)
 		if err != nil {
 			return err
 		}
-		isPRUpdated, err := createOrUpdatePR(ctx, gitHubRepo, ri, reviewers)
+		pushes[i] = reviewBranchPush{
+			branch:             ri.headBranch,
+			hash:               commit.Hash,
+			expectedRemoteHash: expectedRemoteHash,
+		}
+		parentHash = commit.Hash
+	}
+	// All the branches go in one atomic push. Pushing to the branch of an
+	// existing PR creates a new revision, so for the sake of PLZ-1095 the
+	// refspecs are ordered parent first, and the PRs are updated below in the
+	// same order.
+	var toPush []reviewBranchPush
+	for _, push := range pushes {
+		if push.hash != push.expectedRemoteHash {
+			toPush = append(toPush, push)
+		}
+	}
+	if err := pushReviewBranches(ctx, gitHubRepo, toPush); err != nil {
+		return err
+	}
+	for i, ri := range ris {
+		isPRUpdated, err := createOrUpdatePR(ctx, gitHubRepo, ri, opts)
 		if err != nil {
 			return err
 		}
-		ri.isUpdated = isBranchUpdated || isPRUpdated
+		ri.isUpdated = isBranchUpdated[i] || isPRUpdated
 		if i < numRIs-1 && ri.isUpdated {
 			// TODO(PLZ-1095): If plz.review processes the webhook for a child
 			// review's new revision before the webhook for its parent then the
@@ -134,47 +494,197 @@ func Review(c *cli.Context) error {
 			// stack.
 			time.Sleep(time.Millisecond * 500)
 		}
-		parentHash = commit.Hash
 	}
 
-	printReviewInfo(ctx, ris)
+	published := make([]string, len(ris))
+	prNumbers := make([]int, len(ris))
+	for i, ri := range ris {
+		published[i] = ri.reviewID
+		prNumbers[i] = ri.prNumber()
+	}
+	if err := setStackLabels(ctx, gitHubRepo, prNumbers); err != nil {
+		return err
+	}
+	if err := stack.RemoveReservations(gitHubRepo.GitRepo(), published); err != nil {
+		deps.StackDebugLog.Printf("failed to update reserved review IDs: %v", err)
+	}
 
-	headRefName := headRef.Name()
-	if headRefName.IsBranch() {
-		deps.DebugLog.Println("repointing", headRefName, "to", parentHash)
-		err := gitHubRepo.GitRepo().Storer.SetReference(
-			plumbing.NewHashReference(headRefName, parentHash),
-		)
-		if err != nil {
+	if opts.autoMerge != "" {
+		gitHubGraphQLClient := newGitHubGraphQLClient(token)
+		for _, ri := range ris {
+			enableAutoMerge(ctx, gitHubGraphQLClient, ri, opts.autoMerge)
+		}
+	}
+
+	loaded := make(stack.CommitStack, len(ris))
+	for i, ri := range ris {
+		loaded[i] = ri.CommitInfo
+	}
+	if err := stack.LoadStackNames(ctx, graphqlClient, loaded); err != nil {
+		deps.GraphQLDebugLog.Printf("failed to load stack names: %v", err)
+	}
+	if stackName != "" {
+		if err := setStackName(ctx, graphqlClient, ris, stackName); err != nil {
+			return err
+		}
+	} else {
+		for _, ri := range ris {
+			if ri.Review != nil && ri.Review.StackName != "" {
+				stackName = ri.Review.StackName
+			}
+		}
+	}
+
+	if porcelain != nil {
+		if err := writePorcelainReview(porcelain, ris, stackName); err != nil {
 			return err
 		}
+	} else {
+		printReviewInfo(ctx, ris, stackName)
+	}
+
+	notes := map[plumbing.Hash]stack.Note{}
+	for _, ri := range ris {
+		commit := ri.Commit
+		if ri.updatedCommit != nil {
+			commit = ri.updatedCommit
+		}
+		note := stack.Note{
+			ReviewID:  ri.reviewID,
+			GitHubPR:  ri.prNumber(),
+			Status:    stack.ReviewStatusOpen,
+			StackName: stackName,
+		}
+		if !ri.isUpdated && ri.Review != nil && ri.Review.LocalRevision != nil {
+			note.Revision = ri.Review.LocalRevision.Number
+		}
+		notes[commit.Hash] = note
+	}
+	if err := stack.WriteNotes(gitHubRepo.GitRepo(), notes); err != nil {
+		deps.GitDebugLog.Printf("failed to write notes: %v", err)
+	}
+	// The notes of reviews that plz.review has already processed are
+	// rewritten with their revisions.
+	savePublishedStack(ctx, gitHubRepo.GitRepo(), graphqlClient, ris, stackName)
+
+	if deps.Config.GetBool("watchPR", false) {
+		for _, ri := range ris {
+			err := mirrorReviewToGitHub(ctx, gitHubRepo, graphqlClient, ri.reviewID, ri.prNumber())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if parentHash != reviewHead {
+		for i := len(unpublished) - 1; i >= 0; i-- {
+			commit := unpublished[i]
+			restacked, err := writeCommit(ctx, gitHubRepo.GitRepo(), commit, commit.Message, parentHash)
+			if err != nil {
+				return err
+			}
+			deps.GitDebugLog.Println("restacked", commit.Hash, "as", restacked.Hash)
+			parentHash = restacked.Hash
+		}
+	} else if len(unpublished) > 0 {
+		parentHash = headRef.Hash()
 	}
 
+	if err := updateHead(ctx, gitHubRepo.GitRepo(), headRef, parentHash, options.Branch); err != nil {
+		return err
+	}
+
+	if err := runReviewHook(ctx, gitHubRepo.GitRepo(), postReviewHook, ris, stackName); err != nil {
+		deps.ErrorLog.Printf("warning: %v", err)
+	}
 	return nil
 }
 
-func isCleanWorktree(ctx context.Context, gitHubRepo *gitHubRepo) (bool, error) {
-	// Worktree.Status() is very slow so fall back to the command line instead.
-	// https://github.com/go-git/go-git/issues/181
-	cmd := exec.Command("git", "status", "--porcelain")
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	err := cmd.Run()
-	if err != nil {
-		var exitErr exec.ExitError
-		if errors.As(err, &exitErr) {
-			return false, errors.Errorf("git status failed: %s", exitErr.Stderr)
+// validateNewBranch checks that plz review --branch can create the given
+// branch, before anything is published.
+func validateNewBranch(repo *git.Repository, headRef *plumbing.Reference, branch string) error {
+	if headRef.Name().IsBranch() {
+		return errors.Errorf("--branch can only be used when HEAD is detached, HEAD is %s", headRef.Name().Short())
+	}
+	_, err := repo.Reference(plumbing.NewBranchReferenceName(branch), false)
+	if err == nil {
+		return errors.Errorf("branch %s already exists", branch)
+	} else if err != plumbing.ErrReferenceNotFound {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// updateHead points HEAD's branch at the given commit once a stack has been
+// published. If HEAD is detached, HEAD itself is moved, or, if branch is set,
+// a new branch is created at the commit and checked out. The commit has the
+// same tree as HEAD, so the worktree doesn't change.
+func updateHead(
+	ctx context.Context,
+	repo *git.Repository,
+	headRef *plumbing.Reference,
+	hash plumbing.Hash,
+	branch string,
+) error {
+	deps := deps.FromContext(ctx)
+
+	headRefName := headRef.Name()
+	if headRefName.IsBranch() {
+		deps.GitDebugLog.Println("repointing", headRefName, "to", hash)
+		return errors.WithStack(repo.Storer.SetReference(plumbing.NewHashReference(headRefName, hash)))
+	}
+	if branch != "" {
+		branchRefName := plumbing.NewBranchReferenceName(branch)
+		deps.GitDebugLog.Println("creating", branchRefName, "at", hash)
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(branchRefName, hash)); err != nil {
+			return errors.WithStack(err)
 		}
-		return false, errors.WithStack(err)
+		err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branchRefName))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		deps.InfoLog.Printf("Switched to new branch %s", branch)
+		return nil
+	}
+	if hash == headRef.Hash() {
+		return nil
+	}
+	deps.GitDebugLog.Println("moving detached HEAD to", hash)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash)); err != nil {
+		return errors.WithStack(err)
+	}
+	deps.ErrorLog.Printf(
+		"HEAD is detached at %s, the published stack; to keep working on it, create a branch with git switch -c <branch>",
+		shortSHA(hash.String()),
+	)
+	return nil
+}
+
+// validateBase checks that the --base of plz review is a branch on origin,
+// since it becomes the base branch of the PR at the bottom of the stack.
+func validateBase(gitHubRepo *gitHubRepo, base string) error {
+	refName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, base)
+	_, err := gitHubRepo.GitRepo().Reference(refName, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return errors.Errorf(
+			"--base must be a branch on %s, cannot find %s/%s; fetch or push it first",
+			git.DefaultRemoteName,
+			git.DefaultRemoteName,
+			base,
+		)
 	}
-	return stdout.Len() == 0, nil
+	return errors.WithStack(err)
 }
 
 func getReviewInfo(
 	ctx context.Context,
 	gitHubRepo *gitHubRepo,
 	graphqlClient *graphql.Client,
+	base string,
+	stackBase string,
 	headHash plumbing.Hash,
+	dryRun bool,
+	updateOnly bool,
 ) ([]*reviewInfo, error) {
 	deps := deps.FromContext(ctx)
 
@@ -183,7 +693,7 @@ func getReviewInfo(
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, stackBase)
 	if err != nil {
 		return nil, err
 	}
@@ -213,21 +723,59 @@ func getReviewInfo(
 		if ri.pr != nil {
 			statusMessage = "reviewID: " + ri.Review.ID + " pr: " + ri.pr.GetHTMLURL()
 		}
-		deps.DebugLog.Println("examined", ci.Commit.Hash, statusMessage)
+		deps.StackDebugLog.Println("examined", ci.Commit.Hash, statusMessage)
 	}
 	// Reverse the array so the tip commit is at the end
 	for i, j := 0, len(ris)-1; i < j; i, j = i+1, j-1 {
 		ris[i], ris[j] = ris[j], ris[i]
 	}
 
+	if updateOnly {
+		// Check before any review IDs are reserved, since none are needed.
+		if err := checkUpdateOnly(ctx, ris); err != nil {
+			return nil, err
+		}
+	}
+
+	reservations, err := stack.Reservations(repo)
+	if err != nil {
+		return nil, err
+	}
+	reserved := map[string]bool{}
+	for _, r := range reservations {
+		reserved[r.ID] = true
+	}
 	numNewReviews := 0
 	for _, ri := range ris {
-		if ri.reviewID == "" {
-			numNewReviews++
+		if ri.reviewID != "" {
+			continue
 		}
+		// Commits may already have trailers with IDs reserved for them but
+		// not yet published, e.g. by the commit-msg hook installed by plz
+		// init-hooks, or by a run of plz review that failed part way through.
+		// The latter are recorded, the rest are checked with the server.
+		if id := stack.ReviewIDFromCommitMessage(ri.Commit.Message); id != "" {
+			if reserved[id] || isReservedReviewID(ctx, graphqlClient, id) {
+				deps.StackDebugLog.Println("using unpublished review ID", id, "for", ri.Commit.Hash)
+				ri.reviewID = id
+				ri.headBranch = reviewBranchPrefix + id
+				continue
+			}
+			deps.ErrorLog.Printf(
+				"warning: commit %s has a trailer for review %s, which isn't a reserved review, publishing it as a new review",
+				shortSHA(ri.Commit.Hash.String()),
+				id,
+			)
+		}
+		numNewReviews++
 	}
 	var reservedIDs []string
-	if numNewReviews != 0 {
+	if numNewReviews != 0 && dryRun {
+		// Don't reserve IDs for a dry run, just use placeholders.
+		for i := 0; i < numNewReviews; i++ {
+			reservedIDs = append(reservedIDs, fmt.Sprintf("<new-%d>", i+1))
+		}
+	} else if numNewReviews != 0 {
 		var mutation struct {
 			ReserveReviewIDs []string `graphql:"reserveReviewIDs(count: $count)"`
 		}
@@ -238,14 +786,17 @@ func getReviewInfo(
 			return nil, errors.WithStack(err)
 		}
 		reservedIDs = mutation.ReserveReviewIDs
-		deps.DebugLog.Println("reserved review IDs:", reservedIDs)
+		deps.StackDebugLog.Println("reserved review IDs:", reservedIDs)
+		if err := stack.AddReservations(repo, reservedIDs); err != nil {
+			deps.StackDebugLog.Printf("failed to record reserved review IDs: %v", err)
+		}
 	}
-	baseBranch := gitHubRepo.DefaultBranch()
+	baseBranch := base
 	for _, ri := range ris {
 		if ri.reviewID == "" {
 			ri.reviewID, reservedIDs = reservedIDs[0], reservedIDs[1:]
-			ri.headBranch = fmt.Sprintf("plz.review/review/%s", ri.reviewID)
-		} else {
+			ri.headBranch = reviewBranchPrefix + ri.reviewID
+		} else if ri.pr != nil {
 			ri.headBranch = ri.pr.Head.GetRef()
 		}
 		ri.baseBranch = baseBranch
@@ -254,31 +805,90 @@ func getReviewInfo(
 	return ris, nil
 }
 
+// checkUpdateOnly reports every commit that isn't part of an existing review,
+// including commits with trailers for review IDs that were reserved but never
+// published, and fails if there are any, for plz review --update-only.
+func checkUpdateOnly(ctx context.Context, ris []*reviewInfo) error {
+	deps := deps.FromContext(ctx)
+	numNew := 0
+	for _, ri := range ris {
+		if ri.reviewID != "" {
+			continue
+		}
+		deps.ErrorLog.Printf("%s %q: no review", shortSHA(ri.Commit.Hash.String()), commitTitle(ri.Commit.Message))
+		numNew++
+	}
+	if numNew > 0 {
+		return errors.Errorf(
+			"%d commits aren't part of a review and --update-only doesn't create reviews, leave it out to create them or use --up-to to stop below them",
+			numNew,
+		)
+	}
+	return nil
+}
+
+// reviewTrailerStyle returns the style of the trailers that identify the
+// review of each commit, from plz.reviewTrailer.
+func reviewTrailerStyle(ctx context.Context) (string, error) {
+	switch style := deps.FromContext(ctx).Config.Get("reviewTrailer"); style {
+	case "":
+		return stack.ReviewTrailerURL, nil
+	case stack.ReviewTrailerURL, stack.ReviewTrailerChangeID, stack.ReviewTrailerBoth:
+		return style, nil
+	default:
+		return "", errors.Errorf("invalid plz.reviewTrailer value %q, must be url, change-id or both", style)
+	}
+}
+
 func createCommit(
+	ctx context.Context,
 	gitHubRepo *gitHubRepo,
 	ri *reviewInfo,
 	parentHash plumbing.Hash,
+	attestor *attestor,
 ) (*object.Commit, error) {
-	repo := gitHubRepo.GitRepo()
 	message := ri.Commit.Message
-	if ri.pr == nil {
-		message = strings.TrimRightFunc(ri.Commit.Message, unicode.IsSpace) +
-			"\n\nplz-review-url: https://plz.review/review/" + ri.reviewID
+	if ri.pr == nil && stack.ReviewIDFromCommitMessage(message) != ri.reviewID {
+		style, err := reviewTrailerStyle(ctx)
+		if err != nil {
+			return nil, err
+		}
+		message = strings.TrimRightFunc(stack.StripReviewID(ri.Commit.Message), unicode.IsSpace) +
+			"\n\n" + stack.ReviewTrailers(ri.reviewID, style)
+	}
+	if attestor != nil {
+		var err error
+		message, err = attestor.attest(message, ri.reviewID, ri.Commit.Hash.String())
+		if err != nil {
+			return nil, err
+		}
 	}
+	return writeCommit(ctx, gitHubRepo.GitRepo(), ri.Commit, message, parentHash)
+}
+
+// writeCommit stores a copy of the given commit with a new message and first
+// parent, signed if Git is set up to sign commits. The tree and the other
+// parents of merge commits are left unchanged.
+func writeCommit(
+	ctx context.Context,
+	repo *git.Repository,
+	commit *object.Commit,
+	message string,
+	parentHash plumbing.Hash,
+) (*object.Commit, error) {
 	newCommit := &object.Commit{
-		Author:       ri.Commit.Author,
-		Committer:    ri.Commit.Committer,
+		Author:       commit.Author,
+		Committer:    commit.Committer,
 		Message:      message,
-		TreeHash:     ri.Commit.TreeHash,
+		TreeHash:     commit.TreeHash,
 		ParentHashes: []plumbing.Hash{parentHash},
 	}
-	obj := repo.Storer.NewEncodedObject()
-	if err := newCommit.Encode(obj); err != nil {
-		return nil, errors.WithStack(err)
+	if len(commit.ParentHashes) > 1 {
+		newCommit.ParentHashes = append(newCommit.ParentHashes, commit.ParentHashes[1:]...)
 	}
-	hash, err := repo.Storer.SetEncodedObject(obj)
+	hash, err := storeCommit(ctx, repo, newCommit)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 	updatedCommit, err := repo.CommitObject(hash)
 	if err != nil {
@@ -287,25 +897,52 @@ func createCommit(
 	return updatedCommit, nil
 }
 
+// isReviewBranch reports whether branch is named like the branches that plz
+// creates for reviews.
+func isReviewBranch(branch string) bool {
+	reviewID := strings.TrimPrefix(branch, reviewBranchPrefix)
+	return reviewID != branch && reviewID != "" && !strings.Contains(reviewID, "/")
+}
+
 func updateReviewBranch(
 	ctx context.Context,
 	gitHubRepo *gitHubRepo,
 	reviewBranch string,
 	hash plumbing.Hash,
+	expectedRemoteHash plumbing.Hash,
+	lastRevisionHash plumbing.Hash,
+	force bool,
 ) (bool, error) {
 	deps := deps.FromContext(ctx)
 	repo := gitHubRepo.GitRepo()
 	isUpdated := false
+	// The branch is overwritten locally and force-pushed, so make sure it's
+	// one of ours rather than, e.g. the head branch of a PR opened by hand.
+	if !isReviewBranch(reviewBranch) {
+		return false, errors.Errorf(
+			"refusing to overwrite branch %s, which isn't a plz review branch named %s<review ID>",
+			reviewBranch,
+			reviewBranchPrefix,
+		)
+	}
+	// Nor should it throw away commits that someone else pushed, unless
+	// forced to.
+	if !force {
+		err := checkReviewBranchDivergence(ctx, repo, reviewBranch, lastRevisionHash, expectedRemoteHash)
+		if err != nil {
+			return false, err
+		}
+	}
 	// Overwrite the branch
 	headRef := "refs/heads/" + reviewBranch
-	deps.DebugLog.Println("examining reference", headRef)
+	deps.PushDebugLog.Println("examining reference", headRef)
 	refName := plumbing.ReferenceName(headRef)
 	ref, err := repo.Storer.Reference(refName)
 	if err != nil && err != plumbing.ErrReferenceNotFound {
 		return false, errors.WithStack(err)
 	}
 	if err == plumbing.ErrReferenceNotFound || ref.Hash() != hash {
-		deps.DebugLog.Println("updating reference", headRef, "to", hash)
+		deps.PushDebugLog.Println("updating reference", headRef, "to", hash)
 		err := repo.Storer.SetReference(
 			plumbing.NewHashReference(refName, hash),
 		)
@@ -314,50 +951,217 @@ func updateReviewBranch(
 		}
 		isUpdated = true
 	} else {
-		deps.DebugLog.Println("reference already up to date")
+		deps.PushDebugLog.Println("reference already up to date")
+	}
+	// The branch is pushed along with the rest of the stack's by
+	// pushReviewBranches, which updates the remote unless it's already there.
+	return isUpdated || expectedRemoteHash != hash, nil
+}
+
+// savePublishedStack caches the reviews as they are now that they've been
+// published, keyed by the commits that were pushed rather than the ones the
+// stack was loaded from, so that plz status --cached shows them. Reviews whose
+// new revisions plz.review hasn't processed yet are cached as modified until
+// the stack is next loaded from the API.
+func savePublishedStack(
+	ctx context.Context,
+	repo *git.Repository,
+	graphqlClient *graphql.Client,
+	ris []*reviewInfo,
+	stackName string,
+) {
+	deps := deps.FromContext(ctx)
+	commits := make([]stack.RemoteCommit, len(ris))
+	for i, ri := range ris {
+		commit := ri.Commit
+		if ri.updatedCommit != nil {
+			commit = ri.updatedCommit
+		}
+		commits[i] = stack.RemoteCommit{
+			ReviewID: ri.reviewID,
+			Commit:   commit,
+			Parent:   &object.Commit{Hash: commit.ParentHashes[0]},
+		}
 	}
+	published, err := stack.LoadRemote(ctx, graphqlClient, commits)
+	if err != nil {
+		deps.GraphQLDebugLog.Printf("failed to load the published reviews: %v", err)
+		return
+	}
+	for _, ci := range published {
+		if ci.Review != nil {
+			ci.Review.StackName = stackName
+		}
+	}
+	stack.Save(ctx, repo, published)
+}
+
+// reviewBranchPush is a review branch for pushReviewBranches to push to
+// hash, and the commit it's expected to be at on the remote, or the zero hash
+// if it may be anywhere.
+type reviewBranchPush struct {
+	branch             string
+	hash               plumbing.Hash
+	expectedRemoteHash plumbing.Hash
+}
 
-	// Push the branch to the remote
-	refSpec := fmt.Sprintf("%[1]s:%[1]s", headRef)
-	deps.DebugLog.Println("pushing with refspec", refSpec)
-	err = repo.PushContext(ctx, &git.PushOptions{
+// pushReviewBranches force-pushes the local review branches to the remote in
+// a single atomic push, in the given order, so that many branches cost one
+// listing of the remote and one push rather than one each. If the server
+// rejects the push for its size, the branches are pushed one at a time
+// instead. Any other failure is returned as is, since e.g. bad credentials
+// would fail every push.
+func pushReviewBranches(ctx context.Context, gitHubRepo *gitHubRepo, pushes []reviewBranchPush) error {
+	deps := deps.FromContext(ctx)
+	if len(pushes) == 0 {
+		return nil
+	}
+	if err := checkRemoteReviewBranches(ctx, gitHubRepo, pushes); err != nil {
+		return err
+	}
+	err := pushReviewBranchesOnce(ctx, gitHubRepo, pushes)
+	if err == nil || len(pushes) == 1 || !isPushTooLarge(err) {
+		return err
+	}
+	deps.PushDebugLog.Printf("pushing %d review branches at once was too large, pushing them one at a time: %v", len(pushes), err)
+	for _, push := range pushes {
+		if err := pushReviewBranchesOnce(ctx, gitHubRepo, []reviewBranchPush{push}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPushTooLarge returns whether a push failed because the server refused a
+// request that large, with HTTP status 413, which go-git reports as an
+// unexpected error wrapping the response.
+func isPushTooLarge(err error) bool {
+	var unexpectedErr *plumbing.UnexpectedError
+	if !errors.As(err, &unexpectedErr) {
+		return false
+	}
+	httpErr, ok := unexpectedErr.Err.(*gitHTTP.Err)
+	return ok && httpErr.StatusCode() == http.StatusRequestEntityTooLarge
+}
+
+// pushReviewBranchesOnce pushes the given review branches in one atomic
+// push. Each branch that's expected to be at a particular commit is only
+// overwritten if it still is, so that concurrent publishes of the same review,
+// e.g. from two machines, don't silently clobber each other.
+func pushReviewBranchesOnce(ctx context.Context, gitHubRepo *gitHubRepo, pushes []reviewBranchPush) error {
+	deps := deps.FromContext(ctx)
+	pushOptions := &git.PushOptions{
 		RemoteName: git.DefaultRemoteName,
-		RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
 		Auth:       gitHubRepo.GitAuth(),
 		Force:      true,
-	})
+		Atomic:     true,
+	}
+	for _, push := range pushes {
+		headRef := plumbing.NewBranchReferenceName(push.branch)
+		refSpec := fmt.Sprintf("%[1]s:%[1]s", headRef)
+		deps.PushDebugLog.Println("pushing with refspec", refSpec)
+		pushOptions.RefSpecs = append(pushOptions.RefSpecs, config.RefSpec(refSpec))
+		if !push.expectedRemoteHash.IsZero() {
+			deps.PushDebugLog.Println("requiring", headRef, "to be at", push.expectedRemoteHash)
+			pushOptions.RequireRemoteRefs = append(
+				pushOptions.RequireRemoteRefs,
+				config.RefSpec(fmt.Sprintf("%s:%s", push.expectedRemoteHash, headRef)),
+			)
+		}
+	}
+	what := "push of " + pushes[0].branch
+	if len(pushes) > 1 {
+		what = fmt.Sprintf("push of %d review branches", len(pushes))
+	}
+	pushCtx, cancel := withPushTimeout(ctx)
+	err := gitHubRepo.GitRepo().PushContext(pushCtx, pushOptions)
+	cancel()
+	if timeoutErr := pushTimeoutError(pushCtx, what); timeoutErr != nil {
+		return timeoutErr
+	}
 	if err == git.NoErrAlreadyUpToDate {
-		deps.DebugLog.Println("remote reference already up to date")
-	} else if err != nil {
-		return false, errors.WithStack(err)
-	} else {
-		isUpdated = true
+		deps.PushDebugLog.Println("remote references already up to date")
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+// checkRemoteReviewBranches fails if any of the review branches that are
+// expected to be at a particular commit on the remote aren't. The push itself
+// also requires them to be, which catches a branch moving in between, but
+// go-git only reports that as an untyped error.
+func checkRemoteReviewBranches(ctx context.Context, gitHubRepo *gitHubRepo, pushes []reviewBranchPush) error {
+	deps := deps.FromContext(ctx)
+	expected := map[plumbing.ReferenceName]plumbing.Hash{}
+	for _, push := range pushes {
+		if !push.expectedRemoteHash.IsZero() {
+			expected[plumbing.NewBranchReferenceName(push.branch)] = push.expectedRemoteHash
+		}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+	remote, err := gitHubRepo.GitRepo().Remote(git.DefaultRemoteName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	listCtx, cancel := withPushTimeout(ctx)
+	refs, err := remote.ListContext(listCtx, &git.ListOptions{Auth: gitHubRepo.GitAuth()})
+	cancel()
+	if timeoutErr := pushTimeoutError(listCtx, "listing the review branches on "+git.DefaultRemoteName); timeoutErr != nil {
+		return timeoutErr
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	actual := map[plumbing.ReferenceName]plumbing.Hash{}
+	for _, ref := range refs {
+		actual[ref.Name()] = ref.Hash()
 	}
-	return isUpdated, nil
+	for _, push := range pushes {
+		refName := plumbing.NewBranchReferenceName(push.branch)
+		want, ok := expected[refName]
+		if !ok || actual[refName] == want {
+			continue
+		}
+		deps.PushDebugLog.Println(refName, "is at", actual[refName], "on the remote, expected", want)
+		return errors.Errorf(
+			"review branch %s was updated elsewhere since this run started, expected it at %s; run plz sync to pick up those changes and then run plz review again",
+			push.branch,
+			shortSHA(want.String()),
+		)
+	}
+	return nil
+}
+
+// prOptions controls how createOrUpdatePR creates and updates PRs.
+type prOptions struct {
+	reviewers       []string
+	removeReviewers []string
+	assignees       []string
+	labels          []string
+	milestone       *github.Milestone
+	autoMerge       string
+	prBodySync      string
+	prTemplate      *prTemplate
+	issues          *issueLinker
+	// draft opens new PRs as drafts.
+	draft bool
 }
 
 func createOrUpdatePR(
 	ctx context.Context,
 	gitHubRepo *gitHubRepo,
 	ri *reviewInfo,
-	reviewers []string,
+	opts *prOptions,
 ) (bool, error) {
 	var prCreatedOrUpdated bool
 	deps := deps.FromContext(ctx)
-	message := ri.Commit.Message
-	if ri.updatedCommit != nil {
-		message = ri.updatedCommit.Message
-	}
-	parts := strings.SplitN(message, "\n", 2)
-	title := strings.TrimSpace(parts[0])
-	body := ""
-	if len(parts) > 1 {
-		body = strings.TrimSpace(parts[1])
-	}
+	title, body := prTitleAndBody(ri, opts)
+	reviewersToAdd := reviewersToRequest(ri, opts.reviewers)
 	var prNumber int
-	var reviewersToAdd []string
 	if ri.pr == nil {
-		deps.DebugLog.Println("creating PR for head branch", ri.headBranch)
+		deps.APIDebugLog.Println("creating PR for head branch", ri.headBranch)
 		prCreated, _, err := gitHubRepo.Client().PullRequests.Create(
 			ctx,
 			gitHubRepo.Owner(),
@@ -367,41 +1171,46 @@ func createOrUpdatePR(
 				Base:  &ri.baseBranch,
 				Title: &title,
 				Body:  &body,
+				Draft: &opts.draft,
 			},
 		)
-		if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusUnprocessableEntity {
+			// A PR may already exist for the branch, e.g. if it was created
+			// by hand or by a previous run that failed part way through. If
+			// so, adopt it and update it like any other existing PR.
+			adopted, findErr := adoptExistingPR(ctx, gitHubRepo, ri)
+			if findErr != nil {
+				return true, findErr
+			}
+			if !adopted {
+				return true, errors.WithStack(err)
+			}
+			title, body = prTitleAndBody(ri, opts)
+			reviewersToAdd = reviewersToRequest(ri, opts.reviewers)
+		} else if err != nil {
 			return true, errors.WithStack(err)
+		} else {
+			ri.createdPR = prCreated
+			prNumber = prCreated.GetNumber()
+			prCreatedOrUpdated = true
 		}
-		prNumber = prCreated.GetNumber()
-		reviewersToAdd = reviewers
-		prCreatedOrUpdated = true
-	} else {
+	}
+	if ri.pr != nil {
 		prNumber = ri.pr.GetNumber()
-		if len(reviewers) > 0 {
-			for _, r := range reviewers {
-				needToAdd := true
-				for _, existingReviewer := range ri.reviewer.Users {
-					if existingReviewer.GetLogin() == r {
-						needToAdd = false
-						break
-					}
-				}
-				if needToAdd {
-					reviewersToAdd = append(reviewersToAdd, r)
-				}
-			}
-		}
 	}
 
 	if ri.pr != nil && (ri.pr.Base.GetRef() != ri.baseBranch || ri.pr.GetTitle() != title || ri.pr.GetBody() != body) {
-		deps.DebugLog.Println("PR", ri.pr.GetHTMLURL(), "is out of date, updating")
+		deps.APIDebugLog.Println("PR", ri.pr.GetHTMLURL(), "is out of date, updating")
 		_, _, err := gitHubRepo.Client().PullRequests.Edit(
 			ctx,
 			gitHubRepo.Owner(),
 			gitHubRepo.Name(),
 			ri.pr.GetNumber(),
 			&github.PullRequest{
-				Base: &github.PullRequestBranch{Ref: &ri.baseBranch},
+				Base:  &github.PullRequestBranch{Ref: &ri.baseBranch},
+				Title: &title,
+				Body:  &body,
 			},
 		)
 		if err != nil {
@@ -411,15 +1220,13 @@ func createOrUpdatePR(
 	}
 
 	if len(reviewersToAdd) > 0 {
-		deps.DebugLog.Println("Adding reviewers ", reviewersToAdd, "to PR", ri.pr.GetHTMLURL())
+		deps.APIDebugLog.Println("Adding reviewers ", reviewersToAdd, "to PR", ri.pr.GetHTMLURL())
 		_, _, err := gitHubRepo.Client().PullRequests.RequestReviewers(
 			ctx,
 			gitHubRepo.Owner(),
 			gitHubRepo.Name(),
 			prNumber,
-			github.ReviewersRequest{
-				Reviewers: reviewersToAdd,
-			},
+			newReviewersRequest(reviewersToAdd),
 		)
 		if err != nil {
 			return true, errors.WithStack(err)
@@ -427,12 +1234,168 @@ func createOrUpdatePR(
 		prCreatedOrUpdated = true
 	}
 
-	deps.DebugLog.Println("PR", ri.pr.GetHTMLURL(), "is up to date")
+	if reviewersToRemove := reviewersToRemove(ri, opts.removeReviewers); len(reviewersToRemove) > 0 {
+		deps.APIDebugLog.Println("Removing reviewers", reviewersToRemove, "from PR", ri.pr.GetHTMLURL())
+		_, err := gitHubRepo.Client().PullRequests.RemoveReviewers(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			prNumber,
+			newReviewersRequest(reviewersToRemove),
+		)
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+		prCreatedOrUpdated = true
+	}
+
+	isLabelsUpdated, err := syncLabels(ctx, gitHubRepo, ri, opts)
+	if err != nil {
+		return true, err
+	}
+	prCreatedOrUpdated = prCreatedOrUpdated || isLabelsUpdated
+
+	isAssigneesUpdated, err := syncAssignees(ctx, gitHubRepo, ri, opts)
+	if err != nil {
+		return true, err
+	}
+	prCreatedOrUpdated = prCreatedOrUpdated || isAssigneesUpdated
+
+	isMilestoneUpdated, err := syncMilestone(ctx, gitHubRepo, ri, opts)
+	if err != nil {
+		return true, err
+	}
+	prCreatedOrUpdated = prCreatedOrUpdated || isMilestoneUpdated
+
+	deps.APIDebugLog.Println("PR", ri.pr.GetHTMLURL(), "is up to date")
 	return prCreatedOrUpdated, nil
 }
 
-func printReviewInfo(ctx context.Context, ris []*reviewInfo) {
+// adoptExistingPR looks for an open PR for the review's head branch and, if
+// there is one, makes it the review's PR.
+func adoptExistingPR(ctx context.Context, gitHubRepo *gitHubRepo, ri *reviewInfo) (bool, error) {
+	deps := deps.FromContext(ctx)
+	prs, _, err := gitHubRepo.Client().PullRequests.List(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		&github.PullRequestListOptions{
+			State: "open",
+			Head:  gitHubRepo.Owner() + ":" + ri.headBranch,
+		},
+	)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if len(prs) == 0 {
+		return false, nil
+	}
+	pr := prs[0]
+	reviewers, _, err := gitHubRepo.Client().PullRequests.ListReviewers(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		pr.GetNumber(),
+		&github.ListOptions{},
+	)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	deps.InfoLog.Printf("adopting existing PR %s for review %s", pr.GetHTMLURL(), ri.reviewID)
+	ri.pr = pr
+	ri.reviewer = reviewers
+	return true, nil
+}
+
+// prTitleAndBody returns the title and body that the review's PR should have.
+func prTitleAndBody(ri *reviewInfo, opts *prOptions) (string, string) {
+	if ri.editedTitle != "" {
+		return ri.editedTitle, ri.editedBody
+	}
+	message := ri.Commit.Message
+	if ri.updatedCommit != nil {
+		message = ri.updatedCommit.Message
+	}
+	parts := strings.SplitN(message, "\n", 2)
+	title := strings.TrimSpace(parts[0])
+	body := ""
+	if len(parts) > 1 {
+		body = strings.TrimSpace(parts[1])
+	}
+	policy := opts.prBodySync
+	if ri.bodyOverride != "" {
+		// An explicit body is applied even if the PR is otherwise left alone.
+		body = ri.bodyOverride
+		if policy == prBodySyncPR {
+			policy = prBodySyncCommit
+		}
+	}
+	body = opts.issues.apply(body, message)
+	title, body = syncPRTitleAndBody(policy, ri.pr, opts.prTemplate, title, body)
+	if ri.titleOverride != "" {
+		title = ri.titleOverride
+	} else if policy != opts.prBodySync && ri.pr != nil {
+		title = ri.pr.GetTitle()
+	}
+	return title, body
+}
+
+// editPR opens the title and body that the review's new PR would be created
+// with in the user's editor, and uses the result instead.
+func editPR(ri *reviewInfo, opts *prOptions) error {
+	title, body := prTitleAndBody(ri, opts)
+	edited, err := editTextAbove(
+		strings.TrimSpace(title+"\n\n"+body),
+		fmt.Sprintf(
+			"Editing the PR for %s %s.\nThe first line is the title and the rest is the description.\nAn empty title aborts plz review.",
+			shortSHA(ri.Commit.Hash.String()),
+			commitTitle(ri.Commit.Message),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(edited, "\n", 2)
+	ri.editedTitle = strings.TrimSpace(parts[0])
+	if ri.editedTitle == "" {
+		return errors.New("aborting plz review due to empty PR title")
+	}
+	ri.editedBody = ""
+	if len(parts) > 1 {
+		ri.editedBody = strings.TrimSpace(parts[1])
+	}
+	return nil
+}
+
+// overriddenReview returns the review whose PR title and body are set by plz
+// review --title and --body: the one identified by forArg, a review ID or
+// commit, or the top of the stack if forArg is empty.
+func overriddenReview(repo *git.Repository, ris []*reviewInfo, forArg string) (*reviewInfo, error) {
+	if forArg == "" {
+		return ris[len(ris)-1], nil
+	}
+	for _, ri := range ris {
+		if ri.reviewID == forArg {
+			return ri, nil
+		}
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(forArg))
+	if err != nil {
+		return nil, errors.Errorf("cannot resolve %q to a commit", forArg)
+	}
+	for _, ri := range ris {
+		if ri.Commit.Hash == *hash {
+			return ri, nil
+		}
+	}
+	return nil, errors.Errorf("commit %s is not in the stack being published", shortSHA(hash.String()))
+}
+
+func printReviewInfo(ctx context.Context, ris []*reviewInfo, stackName string) {
 	deps := deps.FromContext(ctx)
+	if stackName != "" {
+		deps.InfoLog.Printf("stack %s:", stackName)
+	}
 	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
 	for i := len(ris) - 1; i >= 0; i-- {
 		ri := ris[i]
@@ -442,12 +1405,7 @@ func printReviewInfo(ctx context.Context, ris []*reviewInfo) {
 			title = title[:47] + "..."
 		}
 		reviewURL := "https://plz.review/review/" + ri.reviewID
-		status := "unchanged"
-		if ri.pr == nil {
-			status = "created"
-		} else if ri.isUpdated {
-			status = "updated"
-		}
+		status := ri.publishAction()
 		commit := ri.Commit
 		if ri.updatedCommit != nil {
 			commit = ri.updatedCommit
@@ -0,0 +1,113 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// describeReviewBranchSync compares the local review branch of an open review, its
+// remote-tracking branch and the head of its latest revision, and summarizes
+// any differences for plz status, e.g. "local 1 ahead" when a push didn't go
+// through, or "origin 2 ahead" when someone else pushed to the branch. rb is
+// the remote-tracking branch chosen by resolveRemoteBranches, or nil to use
+// the one on remote. It returns an empty string if the branches agree.
+func describeReviewBranchSync(
+	ctx context.Context,
+	repo *git.Repository,
+	ci stack.CommitInfo,
+	remote string,
+	rb *remoteBranch,
+) string {
+	deps := deps.FromContext(ctx)
+	review := ci.Review
+	if review == nil || review.Status != stack.ReviewStatusOpen || review.HeadBranch == "" {
+		return ""
+	}
+	latest := plumbing.NewHash(review.LatestRevision.HeadCommitSHA)
+	if latest.IsZero() {
+		return ""
+	}
+	var remoteHash plumbing.Hash
+	if rb != nil {
+		remote, remoteHash = rb.remote, rb.hash
+	} else if remote != "" {
+		ref, err := repo.Reference(plumbing.NewRemoteReferenceName(remote, review.HeadBranch), true)
+		if err == nil {
+			remoteHash = ref.Hash()
+		}
+	}
+
+	var parts []string
+	// The local branch is what plz review last tried to push, so compare it
+	// with the remote, or with the latest revision if there's no remote copy.
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(review.HeadBranch), true)
+	if err == nil {
+		pushed := remoteHash
+		if pushed.IsZero() {
+			pushed = latest
+		}
+		if ref.Hash() != pushed {
+			parts = append(parts, "local "+describeAheadBehind(ctx, ref.Hash(), pushed))
+		}
+	}
+	if !remoteHash.IsZero() && remoteHash != latest {
+		parts = append(parts, remote+" "+describeAheadBehind(ctx, remoteHash, latest))
+	}
+	if len(parts) > 0 {
+		deps.GitDebugLog.Printf(
+			"review %s: branch %s differs from revision %d at %s: %v",
+			review.ID,
+			review.HeadBranch,
+			review.LatestRevision.Number,
+			shortSHA(latest.String()),
+			parts,
+		)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeAheadBehind describes how commit a compares to commit b, e.g.
+// "2 ahead, 1 behind", or "differs" if that can't be worked out, e.g. because
+// one of them hasn't been fetched.
+func describeAheadBehind(ctx context.Context, a, b plumbing.Hash) string {
+	ahead, behind, err := aheadBehind(ctx, a, b)
+	if err != nil {
+		deps.FromContext(ctx).GitDebugLog.Println(err)
+		return "differs"
+	}
+	var parts []string
+	if ahead > 0 {
+		parts = append(parts, fmt.Sprintf("%d ahead", ahead))
+	}
+	if behind > 0 {
+		parts = append(parts, fmt.Sprintf("%d behind", behind))
+	}
+	if len(parts) == 0 {
+		return "differs"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// aheadBehind counts the commits reachable from a but not b, and from b but
+// not a.
+func aheadBehind(ctx context.Context, a, b plumbing.Hash) (int, int, error) {
+	out, err := exec.CommandContext(
+		ctx, "git", "rev-list", "--left-right", "--count", a.String()+"..."+b.String(), "--",
+	).Output()
+	if err != nil {
+		return 0, 0, errors.Errorf("cannot compare %s with %s: %v", shortSHA(a.String()), shortSHA(b.String()), err)
+	}
+	var ahead, behind int
+	if _, err := fmt.Sscan(string(out), &ahead, &behind); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,106 @@
+package actions
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// lastRevisionHash returns the head commit of the latest revision of the
+// review that plz.review knows about, or the zero hash for a new review.
+func (ri *reviewInfo) lastRevisionHash() plumbing.Hash {
+	if ri.Review == nil || ri.Review.LatestRevision.HeadCommitSHA == "" {
+		return plumbing.ZeroHash
+	}
+	return plumbing.NewHash(ri.Review.LatestRevision.HeadCommitSHA)
+}
+
+// checkReviewBranchDivergence fails if someone else has pushed to the review
+// branch since the review's latest revision, so that publishing doesn't
+// silently throw their commits away. The head of the PR, as GitHub just
+// reported it, is compared with the latest revision. The remote-tracking
+// branch isn't, since it's only as fresh as the last fetch. Commits that the
+// latest revision builds on don't count, and nor does what the local review
+// branch is at, which plz pushed itself but plz.review may not have recorded as
+// a revision yet. The error summarizes what was pushed, when the commits have
+// been fetched.
+func checkReviewBranchDivergence(
+	ctx context.Context,
+	repo *git.Repository,
+	reviewBranch string,
+	lastRevisionHash plumbing.Hash,
+	prHeadHash plumbing.Hash,
+) error {
+	if lastRevisionHash.IsZero() || prHeadHash.IsZero() || prHeadHash == lastRevisionHash {
+		return nil
+	}
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(reviewBranch), true)
+	if err == nil && ref.Hash() == prHeadHash {
+		return nil
+	} else if err != nil && err != plumbing.ErrReferenceNotFound {
+		return errors.WithStack(err)
+	}
+	lastCommit, err := repo.CommitObject(lastRevisionHash)
+	if err != nil {
+		return errors.Errorf(
+			"review branch %s is at %s, not at its latest revision %s, which isn't available locally; "+
+				"run plz sync, or plz review --force to overwrite it",
+			reviewBranch,
+			shortSHA(prHeadHash.String()),
+			shortSHA(lastRevisionHash.String()),
+		)
+	}
+	prHeadCommit, err := repo.CommitObject(prHeadHash)
+	if err != nil {
+		return errors.Errorf(
+			"review branch %s is at %s, which isn't its latest revision %s; "+
+				"fetch it with git fetch %s %[1]s to see what was pushed, then run plz sync, or plz review --force to overwrite it",
+			reviewBranch,
+			shortSHA(prHeadHash.String()),
+			shortSHA(lastRevisionHash.String()),
+			git.DefaultRemoteName,
+		)
+	}
+	if isAncestor, err := prHeadCommit.IsAncestor(lastCommit); err != nil {
+		return errors.WithStack(err)
+	} else if isAncestor {
+		return nil
+	}
+	return errors.Errorf(
+		"review branch %s was pushed to since its latest revision %s, it's now at %s:\n\n%s\n\n"+
+			"run plz sync to pick up those changes, or plz review --force to overwrite them",
+		reviewBranch,
+		shortSHA(lastRevisionHash.String()),
+		shortSHA(prHeadHash.String()),
+		divergenceSummary(ctx, lastRevisionHash, prHeadHash),
+	)
+}
+
+// divergenceSummary lists the commits on the remote branch that the latest
+// revision doesn't have, and the files that differ between them.
+func divergenceSummary(ctx context.Context, lastRevisionHash, remoteHash plumbing.Hash) string {
+	var lines []string
+	log, err := exec.CommandContext(
+		ctx, "git", "log", "--oneline", "--no-decorate", lastRevisionHash.String()+".."+remoteHash.String(), "--",
+	).Output()
+	if err == nil {
+		lines = append(lines, strings.Split(strings.TrimRight(string(log), "\n"), "\n")...)
+	}
+	stat, err := exec.CommandContext(
+		ctx, "git", "diff", "--stat", "--no-color", lastRevisionHash.String(), remoteHash.String(), "--",
+	).Output()
+	if err == nil && len(stat) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(strings.TrimRight(string(stat), "\n"), "\n")...)
+	}
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "    " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+)
+
+// reviewHooksDir is the directory, relative to the top of the worktree, of
+// the hooks that plz review runs.
+const reviewHooksDir = ".plz/hooks"
+
+// Names of the hooks that plz review runs.
+const (
+	// preReviewHook runs before anything is published, and stops plz review
+	// if it fails.
+	preReviewHook = "pre-review"
+	// postReviewHook runs after the stack is published. Failures are only
+	// reported.
+	postReviewHook = "post-review"
+)
+
+// reviewHookInput is the JSON passed to review hooks on stdin.
+type reviewHookInput struct {
+	Hook      string `json:"hook"`
+	StackName string `json:"stackName,omitempty"`
+	// Reviews are the reviews being published, from the bottom of the stack
+	// up.
+	Reviews []reviewHookReview `json:"reviews"`
+}
+
+type reviewHookReview struct {
+	// Commit is the local commit before publishing in pre-review, and the
+	// published commit, which may have been rewritten, in post-review.
+	Commit     string `json:"commit"`
+	Title      string `json:"title"`
+	ReviewID   string `json:"reviewID"`
+	URL        string `json:"url"`
+	HeadBranch string `json:"headBranch"`
+	BaseBranch string `json:"baseBranch"`
+	// PRNumber is zero in pre-review for PRs that don't exist yet.
+	PRNumber int `json:"prNumber,omitempty"`
+	// Action is created, updated or unchanged, in post-review only.
+	Action string `json:"action,omitempty"`
+}
+
+// runReviewHook runs the named hook from reviewHooksDir, if it exists, with
+// details of the reviews being published as JSON on stdin, in the environment
+// variables PLZ_HOOK, PLZ_STACK_NAME and PLZ_REVIEW_IDS. It runs in the top of
+// the worktree. The hooks come from whatever is checked out, so they only run
+// if the user has opted in with plz.reviewHooks, which is read from the Git
+// config and so can't be set by the repository's contents.
+func runReviewHook(
+	ctx context.Context,
+	repo *git.Repository,
+	hook string,
+	ris []*reviewInfo,
+	stackName string,
+) error {
+	deps := deps.FromContext(ctx)
+
+	worktree, err := repo.Worktree()
+	if err == git.ErrIsBareRepository {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	root := worktree.Filesystem.Root()
+	path := filepath.Join(root, reviewHooksDir, hook)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	if !deps.Config.GetBool("reviewHooks", false) {
+		deps.ErrorLog.Printf(
+			"warning: not running %s, set plz.reviewHooks to true if you trust this repository's review hooks",
+			filepath.Join(reviewHooksDir, hook),
+		)
+		return nil
+	}
+	if info.Mode()&0111 == 0 {
+		return errors.Errorf("%s hook %s isn't executable", hook, path)
+	}
+
+	input := reviewHookInput{Hook: hook, StackName: stackName}
+	reviewIDs := make([]string, len(ris))
+	for i, ri := range ris {
+		commit := ri.Commit
+		if ri.updatedCommit != nil {
+			commit = ri.updatedCommit
+		}
+		review := reviewHookReview{
+			Commit:     commit.Hash.String(),
+			Title:      commitTitle(commit.Message),
+			ReviewID:   ri.reviewID,
+			URL:        "https://plz.review/review/" + ri.reviewID,
+			HeadBranch: ri.headBranch,
+			BaseBranch: ri.baseBranch,
+			PRNumber:   ri.prNumber(),
+		}
+		if hook == postReviewHook {
+			review.Action = ri.publishAction()
+		}
+		input.Reviews = append(input.Reviews, review)
+		reviewIDs[i] = ri.reviewID
+	}
+	b, err := json.Marshal(input)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	deps.GitDebugLog.Println("running", hook, "hook", path)
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = root
+	cmd.Env = append(
+		os.Environ(),
+		"PLZ_HOOK="+hook,
+		"PLZ_STACK_NAME="+stackName,
+		"PLZ_REVIEW_IDS="+strings.Join(reviewIDs, " "),
+	)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = deps.InfoLog.Writer()
+	cmd.Stderr = deps.ErrorLog.Writer()
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("%s hook failed: %v", hook, err)
+	}
+	return nil
+}
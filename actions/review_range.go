@@ -0,0 +1,110 @@
+package actions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// reviewRange is the part of the stack selected by plz review <base>..<head>.
+type reviewRange struct {
+	// head is the top commit to publish and unpublished the commits above
+	// it, top first, like for --up-to.
+	head        plumbing.Hash
+	unpublished []*object.Commit
+	// prBase is the base branch of the PR of the bottom commit, and
+	// stackBase the revision that the stack is walked down to.
+	prBase    string
+	stackBase string
+}
+
+// resolveReviewRange resolves the <base>..<head> argument of plz review. head
+// defaults to HEAD and must be in the stack under HEAD. base must be an
+// ancestor of head, and either be on the base branch, in which case the
+// range's bottom PR is based on it like the rest of the stack's would be, or
+// be the head of an open review, in which case the bottom PR is based on the
+// review's branch. Commits below base are left alone.
+func resolveReviewRange(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	base string,
+	headHash plumbing.Hash,
+	arg string,
+) (*reviewRange, error) {
+	deps := deps.FromContext(ctx)
+	from, to, ok := strings.Cut(arg, "..")
+	if !ok || from == "" || strings.HasPrefix(to, ".") {
+		return nil, errors.Errorf("invalid range %q, expected <base>..<head>", arg)
+	}
+	repo := gitHubRepo.GitRepo()
+
+	r := &reviewRange{head: headHash, prBase: base, stackBase: base}
+	if to != "" {
+		var err error
+		r.head, r.unpublished, err = resolveUpTo(ctx, gitHubRepo, base, headHash, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rangeHead, err := repo.CommitObject(r.head)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(from))
+	if err != nil {
+		return nil, errors.Errorf("cannot resolve %q to a commit", from)
+	}
+	rangeBase, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if rangeBase.Hash == rangeHead.Hash {
+		return nil, errors.Errorf("range %s is empty", arg)
+	}
+	if isAncestor, err := rangeBase.IsAncestor(rangeHead); err != nil {
+		return nil, errors.WithStack(err)
+	} else if !isAncestor {
+		return nil, errors.Errorf("%s is not an ancestor of %s", from, shortSHA(rangeHead.Hash.String()))
+	}
+
+	baseRef, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, base), true)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	baseCommit, err := repo.CommitObject(baseRef.Hash())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if onBase, err := rangeBase.IsAncestor(baseCommit); err != nil {
+		return nil, errors.WithStack(err)
+	} else if onBase || rangeBase.Hash == baseCommit.Hash {
+		deps.StackDebugLog.Println("range base", rangeBase.Hash, "is on", base)
+		return r, nil
+	}
+
+	s, err := stack.Load(ctx, repo, graphqlClient, rangeBase, base)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) == 0 || s[0].Review == nil || s[0].Status() != stack.CommitStatusCurrent ||
+		s[0].Review.Status != stack.ReviewStatusOpen {
+		return nil, errors.Errorf(
+			"%s is neither on %s/%s nor the head of an open review, publish it first or start the range lower down",
+			from,
+			git.DefaultRemoteName,
+			base,
+		)
+	}
+	deps.StackDebugLog.Println("range base", rangeBase.Hash, "is review", s[0].Review.ID)
+	r.prBase = s[0].Review.HeadBranch
+	r.stackBase = rangeBase.Hash.String()
+	return r, nil
+}
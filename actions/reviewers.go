@@ -0,0 +1,145 @@
+package actions
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+)
+
+var (
+	reviewerUsernameRegex = regexp.MustCompile(
+		`^[A-Za-z0-9-]+$`,
+	)
+	teamReviewerRegex = regexp.MustCompile(
+		`^([A-Za-z0-9-]+)/([A-Za-z0-9_.-]+)$`,
+	)
+)
+
+// validateReviewers checks that each reviewer is either an existing GitHub
+// user or an existing team in org/team-name form. Only teams of the org that
+// owns the repository can review its PRs.
+func validateReviewers(ctx context.Context, gitHubRepo *gitHubRepo, reviewers []string) error {
+	for _, reviewer := range reviewers {
+		if org, slug, ok := splitTeamReviewer(reviewer); ok {
+			if !strings.EqualFold(org, gitHubRepo.Owner()) {
+				return errors.Errorf(
+					"team reviewer %q isn't in %s, only teams of the org that owns the repository can review",
+					reviewer,
+					gitHubRepo.Owner(),
+				)
+			}
+			_, resp, err := gitHubRepo.Client().Teams.GetTeamBySlug(ctx, org, slug)
+			if err != nil {
+				if resp != nil && resp.StatusCode == http.StatusNotFound {
+					return errors.Errorf("team reviewer %q not found", reviewer)
+				}
+				return errors.WithStack(err)
+			}
+			continue
+		}
+		if !reviewerUsernameRegex.MatchString(reviewer) {
+			return errors.Errorf("invalid reviewer username: %q", reviewer)
+		}
+		_, resp, err := gitHubRepo.Client().Users.Get(ctx, reviewer)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return errors.Errorf("reviewer %q not found", reviewer)
+			}
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// splitTeamReviewer splits a team reviewer of the form org/team-name into the
+// org and team slug.
+func splitTeamReviewer(reviewer string) (string, string, bool) {
+	matches := teamReviewerRegex.FindStringSubmatch(reviewer)
+	if matches == nil {
+		return "", "", false
+	}
+	return matches[1], matches[2], true
+}
+
+// reviewersToRequest returns the reviewers that haven't yet been requested on
+// the review's PR.
+func reviewersToRequest(ri *reviewInfo, reviewers []string) []string {
+	if ri.pr == nil {
+		return reviewers
+	}
+	var reviewersToAdd []string
+	for _, r := range reviewers {
+		if !isRequestedReviewer(ri, r) {
+			reviewersToAdd = append(reviewersToAdd, r)
+		}
+	}
+	return reviewersToAdd
+}
+
+// reviewersToRemove returns the given reviewers that are currently requested
+// on the review's PR.
+func reviewersToRemove(ri *reviewInfo, reviewers []string) []string {
+	if ri.pr == nil {
+		return nil
+	}
+	var toRemove []string
+	for _, r := range reviewers {
+		if isRequestedReviewer(ri, r) {
+			toRemove = append(toRemove, r)
+		}
+	}
+	return toRemove
+}
+
+// isRequestedReviewer reports whether reviewer, a username or org/team-name,
+// is among the requested reviewers of the review's existing PR.
+func isRequestedReviewer(ri *reviewInfo, reviewer string) bool {
+	if _, slug, ok := splitTeamReviewer(reviewer); ok {
+		for _, existingTeam := range ri.reviewer.Teams {
+			if strings.EqualFold(existingTeam.GetSlug(), slug) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, existingReviewer := range ri.reviewer.Users {
+		if strings.EqualFold(existingReviewer.GetLogin(), reviewer) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateReviewersToRemove checks the form of reviewers to remove. Unlike
+// validateReviewers, it doesn't look them up, since removing a reviewer who
+// doesn't exist or isn't requested does nothing.
+func validateReviewersToRemove(reviewers []string, added []string) error {
+	for _, reviewer := range reviewers {
+		if _, _, ok := splitTeamReviewer(reviewer); !ok && !reviewerUsernameRegex.MatchString(reviewer) {
+			return errors.Errorf("invalid reviewer username: %q", reviewer)
+		}
+		for _, a := range added {
+			if strings.EqualFold(a, reviewer) {
+				return errors.Errorf("cannot both add and remove reviewer %q", reviewer)
+			}
+		}
+	}
+	return nil
+}
+
+// newReviewersRequest splits reviewers into user and team reviewers.
+func newReviewersRequest(reviewers []string) github.ReviewersRequest {
+	var req github.ReviewersRequest
+	for _, r := range reviewers {
+		if _, slug, ok := splitTeamReviewer(r); ok {
+			req.TeamReviewers = append(req.TeamReviewers, slug)
+		} else {
+			req.Reviewers = append(req.Reviewers, r)
+		}
+	}
+	return req
+}
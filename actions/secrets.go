@@ -0,0 +1,184 @@
+package actions
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// secretAllowMarker can be put on a line to exempt it from secret scanning,
+// e.g. for test fixtures.
+const secretAllowMarker = "plz:allow-secret"
+
+// defaultSecretEntropy is the default Shannon entropy, in bits per character,
+// above which a value assigned to a secret-looking name is reported.
+const defaultSecretEntropy = 3.5
+
+type secretRule struct {
+	description string
+	regex       *regexp.Regexp
+}
+
+// secretRules match well-known credential formats.
+var secretRules = []secretRule{
+	{"AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"Stripe live key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)},
+}
+
+// secretAssignmentRegex matches values assigned to names that suggest a
+// secret. Matches are only reported if the value looks random enough.
+var secretAssignmentRegex = regexp.MustCompile(
+	`(?i)(secret|token|passw(or)?d|api[_-]?key|credential)[A-Za-z0-9_-]*["']?\s*[:=]\s*["']?([A-Za-z0-9/+=_.-]{16,})`,
+)
+
+type secretFinding struct {
+	commit      *object.Commit
+	path        string
+	line        int
+	description string
+}
+
+// checkSecrets scans the lines added by the given reviews for probable
+// credentials and fails if any are found. Scanning is configured with
+// plz.secretScan, plz.secretScanPattern and plz.secretScanEntropy.
+func checkSecrets(ctx context.Context, ris []*reviewInfo) error {
+	deps := deps.FromContext(ctx)
+	if !deps.Config.GetBool("secretScan", true) {
+		return nil
+	}
+	rules := secretRules
+	if pattern := deps.Config.Get("secretScanPattern"); pattern != "" {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Errorf("invalid plz.secretScanPattern: %v", err)
+		}
+		rules = append(rules[:len(rules):len(rules)], secretRule{"match for plz.secretScanPattern", regex})
+	}
+	entropy := defaultSecretEntropy
+	if v := deps.Config.Get("secretScanEntropy"); v != "" {
+		var err error
+		entropy, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return errors.Errorf("invalid plz.secretScanEntropy value %q", v)
+		}
+	}
+
+	var findings []secretFinding
+	for _, ri := range ris {
+		commitFindings, err := findSecrets(ri.Commit, rules, entropy)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, commitFindings...)
+	}
+	for _, f := range findings {
+		deps.ErrorLog.Printf(
+			"%s %s:%d: possible %s",
+			f.commit.Hash.String()[:8],
+			f.path,
+			f.line,
+			f.description,
+		)
+	}
+	if len(findings) > 0 {
+		return errors.Errorf(
+			"found %d probable secrets, remove them, mark the lines with %s, or use --no-secret-scan to publish anyway",
+			len(findings),
+			secretAllowMarker,
+		)
+	}
+	return nil
+}
+
+// findSecrets returns probable secrets in the lines added by the commit.
+func findSecrets(commit *object.Commit, rules []secretRule, entropy float64) ([]secretFinding, error) {
+	if commit.TreeHash.IsZero() || len(commit.ParentHashes) == 0 {
+		// Commits that haven't been fetched have nothing to push.
+		return nil, nil
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	patch, err := parent.Patch(commit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var findings []secretFinding
+	for _, fp := range patch.FilePatches() {
+		_, to := fp.Files()
+		if to == nil || fp.IsBinary() {
+			continue
+		}
+		line := 1
+		for _, chunk := range fp.Chunks() {
+			lines := strings.SplitAfter(chunk.Content(), "\n")
+			if lines[len(lines)-1] == "" {
+				lines = lines[:len(lines)-1]
+			}
+			switch chunk.Type() {
+			case diff.Equal:
+				line += len(lines)
+			case diff.Add:
+				for _, text := range lines {
+					if description := matchSecret(text, rules, entropy); description != "" {
+						findings = append(findings, secretFinding{
+							commit:      commit,
+							path:        to.Path(),
+							line:        line,
+							description: description,
+						})
+					}
+					line++
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// matchSecret returns a description of the probable secret on the line, or an
+// empty string if there isn't one.
+func matchSecret(line string, rules []secretRule, entropy float64) string {
+	if strings.Contains(line, secretAllowMarker) {
+		return ""
+	}
+	for _, rule := range rules {
+		if rule.regex.MatchString(line) {
+			return rule.description
+		}
+	}
+	for _, matches := range secretAssignmentRegex.FindAllStringSubmatch(line, -1) {
+		if shannonEntropy(matches[3]) >= entropy {
+			return "secret assigned to " + strings.ToLower(matches[1])
+		}
+	}
+	return ""
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
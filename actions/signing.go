@@ -0,0 +1,216 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// commitSigner signs the commits that plz writes the way git commit -S would,
+// so that rewritten commits stay verified on GitHub. It follows Git's
+// commit.gpgSign, gpg.format, user.signingKey and gpg.<format>.program
+// settings.
+type commitSigner struct {
+	// format is openpgp, ssh or x509.
+	format  string
+	key     string
+	program string
+}
+
+type cachedCommitSigner struct {
+	signer *commitSigner
+	err    error
+}
+
+var (
+	commitSignersMu sync.Mutex
+	// commitSigners caches the signer of each repository by its worktree
+	// root, since the signing settings can differ between repositories.
+	commitSigners = map[string]cachedCommitSigner{}
+)
+
+// loadCommitSigner returns the signer for repo, or nil if commits aren't
+// signed.
+func loadCommitSigner(repo *git.Repository) (*commitSigner, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	root := worktree.Filesystem.Root()
+	commitSignersMu.Lock()
+	defer commitSignersMu.Unlock()
+	cached, ok := commitSigners[root]
+	if !ok {
+		cached.signer, cached.err = newCommitSigner(root)
+		commitSigners[root] = cached
+	}
+	return cached.signer, cached.err
+}
+
+func newCommitSigner(root string) (*commitSigner, error) {
+	gitConfigValue := func(args ...string) (string, error) {
+		return gitConfigValueIn(root, args...)
+	}
+	sign, err := gitConfigValue("--type=bool", "commit.gpgSign")
+	if err != nil || sign != "true" {
+		return nil, err
+	}
+	format, err := gitConfigValue("gpg.format")
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = "openpgp"
+	}
+	s := &commitSigner{format: format}
+	var defaultProgram string
+	switch format {
+	case "openpgp":
+		defaultProgram = "gpg"
+		s.program, err = gitConfigValue("gpg.program")
+		if err == nil && s.program == "" {
+			s.program, err = gitConfigValue("gpg.openpgp.program")
+		}
+	case "x509":
+		defaultProgram = "gpgsm"
+		s.program, err = gitConfigValue("gpg.x509.program")
+	case "ssh":
+		defaultProgram = "ssh-keygen"
+		s.program, err = gitConfigValue("gpg.ssh.program")
+	default:
+		return nil, errors.Errorf("unsupported gpg.format %q, must be openpgp, x509 or ssh", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.program == "" {
+		s.program = defaultProgram
+	}
+	s.key, err = gitConfigValue("user.signingKey")
+	if err != nil {
+		return nil, err
+	}
+	if format == "ssh" && s.key == "" {
+		return nil, errors.New("commit.gpgSign is set with gpg.format=ssh, but user.signingKey isn't")
+	}
+	return s, nil
+}
+
+// sign returns the signature of a commit's encoding without a signature. If
+// no key is configured, the committer's identity picks the key, like Git does.
+func (s *commitSigner) sign(payload []byte, committer object.Signature) (string, error) {
+	var args []string
+	if s.format == "ssh" {
+		keyFile := s.key
+		args = []string{"-Y", "sign", "-n", "git"}
+		if literal := strings.TrimPrefix(s.key, "key::"); literal != s.key || strings.HasPrefix(s.key, "ssh-") {
+			// A literal public key, whose private key is in the SSH agent.
+			f, err := os.CreateTemp("", "plz-signing-key-*")
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(literal + "\n")
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			keyFile = f.Name()
+			args = append(args, "-U")
+		} else if strings.HasPrefix(keyFile, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			keyFile = filepath.Join(home, keyFile[2:])
+		}
+		args = append(args, "-f", keyFile)
+	} else {
+		key := s.key
+		if key == "" {
+			key = committer.Name + " <" + committer.Email + ">"
+		}
+		args = []string{"--status-fd=2", "-bsau", key}
+	}
+	cmd := exec.Command(s.program, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Errorf("%s failed to sign commit: %s", s.program, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// storeCommit writes a new or rewritten commit to the repository, setting its
+// committer according to plz.committer and signing it if commits are signed.
+func storeCommit(ctx context.Context, repo *git.Repository, commit *object.Commit) (plumbing.Hash, error) {
+	if err := setCommitter(ctx, commit); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	signer, err := loadCommitSigner(repo)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	commit.PGPSignature = ""
+	if signer != nil {
+		payload := repo.Storer.NewEncodedObject()
+		if err := commit.EncodeWithoutSignature(payload); err != nil {
+			return plumbing.ZeroHash, errors.WithStack(err)
+		}
+		r, err := payload.Reader()
+		if err != nil {
+			return plumbing.ZeroHash, errors.WithStack(err)
+		}
+		var b bytes.Buffer
+		_, err = b.ReadFrom(r)
+		r.Close()
+		if err != nil {
+			return plumbing.ZeroHash, errors.WithStack(err)
+		}
+		commit.PGPSignature, err = signer.sign(b.Bytes(), commit.Committer)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	return hash, errors.WithStack(err)
+}
+
+// gitConfigValueIn returns the value of a Git setting for the repository at
+// dir, or an empty string if it isn't set. Options such as --type=bool may
+// come before the key.
+func gitConfigValueIn(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"config", "--get"}, args...)...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.Errorf("git config failed: %s", msg)
+		}
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,333 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// Split splits a commit in the stack into two or more commits. With paths,
+// the changes to those paths are moved into a new commit below the rest.
+// Without, the user picks hunks for each new commit with git add -p until they
+// pick nothing, and the remaining changes make up the top commit. The top
+// commit keeps the original commit's message and review, the new commits below
+// it become new reviews the next time the stack is published, and the commits
+// above are restacked. Since the restacked commits keep their trees, the
+// worktree is unaffected.
+func Split(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	isClean, err := isCleanWorktree(ctx)
+	if err != nil {
+		return err
+	}
+	if !isClean {
+		return errors.Errorf("index is not clean")
+	}
+
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !headRef.Name().IsBranch() {
+		return errors.New("HEAD is detached, check out the stack's branch first")
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defaultBranch, err := localDefaultBranch(ctx, repo)
+	if err != nil {
+		return err
+	}
+	commits, err := stack.LocalCommits(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return errors.New("no commits to split")
+	}
+	index := 0
+	if rev := c.String("commit"); rev != "" {
+		index, err = stackCommitIndex(repo, commits, rev)
+		if err != nil {
+			return err
+		}
+	}
+	commit := commits[index]
+	if len(commit.ParentHashes) != 1 {
+		return errors.Errorf("cannot split merge commit %s", shortSHA(commit.Hash.String()))
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// trees are the trees of the new commits below the top one, bottom first.
+	var trees []plumbing.Hash
+	if c.NArg() > 0 {
+		paths, err := repoPaths(repo, c.Args().Slice())
+		if err != nil {
+			return err
+		}
+		tree, err := splitPaths(repo, parent, commit, paths)
+		if err != nil {
+			return err
+		}
+		trees = []plumbing.Hash{tree}
+	} else {
+		if index != 0 {
+			return errors.New("only the HEAD commit can be split interactively, give paths to split another commit")
+		}
+		added, err := addedPaths(parent, commit)
+		if err != nil {
+			return err
+		}
+		trees, err = splitHunks(ctx, parent.TreeHash, commit.TreeHash, added)
+		if err != nil {
+			return err
+		}
+	}
+
+	messages := c.StringSlice("message")
+	base := strings.TrimSpace(stack.StripReviewID(stripAttestation(commit.Message)))
+	parentHash := parent.Hash
+	for i, tree := range trees {
+		var message string
+		if i < len(messages) {
+			message = strings.TrimSpace(messages[i])
+		} else {
+			message, err = editText(fmt.Sprintf(
+				"%s\n\n"+
+					"# Enter the message for part %d of %d of the split commit. The last\n"+
+					"# part keeps the original message and review.\n",
+				base,
+				i+1,
+				len(trees)+1,
+			))
+			if err != nil {
+				return err
+			}
+		}
+		if message == "" {
+			return errors.New("empty commit message, commit not split")
+		}
+		part := &object.Commit{
+			Author:       commit.Author,
+			Committer:    commit.Committer,
+			Message:      message + "\n",
+			TreeHash:     tree,
+			ParentHashes: []plumbing.Hash{parentHash},
+		}
+		parentHash, err = storeCommit(ctx, repo, part)
+		if err != nil {
+			return err
+		}
+		deps.GitDebugLog.Println("wrote part", i+1, "of", commit.Hash, "as", parentHash)
+	}
+	for i := index; i >= 0; i-- {
+		message := commits[i].Message
+		if i == index {
+			message = stripAttestation(message)
+		}
+		restacked, err := writeCommit(ctx, repo, commits[i], message, parentHash)
+		if err != nil {
+			return err
+		}
+		deps.GitDebugLog.Println("restacked", commits[i].Hash, "as", restacked.Hash)
+		parentHash = restacked.Hash
+	}
+	deps.GitDebugLog.Println("repointing", headRef.Name(), "to", parentHash)
+	err = repo.Storer.SetReference(plumbing.NewHashReference(headRef.Name(), parentHash))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	deps.InfoLog.Printf(
+		"split %s into %d commits, run plz review to publish them",
+		shortSHA(commit.Hash.String()),
+		len(trees)+1,
+	)
+	return nil
+}
+
+// splitPaths returns the tree of the parent with the commit's changes to the
+// given paths, or anything under them, applied.
+func splitPaths(repo *git.Repository, parent *object.Commit, commit *object.Commit, paths []string) (plumbing.Hash, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	changes, err := object.DiffTree(parentTree, commitTree)
+	if err != nil {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	matches := func(name string) bool {
+		for _, path := range paths {
+			if path == "" || name == path || strings.HasPrefix(name, path+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	updates := map[string]*object.TreeEntry{}
+	numSplit := 0
+	for _, change := range changes {
+		if !matches(change.From.Name) && !matches(change.To.Name) {
+			continue
+		}
+		if change.From.Name != "" {
+			updates[change.From.Name] = nil
+		}
+		if change.To.Name != "" {
+			entry := change.To.TreeEntry
+			updates[change.To.Name] = &entry
+		}
+		numSplit++
+	}
+	if numSplit == 0 {
+		return plumbing.ZeroHash, errors.Errorf("commit %s doesn't change any of the paths", shortSHA(commit.Hash.String()))
+	}
+	if numSplit == len(changes) {
+		return plumbing.ZeroHash, errors.New("all of the commit's changes match the paths, nothing would be left")
+	}
+	return updateTree(repo, parentTree, updates)
+}
+
+func addedPaths(parent *object.Commit, commit *object.Commit) ([]string, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	changes, err := object.DiffTree(parentTree, commitTree)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var added []string
+	for _, change := range changes {
+		if change.From.Name == "" {
+			added = append(added, change.To.Name)
+		}
+	}
+	return added, nil
+}
+
+// repoPaths converts paths relative to the current directory to slash
+// separated paths relative to the root of the worktree, as used in trees. The
+// root itself becomes an empty string.
+func repoPaths(repo *git.Repository, paths []string) ([]string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	root := worktree.Filesystem.Root()
+	repoPaths := make([]string, len(paths))
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, errors.Errorf("%s is outside the repository", path)
+		}
+		if rel != "." {
+			repoPaths[i] = filepath.ToSlash(rel)
+		}
+	}
+	return repoPaths, nil
+}
+
+// splitHunks lets the user pick the hunks of each new commit with git add -p,
+// using a temporary index so that the real one is left alone. It returns the
+// trees of the picked commits, bottom first, stopping when nothing more is
+// picked or everything has been. added lists the files that the commit adds.
+func splitHunks(
+	ctx context.Context,
+	parentTree plumbing.Hash,
+	commitTree plumbing.Hash,
+	added []string,
+) ([]plumbing.Hash, error) {
+	deps := deps.FromContext(ctx)
+	dir, err := os.MkdirTemp("", "plz-split-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(dir)
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(dir, "index"))
+	if err := runGitEnv(ctx, env, "read-tree", parentTree.String()); err != nil {
+		return nil, err
+	}
+	// Files added by the commit are untracked as far as the temporary index
+	// is concerned, so mark them as intended to be added for git add -p to
+	// offer them.
+	if len(added) > 0 {
+		if err := runGitEnv(ctx, env, append([]string{"add", "--intent-to-add", "--"}, added...)...); err != nil {
+			return nil, err
+		}
+	}
+
+	var trees []plumbing.Hash
+	prevTree := parentTree
+	for {
+		deps.ErrorLog.Printf("pick the changes for part %d, or pick nothing to put the rest in the last part", len(trees)+1)
+		cmd := exec.CommandContext(ctx, "git", "add", "--patch")
+		cmd.Env = env
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, errors.Wrap(err, "git add --patch failed")
+		}
+		cmd = exec.CommandContext(ctx, "git", "write-tree")
+		cmd.Env = env
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrap(err, "git write-tree failed")
+		}
+		tree := plumbing.NewHash(strings.TrimSpace(string(out)))
+		if tree == prevTree || tree == commitTree {
+			break
+		}
+		trees = append(trees, tree)
+		prevTree = tree
+	}
+	if len(trees) == 0 {
+		return nil, errors.New("nothing was picked, commit not split")
+	}
+	return trees, nil
+}
+
+// runGitEnv runs a git command like runGit, with the given environment.
+func runGitEnv(ctx context.Context, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
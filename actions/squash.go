@@ -0,0 +1,269 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// StackSquash squashes a range of adjacent commits in the stack into one. The
+// squashed commit keeps the lowest review in the range, and the commits above
+// the range are restacked onto the squashed commit. Since the restacked
+// commits keep their trees, the worktree is unaffected. If that absorbs other
+// open reviews, the stack is published up to the squashed commit or the
+// highest open review above it, then the absorbed reviews and their PRs are
+// closed with a link to the surviving PR, which links back to them.
+func StackSquash(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	if c.NArg() != 2 {
+		return errors.New("usage: plz stack squash <bottom> <top>")
+	}
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+
+	isClean, err := isCleanWorktree(ctx)
+	if err != nil {
+		return err
+	}
+	if !isClean {
+		return errors.Errorf("index is not clean")
+	}
+
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !headRef.Name().IsBranch() {
+		return errors.New("HEAD is detached, check out the stack's branch first")
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	if err != nil {
+		return err
+	}
+	commits := make([]*object.Commit, len(s))
+	for i, ci := range s {
+		commits[i] = ci.Commit
+	}
+
+	// The stack is listed from the top down, so the bottom of the range has
+	// the higher index.
+	bottom, err := stackCommitIndex(repo, commits, c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	top, err := stackCommitIndex(repo, commits, c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	if bottom <= top {
+		return errors.New("the first commit must be below the second commit in the stack")
+	}
+	for i := top; i <= bottom; i++ {
+		if len(commits[i].ParentHashes) != 1 {
+			return errors.Errorf("cannot squash merge commit %s", shortSHA(commits[i].Hash.String()))
+		}
+	}
+
+	// The squashed commit is published as a new revision of the lowest
+	// review in the range, if any commit in the range has been published.
+	// Closed and merged reviews can't take new revisions, so only an open
+	// review survives.
+	var survivor *stack.Review
+	for i := bottom; i >= top && survivor == nil; i-- {
+		if review := s[i].Review; review != nil && review.Status == stack.ReviewStatusOpen {
+			survivor = review
+		}
+	}
+
+	// Commit messages are joined from the bottom up, with the bottom commit's
+	// message first.
+	bottomCommit := commits[bottom]
+	var message string
+	for i := bottom; i >= top; i-- {
+		part := strings.TrimSpace(stack.StripReviewID(stripAttestation(commits[i].Message)))
+		if message == "" {
+			message = part
+		} else if part != "" {
+			message = insertBeforeTrailers(message, part)
+		}
+	}
+	if survivor != nil {
+		style, err := reviewTrailerStyle(ctx)
+		if err != nil {
+			return err
+		}
+		trailer := stack.ReviewTrailers(survivor.ID, style)
+		if i := strings.LastIndex(message, "\n\n"); i >= 0 && isTrailerBlock(message[i+2:]) {
+			message += "\n" + trailer
+		} else {
+			message += "\n\n" + trailer
+		}
+	}
+	squashed := &object.Commit{
+		Author:       bottomCommit.Author,
+		Committer:    bottomCommit.Committer,
+		Message:      message + "\n",
+		TreeHash:     commits[top].TreeHash,
+		ParentHashes: bottomCommit.ParentHashes,
+	}
+	parentHash, err := storeCommit(ctx, repo, squashed)
+	if err != nil {
+		return err
+	}
+	deps.GitDebugLog.Println("squashed", bottom-top+1, "commits into", parentHash)
+
+	// Only the squashed commit and the published reviews above it need to be
+	// published again, so unpublished commits at the top of the stack stay
+	// unpublished.
+	upTo := parentHash
+	for i := top - 1; i >= 0; i-- {
+		restacked, err := writeCommit(ctx, repo, commits[i], commits[i].Message, parentHash)
+		if err != nil {
+			return err
+		}
+		deps.GitDebugLog.Println("restacked", commits[i].Hash, "as", restacked.Hash)
+		parentHash = restacked.Hash
+		if review := s[i].Review; review != nil && review.Status == stack.ReviewStatusOpen {
+			upTo = parentHash
+		}
+	}
+	// The new head has the same tree as the old one, so the worktree, and any
+	// LFS files in it, stay as they are.
+	deps.GitDebugLog.Println("repointing", headRef.Name(), "to", parentHash)
+	err = repo.Storer.SetReference(plumbing.NewHashReference(headRef.Name(), parentHash))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var absorbed []*stack.Review
+	for i := top; i <= bottom; i++ {
+		review := s[i].Review
+		if review != nil && review != survivor && review.Status == stack.ReviewStatusOpen {
+			absorbed = append(absorbed, review)
+		}
+	}
+	if len(absorbed) == 0 {
+		deps.InfoLog.Printf("squashed %d commits, run plz review to publish the result", bottom-top+1)
+		return nil
+	}
+
+	// Publish the squashed commit before closing anything, so that the
+	// absorbed reviews' changes are never only on a closed PR.
+	deps.InfoLog.Printf("squashed %d commits", bottom-top+1)
+	if err := RunReview(ctx, &ReviewOptions{UpTo: upTo.String()}); err != nil {
+		return err
+	}
+	links := make([]string, len(absorbed))
+	for i, review := range absorbed {
+		if err := closeSquashedReview(ctx, gitHubRepo, graphqlClient, review, survivor); err != nil {
+			return err
+		}
+		deps.InfoLog.Printf("closed PR #%d, squashed into %s", review.GitHubPR, reviewLink(survivor))
+		links[i] = reviewLink(review)
+	}
+	body := "Squashed in " + strings.Join(links, ", ") + "."
+	_, _, err = gitHubRepo.Client().Issues.CreateComment(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		survivor.GitHubPR,
+		&github.IssueComment{Body: &body},
+	)
+	return errors.WithStack(err)
+}
+
+// insertBeforeTrailers adds a paragraph to a commit message above its trailer
+// block, if it has one.
+func insertBeforeTrailers(message string, paragraph string) string {
+	i := strings.LastIndex(message, "\n\n")
+	if i < 0 || !isTrailerBlock(message[i+2:]) {
+		return message + "\n\n" + paragraph
+	}
+	return message[:i] + "\n\n" + paragraph + message[i:]
+}
+
+func isTrailerBlock(block string) bool {
+	for _, line := range strings.Split(block, "\n") {
+		key, _, ok := strings.Cut(line, ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return false
+		}
+	}
+	return true
+}
+
+// closeSquashedReview comments on and closes the PR of a review that was
+// squashed into another review, and closes the review on plz.review.
+func closeSquashedReview(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	review *stack.Review,
+	survivor *stack.Review,
+) error {
+	deps := deps.FromContext(ctx)
+	client := gitHubRepo.Client()
+	body := "Squashed into " + reviewLink(survivor) + "."
+	_, _, err := client.Issues.CreateComment(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		review.GitHubPR,
+		&github.IssueComment{Body: &body},
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	state := "closed"
+	_, _, err = client.PullRequests.Edit(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		review.GitHubPR,
+		&github.PullRequest{State: &state},
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	deps.GraphQLDebugLog.Println("closing review", review.ID)
+	var mutation struct {
+		CloseReview struct {
+			ID string `graphql:"id"`
+		} `graphql:"closeReview(reviewID: $reviewID)"`
+	}
+	err = graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"reviewID": graphql.ID(review.ID),
+	})
+	return errors.WithStack(err)
+}
+
+func reviewLink(review *stack.Review) string {
+	return fmt.Sprintf("#%d (https://plz.review/review/%s)", review.GitHubPR, review.ID)
+}
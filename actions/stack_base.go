@@ -0,0 +1,46 @@
+package actions
+
+import (
+	"context"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// stackBaseOption is the option of the branch's section of the Git config,
+// i.e. branch.<name>.plzBase, that records the --base the stack on the branch
+// was published with, so that later commands on the stack use it too.
+const stackBaseOption = "plzBase"
+
+// loadStackBase returns the base recorded for the stack on the given branch
+// by saveStackBase, or an empty string if there's none.
+func loadStackBase(repo *git.Repository, branch plumbing.ReferenceName) string {
+	if !branch.IsBranch() {
+		return ""
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return ""
+	}
+	return cfg.Raw.Section("branch").Subsection(branch.Short()).Option(stackBaseOption)
+}
+
+// saveStackBase records the base of the stack on the given branch, or forgets
+// it if base is the default branch. Failures are only logged, since the base
+// can always be given again.
+func saveStackBase(ctx context.Context, branch plumbing.ReferenceName, base string, defaultBranch string) {
+	deps := deps.FromContext(ctx)
+	if !branch.IsBranch() {
+		return
+	}
+	key := "branch." + branch.Short() + "." + stackBaseOption
+	if base == defaultBranch {
+		// Unsetting a missing option fails, which is fine.
+		_ = runGit(ctx, "config", "--unset", key)
+		return
+	}
+	if err := runGit(ctx, "config", key, base); err != nil {
+		deps.GitDebugLog.Printf("failed to record the base of %s: %v", branch.Short(), err)
+	}
+}
@@ -0,0 +1,51 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+)
+
+// defaultStackLabelPrefix namespaces the stack labels unless
+// plz.stackLabelPrefix is set.
+const defaultStackLabelPrefix = "stack-"
+
+// setStackLabels labels each PR in a stack with the stack's depth and the PR's
+// position in it, counting from 1 at the bottom, e.g. stack-depth:3 and
+// stack-pos:1. It does nothing unless plz.stackLabels is enabled. prNumbers
+// lists the stack's open PRs from the bottom up.
+func setStackLabels(ctx context.Context, gitHubRepo *gitHubRepo, prNumbers []int) error {
+	deps := deps.FromContext(ctx)
+	if !deps.Config.GetBool("stackLabels", false) {
+		return nil
+	}
+	prefix := deps.Config.Get("stackLabelPrefix")
+	if prefix == "" {
+		prefix = defaultStackLabelPrefix
+	}
+	for i, prNumber := range prNumbers {
+		deps.APIDebugLog.Printf("setting stack labels on PR %d, position %d of %d", prNumber, i+1, len(prNumbers))
+		err := setPrefixedLabels(ctx, gitHubRepo, prNumber, map[string]string{
+			prefix + "depth:": fmt.Sprintf("%sdepth:%d", prefix, len(prNumbers)),
+			prefix + "pos:":   fmt.Sprintf("%spos:%d", prefix, i+1),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openStackPRs returns the PR numbers of the open reviews in the stack from
+// the bottom up.
+func openStackPRs(s stack.CommitStack) []int {
+	var prNumbers []int
+	for i := len(s) - 1; i >= 0; i-- {
+		if review := s[i].Review; review != nil && review.Status == stack.ReviewStatusOpen {
+			prNumbers = append(prNumbers, review.GitHubPR)
+		}
+	}
+	return prNumbers
+}
@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+var stackNameRegex = regexp.MustCompile(`^[\w][\w.-]{0,63}$`)
+
+func validateStackName(name string) error {
+	if !stackNameRegex.MatchString(name) {
+		return errors.Errorf(
+			"invalid stack name %q, use up to 64 letters, digits, dots, dashes and underscores",
+			name,
+		)
+	}
+	return nil
+}
+
+// setStackName records the name of the stack on each of its reviews, so that
+// it is shown by plz status and on plz.review.
+func setStackName(ctx context.Context, graphqlClient *graphql.Client, ris []*reviewInfo, name string) error {
+	deps := deps.FromContext(ctx)
+	for _, ri := range ris {
+		if ri.Review != nil && ri.Review.StackName == name {
+			continue
+		}
+		deps.GraphQLDebugLog.Println("naming stack of review", ri.reviewID, name)
+		var mutation struct {
+			SetReviewStackName struct {
+				ID string `graphql:"id"`
+			} `graphql:"setReviewStackName(reviewID: $reviewID, stackName: $stackName)"`
+		}
+		err := graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+			"reviewID":  graphql.ID(ri.reviewID),
+			"stackName": graphql.String(name),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ri.Review != nil {
+			ri.Review.StackName = name
+		}
+	}
+	return nil
+}
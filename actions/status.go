@@ -1,96 +1,277 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"text/tabwriter"
+	"unicode/utf8"
 
 	"github.com/bitcomplete/plz-cli/client/deps"
 	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v32/github"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/graphql"
 	"github.com/urfave/cli/v2"
 )
 
+// StatusOptions are the options of RunStatus, which correspond to the flags of
+// plz status.
+type StatusOptions struct {
+	// Author lists the open reviews of this GitHub user, grouped into stacks,
+	// rather than the stack under HEAD.
+	Author    string
+	StackName string
+	// Ref is the branch or commit at the top of the stack to show, e.g. a
+	// coworker's fetched branch. It defaults to HEAD.
+	Ref string
+	// Base is the branch or commit that the stack is based on, like --base.
+	// It defaults to the default branch.
+	Base   string
+	Cached bool
+	// Checks fetches the CI check status of the reviews from GitHub, which
+	// takes a request per review.
+	Checks bool
+	// Porcelain prints the stable, tab separated format described in the
+	// README instead of the regular output.
+	Porcelain bool
+}
+
 func Status(c *cli.Context) error {
-	ctx := c.Context
+	if c.Args().Len() > 1 {
+		return errors.New("usage: plz status [<branch or commit>]")
+	}
+	return RunStatus(c.Context, &StatusOptions{
+		Ref:       c.Args().First(),
+		Author:    c.String("author"),
+		StackName: c.String("stack-name"),
+		Base:      c.String("base"),
+		Cached:    c.Bool("cached"),
+		Checks:    c.Bool("checks"),
+		Porcelain: c.Bool("porcelain"),
+	})
+}
+
+// statusHead resolves the top of the stack that plz status shows, which is
+// HEAD unless ref is set.
+func statusHead(repo *git.Repository, ref string) (plumbing.Hash, error) {
+	if ref == "" {
+		headRef, err := repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, errors.WithStack(err)
+		}
+		return headRef.Hash(), nil
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return plumbing.ZeroHash, errors.Errorf("cannot resolve %q to a commit", ref)
+	}
+	return *hash, nil
+}
+
+// RunStatus prints the status of the stack under HEAD, or options.Ref, of the
+// repository in the current directory to the InfoLog, like plz status. ctx
+// must carry Deps, see deps.ContextWithDeps.
+func RunStatus(ctx context.Context, options *StatusOptions) error {
+	var porcelain io.Writer
+	if options.Porcelain {
+		ctx, porcelain = porcelainContext(ctx)
+	}
 	deps := deps.FromContext(ctx)
 
-	token, err := deps.Auth.Token()
+	if author := options.Author; author != "" {
+		if options.Cached {
+			return errors.New("--author cannot be used with --cached")
+		}
+		if options.Ref != "" {
+			return errors.New("--author cannot be used with a branch or commit")
+		}
+		token, err := deps.Auth.Token()
+		if err != nil {
+			return err
+		}
+		gitHubRepo, err := newGitHubRepo(ctx, token)
+		if err != nil {
+			return err
+		}
+		graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+			Transport: &authTransport{Token: token},
+		})
+		return printAuthorStatus(ctx, gitHubRepo, graphqlClient, author, options.StackName, options.Checks, porcelain)
+	}
+
+	// Status is a read-only view, so stick to local data where possible and
+	// only use the GitHub API for CI checks, with --checks, and when the
+	// default branch can't be determined locally.
+	repo, err := openGitRepo()
 	if err != nil {
 		return err
 	}
-	gitHubRepo, err := newGitHubRepo(ctx, token)
+	headHash, err := statusHead(repo, options.Ref)
 	if err != nil {
 		return err
 	}
-	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
-		Transport: &authTransport{Token: token},
-	})
-
-	headRef, err := gitHubRepo.GitRepo().Head()
+	deps.GitDebugLog.Println("showing stack at", headHash)
+	headCommit, err := repo.CommitObject(headHash)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	deps.DebugLog.Println("HEAD is at", headRef.Hash())
+	defaultBranch := options.Base
+	if defaultBranch == "" && options.Ref == "" {
+		if headRef, err := repo.Head(); err == nil {
+			defaultBranch = loadStackBase(repo, headRef.Name())
+		}
+	}
+	if defaultBranch == "" {
+		defaultBranch = remoteDefaultBranch(repo)
+	}
 
-	repo := gitHubRepo.GitRepo()
-	headCommit, err := repo.CommitObject(headRef.Hash())
-	if err != nil {
-		return errors.WithStack(err)
+	var s stack.CommitStack
+	var checks map[string]checkState
+	if options.Cached {
+		if defaultBranch == "" {
+			return errors.Errorf(
+				"cannot determine default branch offline, run git remote set-head %s --auto",
+				git.DefaultRemoteName,
+			)
+		}
+		s, err = stack.LoadCached(ctx, repo, headCommit, defaultBranch)
+		if err != nil {
+			return err
+		}
+	} else {
+		token, err := deps.Auth.Token()
+		if err != nil {
+			return err
+		}
+		graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+			Transport: &authTransport{Token: token},
+		})
+		if defaultBranch == "" {
+			gitHubRepo, err := newGitHubRepo(ctx, token)
+			if err != nil {
+				return err
+			}
+			defaultBranch = gitHubRepo.DefaultBranch()
+		}
+		deps.GitDebugLog.Println("default branch is", defaultBranch)
+		s, err = stack.LoadLocal(ctx, repo, graphqlClient, headCommit, defaultBranch)
+		if err != nil {
+			return err
+		}
+		loadStatusDetails(ctx, graphqlClient, s)
+		stack.SaveCache(ctx, repo, s)
+		if options.Checks {
+			_, owner, repoName, err := parseRemote(repo)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			gitHubClient := github.NewClient(&http.Client{
+				Transport: &authTransport{Token: token},
+			})
+			checks, err = loadCheckStates(ctx, gitHubClient, owner, repoName, s)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
-	if err != nil {
-		return err
+	if options.StackName != "" && s.Name() != options.StackName {
+		deps.InfoLog.Printf("the stack at %s is not named %s", shortSHA(headHash.String()), options.StackName)
+		return nil
 	}
 
-	isClean, err := isCleanWorktree(ctx, gitHubRepo)
+	isClean, err := isCleanWorktree(ctx)
 	if err != nil {
 		return err
 	}
 	if !isClean {
 		deps.InfoLog.Println("index is not clean")
 	}
+	if porcelain != nil {
+		return writePorcelainStatus(porcelain, []stack.CommitStack{s}, checks)
+	}
 
+	th, err := loadTheme(deps.Config, deps.Color)
+	if err != nil {
+		return err
+	}
+	if name := s.Name(); name != "" {
+		deps.InfoLog.Printf("stack %s:", name)
+	}
+	order, err := remoteOrder(ctx, repo)
+	if err != nil {
+		return err
+	}
+	remoteBranches := resolveRemoteBranches(ctx, repo, order, s)
 	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	preferredRemote := ""
+	if len(order) > 0 {
+		preferredRemote = order[0]
+	}
 	for _, ci := range s {
-		printReviewStatus(w, ci)
+		var remoteParts []string
+		if ci.Review != nil {
+			var rb *remoteBranch
+			if b, ok := remoteBranches[ci.Review.ID]; ok {
+				rb = &b
+				if d := b.describe(preferredRemote); d != "" {
+					remoteParts = append(remoteParts, d)
+				}
+			}
+			if d := describeReviewBranchSync(ctx, repo, ci, preferredRemote, rb); d != "" {
+				remoteParts = append(remoteParts, d)
+			}
+		}
+		printReviewStatus(w, th, ci, checks, strings.Join(remoteParts, ", "))
 	}
 	w.Flush()
 
 	return nil
 }
 
-func printReviewStatus(w io.Writer, ci stack.CommitInfo) {
-	const (
-		asciiColorReset  = "\033[m"
-		asciiColorYellow = "\033[33m"
-		asciiColorGreen  = "\033[32m"
-		asciiColorRed    = "\033[31m"
-		asciiColorCyan   = "\033[36m"
-	)
+// printReviewStatus prints a row of plz status output. If checks is nil, the
+// CI checks column is left out. remote describes which remote the review
+// branch was found on and how the local and remote review branches differ from
+// the latest revision, if that's worth mentioning.
+func printReviewStatus(w io.Writer, th *theme, ci stack.CommitInfo, checks map[string]checkState, remote string) {
 	statusText := ""
-	color := ""
+	role := roleError
 	urlSuffix := ""
 	switch status := ci.Status(); status {
 	case stack.CommitStatusCurrent:
 		if ci.Review.Status == stack.ReviewStatusMerged {
 			statusText = "merged"
-			color = asciiColorCyan
+			role = roleInfo
 		} else {
 			statusText = fmt.Sprintf("rev %d, current", ci.Review.LocalRevision.Number)
-			color = asciiColorGreen
+			role = roleOK
 		}
 	case stack.CommitStatusBehind:
 		statusText = fmt.Sprintf("rev %d, behind", ci.Review.LocalRevision.Number)
-		color = asciiColorYellow
+		role = roleWarn
 		urlSuffix = fmt.Sprintf("/revision/%d", ci.Review.LocalRevision.Number)
+	case stack.CommitStatusUncached:
+		statusText = string(status)
+		role = roleWarn
 	default:
 		statusText = string(status)
-		color = asciiColorRed
+	}
+	if ci.Review != nil && ci.Review.Status == stack.ReviewStatusOpen {
+		if activity := reviewActivity(ci.Review); activity != "" {
+			statusText += ", " + activity
+		}
+	}
+	if remote != "" {
+		statusText += ", " + remote
+	}
+	if ci.CachedAt != nil {
+		statusText += ", cached " + ci.CachedAt.Format("2006-01-02 15:04")
 	}
 	parts := strings.SplitN(ci.Commit.Message, "\n", 2)
 	title := strings.TrimSpace(parts[0])
@@ -101,14 +282,69 @@ func printReviewStatus(w io.Writer, ci stack.CommitInfo) {
 	if ci.Review != nil {
 		reviewURL = fmt.Sprintf("https://plz.review/review/%s%s", ci.Review.ID, urlSuffix)
 	}
+	if checks != nil && ci.Review != nil {
+		// The checks column is padded here rather than by the tabwriter, and
+		// kept in the same cell as the URL, since its color codes would
+		// otherwise throw off the alignment of the following column.
+		checksText, width := "", 0
+		if state := checks[ci.Review.ID]; state != checkStateNone {
+			checksRole := state.role()
+			label := th.symbol(checksRole) + string(state)
+			width = utf8.RuneCountInString(label)
+			checksText = th.reset() + th.color(checksRole) + label + th.reset() + th.color(role)
+		}
+		maxWidth := utf8.RuneCountInString(th.symbol(roleOK) + string(checkStatePassing))
+		reviewURL = checksText + strings.Repeat(" ", maxWidth-width+1) + reviewURL
+	}
 	fmt.Fprintf(
 		w,
-		"%s%s\t%s\t(%s)\t%s%s\n",
-		color,
+		"%s%s%s\t%s\t(%s)\t%s%s\n",
+		th.color(role),
+		th.symbol(role),
 		ci.Commit.Hash.String()[:8],
 		title,
 		statusText,
 		reviewURL,
-		asciiColorReset,
+		th.reset(),
 	)
 }
+
+// reviewActivity summarizes a review's approvals, requests for changes and
+// unresolved comment threads, e.g. "✓2 ✗1 💬3". Zero counts are left out.
+func reviewActivity(review *stack.Review) string {
+	activity := review.Activity
+	if activity == nil {
+		return ""
+	}
+	var parts []string
+	if activity.Approvals > 0 {
+		parts = append(parts, fmt.Sprintf("✓%d", activity.Approvals))
+	}
+	if activity.ChangesRequested > 0 {
+		parts = append(parts, fmt.Sprintf("✗%d", activity.ChangesRequested))
+	}
+	if activity.UnresolvedThreads > 0 {
+		parts = append(parts, fmt.Sprintf("💬%d", activity.UnresolvedThreads))
+	}
+	return strings.Join(parts, " ")
+}
+
+// loadStatusDetails loads the stack names and activity of the reviews, which
+// only plz status shows. They're queried separately from the reviews, so a
+// plz.review server that doesn't have them yet just leaves them out. The two
+// queries set different fields, so they run concurrently.
+func loadStatusDetails(ctx context.Context, graphqlClient *graphql.Client, s stack.CommitStack) {
+	deps := deps.FromContext(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := stack.LoadStackNames(ctx, graphqlClient, s); err != nil {
+			deps.GraphQLDebugLog.Printf("failed to load stack names: %v", err)
+		}
+	}()
+	if err := stack.LoadActivity(ctx, graphqlClient, s); err != nil {
+		deps.GraphQLDebugLog.Printf("failed to load review activity: %v", err)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,162 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// printAuthorStatus prints the status of the open reviews authored by the
+// given GitHub user. The stacks are reconstructed from the PRs' head and base
+// branches rather than from local refs, so they needn't have been fetched. If
+// stackName is set, only the stack with that name is shown. If porcelain is
+// set, the status is written to it in the --porcelain format.
+func printAuthorStatus(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	author string,
+	stackName string,
+	showChecks bool,
+	porcelain io.Writer,
+) error {
+	deps := deps.FromContext(ctx)
+	prs, err := listReviewPRs(ctx, gitHubRepo)
+	if err != nil {
+		return err
+	}
+	prsByHead := map[string]*github.PullRequest{}
+	for _, pr := range prs {
+		if strings.EqualFold(pr.GetUser().GetLogin(), author) {
+			prsByHead[pr.GetHead().GetRef()] = pr
+		}
+	}
+	if len(prsByHead) == 0 {
+		deps.InfoLog.Printf("no open reviews authored by %s", author)
+		return nil
+	}
+
+	// Order the PRs by stack, from the top of each stack down to its root, to
+	// match the ordering of plz status for the local stack.
+	children := map[string][]*github.PullRequest{}
+	var roots []*github.PullRequest
+	for _, pr := range prs {
+		if _, ok := prsByHead[pr.GetHead().GetRef()]; !ok {
+			continue
+		}
+		if _, ok := prsByHead[pr.GetBase().GetRef()]; ok {
+			children[pr.GetBase().GetRef()] = append(children[pr.GetBase().GetRef()], pr)
+		} else {
+			roots = append(roots, pr)
+		}
+	}
+	var ordered []*github.PullRequest
+	var visit func(pr *github.PullRequest)
+	visit = func(pr *github.PullRequest) {
+		for _, child := range children[pr.GetHead().GetRef()] {
+			visit(child)
+		}
+		ordered = append(ordered, pr)
+	}
+	stackSizes := make([]int, len(roots))
+	for i, root := range roots {
+		numOrdered := len(ordered)
+		visit(root)
+		stackSizes[i] = len(ordered) - numOrdered
+	}
+
+	commits := make([]stack.RemoteCommit, len(ordered))
+	for i, pr := range ordered {
+		commits[i] = stack.RemoteCommit{
+			ReviewID: strings.TrimPrefix(pr.GetHead().GetRef(), reviewBranchPrefix),
+			Commit: &object.Commit{
+				Hash:    plumbing.NewHash(pr.GetHead().GetSHA()),
+				Message: pr.GetTitle(),
+			},
+			Parent: &object.Commit{Hash: plumbing.NewHash(pr.GetBase().GetSHA())},
+		}
+	}
+	loaded, err := stack.LoadRemote(ctx, graphqlClient, commits)
+	if err != nil {
+		return err
+	}
+	loadStatusDetails(ctx, graphqlClient, loaded)
+	var stacks []stack.CommitStack
+	var s stack.CommitStack
+	for _, size := range stackSizes {
+		st := loaded[:size]
+		loaded = loaded[size:]
+		if stackName == "" || st.Name() == stackName {
+			stacks = append(stacks, st)
+			s = append(s, st...)
+		}
+	}
+	if len(stacks) == 0 {
+		deps.InfoLog.Printf("no open stack named %s authored by %s", stackName, author)
+		return nil
+	}
+	var checks map[string]checkState
+	if showChecks {
+		checks, err = loadCheckStates(ctx, gitHubRepo.Client(), gitHubRepo.Owner(), gitHubRepo.Name(), s)
+		if err != nil {
+			return err
+		}
+	}
+	if porcelain != nil {
+		return writePorcelainStatus(porcelain, stacks, checks)
+	}
+	th, err := loadTheme(deps.Config, deps.Color)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	for _, st := range stacks {
+		if name := st.Name(); name != "" {
+			fmt.Fprintf(w, "stack %s:\n", name)
+		}
+		for _, ci := range st {
+			printReviewStatus(w, th, ci, checks, "")
+		}
+	}
+	return errors.WithStack(w.Flush())
+}
+
+// listReviewPRs returns all open PRs in the repo whose head branch is a plz
+// review branch.
+func listReviewPRs(ctx context.Context, gitHubRepo *gitHubRepo) ([]*github.PullRequest, error) {
+	var reviewPRs []*github.PullRequest
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		prs, resp, err := gitHubRepo.Client().PullRequests.List(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			opts,
+		)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, pr := range prs {
+			if strings.HasPrefix(pr.GetHead().GetRef(), reviewBranchPrefix) {
+				reviewPRs = append(reviewPRs, pr)
+			}
+		}
+		if resp.NextPage == 0 {
+			return reviewPRs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/graphql"
 	"github.com/urfave/cli/v2"
@@ -27,8 +28,39 @@ type syncUpdatedReview struct {
 	} `graphql:"latestRevisionList: revisionList(options: {count: 1})"`
 }
 
+// SyncOptions are the options of RunSync, which correspond to the flags of plz
+// sync.
+type SyncOptions struct {
+	All         bool
+	NoRebase    bool
+	DryRun      bool
+	Continue    bool
+	Abort       bool
+	Prune       bool
+	PruneRemote bool
+	NoLFS       bool
+	// Autostash stashes uncommitted changes to tracked files before syncing
+	// and restores them afterwards, like --autostash.
+	Autostash bool
+}
+
 func Sync(c *cli.Context) error {
-	ctx := c.Context
+	return RunSync(c.Context, &SyncOptions{
+		All:         c.Bool("all"),
+		NoRebase:    c.Bool("no-rebase"),
+		DryRun:      c.Bool("dry-run"),
+		Continue:    c.Bool("continue"),
+		Abort:       c.Bool("abort"),
+		Prune:       c.Bool("prune"),
+		PruneRemote: c.Bool("prune-remote"),
+		NoLFS:       c.Bool("no-lfs"),
+		Autostash:   autostashFlag(c),
+	})
+}
+
+// RunSync updates the local review branches of the repository in the current
+// directory, like plz sync. ctx must carry Deps, see deps.ContextWithDeps.
+func RunSync(ctx context.Context, options *SyncOptions) error {
 	deps := deps.FromContext(ctx)
 
 	token, err := deps.Auth.Token()
@@ -43,21 +75,49 @@ func Sync(c *cli.Context) error {
 		Transport: &authTransport{Token: token},
 	})
 
-	isClean, err := isCleanWorktree(ctx, gitHubRepo)
-	if err != nil {
+	if options.Continue || options.Abort {
+		if options.DryRun {
+			return errors.New("--dry-run cannot be used with --continue or --abort")
+		}
+		return resumeSync(ctx, options, gitHubRepo, graphqlClient)
+	}
+	if state, err := loadSyncState(gitHubRepo.GitRepo()); err != nil {
 		return err
+	} else if state != nil {
+		return errors.New("a sync stopped on a conflict, run plz sync --continue or plz sync --abort")
+	}
+
+	switch {
+	case options.All:
+		err = syncAllBranches(ctx, gitHubRepo, graphqlClient, options.DryRun)
+	case options.DryRun:
+		err = printSyncPlan(ctx, options, gitHubRepo, graphqlClient)
+	default:
+		err = syncStack(ctx, options, gitHubRepo, graphqlClient)
 	}
-	if !isClean {
-		return errors.Errorf("index is not clean")
+	if err != nil || !options.Prune {
+		return err
 	}
+	return pruneReviewBranches(ctx, gitHubRepo, graphqlClient, options.PruneRemote, options.DryRun)
+}
+
+// syncStack updates the stack under HEAD.
+func syncStack(ctx context.Context, options *SyncOptions, gitHubRepo *gitHubRepo, graphqlClient *graphql.Client) error {
+	deps := deps.FromContext(ctx)
 
 	repo := gitHubRepo.GitRepo()
+	stash, err := requireCleanWorktree(ctx, options.Autostash)
+	if err != nil {
+		return err
+	}
+	defer finishSyncAutostash(ctx, repo, stash)
+
 	headRef, err := repo.Head()
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	headRefName := headRef.Name()
-	deps.DebugLog.Printf("HEAD is %v at %v", headRefName, headRef.Hash())
+	deps.GitDebugLog.Printf("HEAD is %v at %v", headRefName, headRef.Hash())
 	if !headRefName.IsBranch() {
 		return errors.Errorf("HEAD is not a branch")
 	}
@@ -66,7 +126,11 @@ func Sync(c *cli.Context) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	base := loadStackBase(repo, headRefName)
+	if base == "" {
+		base = gitHubRepo.DefaultBranch()
+	}
+	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, base)
 	if err != nil {
 		return err
 	}
@@ -74,13 +138,18 @@ func Sync(c *cli.Context) error {
 		return nil
 	}
 
-	newBase := ""
+	// Process the stack from the bottom up, applying updates until the first
+	// commit that has diverged from the published stack. newBase tracks the
+	// commit that the rest of the stack should sit on.
+	var newBase plumbing.Hash
 	var newHeadRef *plumbing.Reference
+	numSynced := 0
+	notes := map[plumbing.Hash]stack.Note{}
 	i := len(s) - 1
 	for ; i >= 0; i-- {
 		ci := s[i]
 		status := ci.Status()
-		deps.DebugLog.Println("examining", ci.Commit.Hash.String(), "with status", status)
+		deps.StackDebugLog.Println("examining", ci.Commit.Hash.String(), "with status", status)
 		if status == stack.CommitStatusNew || status == stack.CommitStatusModified {
 			break
 		}
@@ -106,13 +175,14 @@ func Sync(c *cli.Context) error {
 			// Specify new base commit for the stack starting at merge commit.
 			// There may be other merged reviews on top, so continue processing
 			// the stack.
-			newBase = latestRevision.HeadCommitSHA
+			newBase = plumbing.NewHash(latestRevision.HeadCommitSHA)
+			numSynced++
 			continue
 		}
 		var mutation struct {
 			Review syncUpdatedReview `graphql:"syncReviewWithParent(reviewID: $reviewID)"`
 		}
-		deps.DebugLog.Println("syncing review", review.ID)
+		deps.StackDebugLog.Println("syncing review", review.ID)
 		err = graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
 			"reviewID": graphql.ID(review.ID),
 		})
@@ -124,7 +194,7 @@ func Sync(c *cli.Context) error {
 		if updatedLatestRevision.HeadCommitSHA == ci.Commit.Hash.String() {
 			continue
 		}
-		deps.DebugLog.Printf("pulling branch for review %v: %v", review.ID, review.HeadBranch)
+		deps.GitDebugLog.Printf("pulling branch for review %v: %v", review.ID, review.HeadBranch)
 		err = pullBranch(ctx, gitHubRepo, review.HeadBranch)
 		if err != nil {
 			return err
@@ -141,37 +211,103 @@ func Sync(c *cli.Context) error {
 				newHeadRef.Hash(), updatedLatestRevision.HeadCommitSHA,
 			)
 		}
-		newBase = review.HeadBranch
+		newBase = newHeadRef.Hash()
+		numSynced++
+		notes[newHeadRef.Hash()] = stack.Note{
+			ReviewID: review.ID,
+			Revision: updatedLatestRevision.Number,
+			GitHubPR: review.GitHubPR,
+			Status:   review.Status,
+		}
+	}
+	if err := stack.WriteNotes(repo, notes); err != nil {
+		deps.GitDebugLog.Printf("failed to write notes: %v", err)
 	}
 
 	// Re-point the tip review's branch to what was fetched.
-	if i >= 0 && newBase != "" {
-		return errors.Errorf(
-			"some commits are ahead, run git rebase --onto %s %s~%d",
-			newBase,
-			headRefName.Short(),
+	var newHead plumbing.Hash
+	if newHeadRef != nil {
+		newHead = newHeadRef.Hash()
+	}
+	if i >= 0 && !newBase.IsZero() {
+		// The commits from here up haven't been published, so they can't be
+		// updated from the remote. Rebase them onto the synced stack, handing
+		// any conflicts over to Git, or with --no-rebase, leave them alone and
+		// spell out the plz rebase-onto that moves them.
+		var rebaseErr error
+		if !options.NoRebase {
+			commits := make([]*object.Commit, i+1)
+			for j := range commits {
+				commits[j] = s[j].Commit
+			}
+			newHead, rebaseErr = rebaseCommits(ctx, repo, commits, newBase)
+			var conflictErr *rebaseConflictError
+			if errors.As(rebaseErr, &conflictErr) {
+				deps.InfoLog.Printf("synced %d reviews, rebasing %d unpublished commits onto them", numSynced, i+1)
+				return startSyncConflict(ctx, options, repo, gitHubRepo, graphqlClient, headRefName, headRef.Hash(), commits, conflictErr)
+			}
+		}
+		if rebaseErr != nil {
+			return rebaseErr
+		}
+		if options.NoRebase {
+			divergent := s[i].Commit
+			return errors.Errorf(
+				"synced %d reviews, but %d commits starting at %s are not part of the published stack\n"+
+					"move them onto the synced stack with:\n\n"+
+					"    plz rebase-onto %s %s\n\n"+
+					"then run plz review to publish them",
+				numSynced,
+				i+1,
+				divergent.Hash.String()[:8],
+				newBase,
+				divergent.Hash,
+			)
+		}
+		deps.InfoLog.Printf(
+			"synced %d reviews and rebased %d unpublished commits onto them, run plz review to publish them",
+			numSynced,
 			i+1,
 		)
-	} else if newHeadRef != nil {
-		deps.DebugLog.Println("repointing", headRefName, "to", newHeadRef.Hash())
-		err = gitHubRepo.GitRepo().Storer.SetReference(
-			plumbing.NewHashReference(headRefName, newHeadRef.Hash()),
-		)
-		if err != nil {
-			return err
-		}
-		worktree, err := repo.Worktree()
-		if err != nil {
+	}
+	return finishSync(ctx, options, gitHubRepo, graphqlClient, headRefName, newHead, s)
+}
+
+// finishSync points the stack's branch at its synced head, unless that's zero,
+// and records the synced stack. It's shared by plz sync and by plz sync
+// --continue once a conflict has been resolved.
+func finishSync(
+	ctx context.Context,
+	options *SyncOptions,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	branch plumbing.ReferenceName,
+	newHead plumbing.Hash,
+	s stack.CommitStack,
+) error {
+	deps := deps.FromContext(ctx)
+	repo := gitHubRepo.GitRepo()
+	if !newHead.IsZero() {
+		deps.GitDebugLog.Println("repointing", branch, "to", newHead)
+		if err := resetBranch(repo, branch, newHead); err != nil {
 			return err
 		}
-		err = worktree.Reset(&git.ResetOptions{
-			Commit: newHeadRef.Hash(),
-			Mode:   git.HardReset,
-		})
-		if err != nil {
-			return err
+		if !options.NoLFS {
+			if err := checkoutLFSFiles(ctx, repo); err != nil {
+				return err
+			}
 		}
 	}
+	if err := stack.LoadStackNames(ctx, graphqlClient, s); err != nil {
+		deps.GraphQLDebugLog.Printf("failed to load stack names: %v", err)
+	}
+	stack.Save(ctx, repo, s)
+	if err := setStackLabels(ctx, gitHubRepo, openStackPRs(s)); err != nil {
+		return err
+	}
+	if deps.Config.GetBool("watchPR", false) {
+		return mirrorStackToGitHub(ctx, gitHubRepo, graphqlClient, s)
+	}
 	return nil
 }
 
@@ -182,16 +318,21 @@ func pullBranch(ctx context.Context, repo *gitHubRepo, name string) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	deps.DebugLog.Printf("fetching branch %v", name)
+	deps.GitDebugLog.Printf("fetching branch %v", name)
 	refSpec := fmt.Sprintf(
 		"+refs/heads/%[1]s:refs/remotes/%[2]s/%[1]s",
 		name,
 		git.DefaultRemoteName,
 	)
-	err = remote.FetchContext(ctx, &git.FetchOptions{
+	fetchCtx, cancel := withPushTimeout(ctx)
+	err = remote.FetchContext(fetchCtx, &git.FetchOptions{
 		RefSpecs: []config.RefSpec{config.RefSpec(refSpec)},
 		Auth:     repo.GitAuth(),
 	})
+	cancel()
+	if timeoutErr := pushTimeoutError(fetchCtx, "fetch of "+name); timeoutErr != nil {
+		return timeoutErr
+	}
 	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
 		return errors.WithStack(err)
 	}
@@ -200,8 +341,8 @@ func pullBranch(ctx context.Context, repo *gitHubRepo, name string) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	deps.DebugLog.Println("repointing", name, "to", updatedRef.Hash())
 	localRefName := plumbing.NewBranchReferenceName(name)
+	deps.GitDebugLog.Println("repointing", name, "to", updatedRef.Hash())
 	err = gitRepo.Storer.SetReference(plumbing.NewHashReference(localRefName, updatedRef.Hash()))
 	if err != nil {
 		return errors.WithStack(err)
@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// syncAllBranches updates every local review branch to the latest revision of
+// its review, regardless of the stack under HEAD, and prints a summary. The
+// branch that HEAD points to is skipped since updating it would leave the
+// worktree out of step. With dryRun, the summary says what would be done to
+// each branch instead.
+func syncAllBranches(ctx context.Context, gitHubRepo *gitHubRepo, graphqlClient *graphql.Client, dryRun bool) error {
+	deps := deps.FromContext(ctx)
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	branches, err := localReviewBranches(repo)
+	if err != nil {
+		return err
+	}
+	if len(branches) == 0 {
+		deps.InfoLog.Println("no local review branches")
+		return nil
+	}
+
+	states, err := loadReviewBranchStates(ctx, graphqlClient, branches)
+	if err != nil {
+		return err
+	}
+	numFailed := 0
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	for i, ref := range branches {
+		reviewID := strings.TrimPrefix(ref.Name().Short(), reviewBranchPrefix)
+		var result string
+		if dryRun {
+			result = describeBranchSync(ref, states[i], headRef.Name())
+		} else {
+			result, err = syncReviewBranch(ctx, gitHubRepo, ref, reviewID, states[i], headRef.Name())
+		}
+		if err != nil {
+			result = "failed: " + err.Error()
+			numFailed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", reviewID, shortSHA(ref.Hash().String()), result)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	if numFailed > 0 {
+		return errors.Errorf("failed to sync %d of %d review branches", numFailed, len(branches))
+	}
+	return nil
+}
+
+// syncReviewBranch updates a single local review branch, whose review is in
+// the given state, and describes the result.
+func syncReviewBranch(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	ref *plumbing.Reference,
+	reviewID string,
+	state stack.ReviewState,
+	headRefName plumbing.ReferenceName,
+) (string, error) {
+	deps := deps.FromContext(ctx)
+	if state.Status != stack.ReviewStatusOpen {
+		return string(state.Status), nil
+	}
+	if ref.Name() == headRefName {
+		return "checked out, skipped", nil
+	}
+	deps.GitDebugLog.Printf("pulling branch for review %v: %v", reviewID, state.HeadBranch)
+	if err := pullBranch(ctx, gitHubRepo, state.HeadBranch); err != nil {
+		return "", err
+	}
+	updated, err := gitHubRepo.GitRepo().Reference(ref.Name(), true)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if updated.Hash() == ref.Hash() {
+		return "up to date", nil
+	}
+	return "updated to " + shortSHA(updated.Hash().String()), nil
+}
+
+// localReviewBranches returns the local branches that plz created for reviews.
+func localReviewBranches(repo *git.Repository) ([]*plumbing.Reference, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var branches []*plumbing.Reference
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if name.IsBranch() && strings.HasPrefix(name.Short(), reviewBranchPrefix) {
+			branches = append(branches, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return branches, nil
+}
+
+// loadReviewBranchStates returns the state of the review of each of the local
+// review branches, in the same order, with as few queries as possible, since
+// repos may have hundreds of review branches.
+func loadReviewBranchStates(
+	ctx context.Context,
+	graphqlClient *graphql.Client,
+	branches []*plumbing.Reference,
+) ([]stack.ReviewState, error) {
+	reviewIDs := make([]string, len(branches))
+	for i, ref := range branches {
+		reviewIDs[i] = strings.TrimPrefix(ref.Name().Short(), reviewBranchPrefix)
+	}
+	return stack.LoadReviewStates(ctx, graphqlClient, reviewIDs)
+}
@@ -0,0 +1,279 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// syncStateFile is the file, relative to the .git directory, recording the
+// progress of a plz sync that stopped on a conflict.
+const syncStateFile = "plz/sync-state.json"
+
+// syncState is the progress of a plz sync that stopped on a conflict. The
+// conflicting commit is being cherry-picked with Git, and the remaining
+// commits are replayed on top once the conflict is resolved.
+type syncState struct {
+	Branch   string `json:"branch"`
+	OrigHead string `json:"origHead"`
+	// Remaining lists the commits still to be replayed, bottom first.
+	Remaining []string `json:"remaining"`
+	// Autostash is the stash commit of changes stashed by --autostash, to be
+	// restored once the sync is over.
+	Autostash string `json:"autostash,omitempty"`
+}
+
+func loadSyncState(repo *git.Repository) (*syncState, error) {
+	fs, ok := stack.DotGitFilesystem(repo)
+	if !ok {
+		return nil, nil
+	}
+	b, err := util.ReadFile(fs, syncStateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	var state syncState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.Errorf("corrupt %s, remove it to start over", syncStateFile)
+	}
+	return &state, nil
+}
+
+func saveSyncState(repo *git.Repository, state *syncState) error {
+	fs, ok := stack.DotGitFilesystem(repo)
+	if !ok {
+		return errors.New("cannot save sync progress for this repository")
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := fs.MkdirAll("plz", 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(util.WriteFile(fs, syncStateFile, b, 0o644))
+}
+
+func removeSyncState(repo *git.Repository) error {
+	fs, ok := stack.DotGitFilesystem(repo)
+	if !ok {
+		return nil
+	}
+	err := fs.Remove(syncStateFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// startSyncConflict hands a conflicting commit over to git cherry-pick, which
+// can merge file contents and writes conflict markers where it can't. The
+// branch is first pointed at the commits rebased so far. commits are the
+// commits that were being rebased, top first. If Git resolves the conflict on
+// its own, the rest of the commits are replayed straight away. gitHubRepo and
+// graphqlClient are nil for plz rebase-onto, which only moves commits locally.
+func startSyncConflict(
+	ctx context.Context,
+	options *SyncOptions,
+	repo *git.Repository,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	branch plumbing.ReferenceName,
+	origHead plumbing.Hash,
+	commits []*object.Commit,
+	conflictErr *rebaseConflictError,
+) error {
+	deps := deps.FromContext(ctx)
+	state := &syncState{Branch: branch.String(), OrigHead: origHead.String()}
+	for i := conflictErr.index - 1; i >= 0; i-- {
+		state.Remaining = append(state.Remaining, commits[i].Hash.String())
+	}
+	if err := saveSyncState(repo, state); err != nil {
+		return err
+	}
+	if err := resetBranch(repo, branch, conflictErr.onto); err != nil {
+		return err
+	}
+	if !options.NoLFS {
+		// The cherry-pick below only smudges the files it changes.
+		if err := checkoutLFSFiles(ctx, repo); err != nil {
+			return err
+		}
+	}
+	deps.GitDebugLog.Println("cherry-picking", conflictErr.commit, "onto", conflictErr.onto)
+	if err := runGit(ctx, "cherry-pick", "--allow-empty", conflictErr.commit.String()); err != nil {
+		deps.ErrorLog.Println(err)
+		return errors.Errorf(
+			"%v\nresolve the conflicts and git add the files, then run plz sync --continue, or run plz sync --abort",
+			conflictErr,
+		)
+	}
+	return continueSync(ctx, options, repo, gitHubRepo, graphqlClient, state)
+}
+
+// resumeSync handles plz sync --continue and --abort.
+func resumeSync(ctx context.Context, options *SyncOptions, gitHubRepo *gitHubRepo, graphqlClient *graphql.Client) error {
+	repo := gitHubRepo.GitRepo()
+	state, err := loadSyncState(repo)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return errors.New("no sync in progress")
+	}
+	// Restore stashed changes once the sync is over, unless it stops on
+	// another conflict.
+	defer finishSyncAutostash(ctx, repo, state.Autostash)
+	if options.Abort {
+		if isCherryPicking(repo) {
+			if err := runGit(ctx, "cherry-pick", "--abort"); err != nil {
+				return err
+			}
+		}
+		err := resetBranch(repo, plumbing.ReferenceName(state.Branch), plumbing.NewHash(state.OrigHead))
+		if err != nil {
+			return err
+		}
+		if err := removeSyncState(repo); err != nil {
+			return err
+		}
+		if options.NoLFS {
+			return nil
+		}
+		return checkoutLFSFiles(ctx, repo)
+	}
+	if isCherryPicking(repo) {
+		if err := runGit(ctx, "-c", "core.editor=true", "cherry-pick", "--continue"); err != nil {
+			return err
+		}
+	}
+	return continueSync(ctx, options, repo, gitHubRepo, graphqlClient, state)
+}
+
+// continueSync replays the remaining commits of an interrupted sync onto
+// HEAD, then finishes the sync like plz sync would have without the conflict.
+func continueSync(
+	ctx context.Context,
+	options *SyncOptions,
+	repo *git.Repository,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	state *syncState,
+) error {
+	deps := deps.FromContext(ctx)
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	commits := make([]*object.Commit, len(state.Remaining))
+	for i, sha := range state.Remaining {
+		commit, err := repo.CommitObject(plumbing.NewHash(sha))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		commits[len(commits)-1-i] = commit
+	}
+	newHead, err := rebaseCommits(ctx, repo, commits, headRef.Hash())
+	var conflictErr *rebaseConflictError
+	if errors.As(err, &conflictErr) {
+		return startSyncConflict(
+			ctx,
+			options,
+			repo,
+			gitHubRepo,
+			graphqlClient,
+			plumbing.ReferenceName(state.Branch),
+			plumbing.NewHash(state.OrigHead),
+			commits,
+			conflictErr,
+		)
+	} else if err != nil {
+		return err
+	}
+	if err := removeSyncState(repo); err != nil {
+		return err
+	}
+	branch := plumbing.ReferenceName(state.Branch)
+	if gitHubRepo == nil {
+		if err := resetBranch(repo, branch, newHead); err != nil {
+			return err
+		}
+		if !options.NoLFS {
+			if err := checkoutLFSFiles(ctx, repo); err != nil {
+				return err
+			}
+		}
+		deps.InfoLog.Println("rebased the commits, run plz review to publish them")
+		return nil
+	}
+	newHeadCommit, err := repo.CommitObject(newHead)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s, err := stack.Load(ctx, repo, graphqlClient, newHeadCommit, gitHubRepo.DefaultBranch())
+	if err != nil {
+		return err
+	}
+	if err := finishSync(ctx, options, gitHubRepo, graphqlClient, branch, newHead, s); err != nil {
+		return err
+	}
+	deps.InfoLog.Println("rebased unpublished commits onto the synced stack, run plz review to publish them")
+	return nil
+}
+
+// resetBranch points the branch at the given commit, checks it out and resets
+// the worktree to match.
+func resetBranch(repo *git.Repository, branch plumbing.ReferenceName, hash plumbing.Hash) error {
+	err := repo.Storer.SetReference(plumbing.NewHashReference(branch, hash))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset})
+	return errors.WithStack(err)
+}
+
+func isCherryPicking(repo *git.Repository) bool {
+	fs, ok := stack.DotGitFilesystem(repo)
+	if !ok {
+		return false
+	}
+	_, err := fs.Stat("CHERRY_PICK_HEAD")
+	return err == nil
+}
+
+// runGit runs a git command that may need the user's attention, passing its
+// output through.
+func runGit(ctx context.Context, args ...string) error {
+	deps := deps.FromContext(ctx)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = deps.InfoLog.Writer()
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+)
+
+// printSyncPlan prints what plz sync would do to the stack under HEAD without
+// syncing any reviews, fetching or moving any branches, or touching the
+// worktree. Whether syncing a review with its parent produces a new revision
+// is only known once the server has done it, so those steps are described as
+// possible.
+func printSyncPlan(ctx context.Context, options *SyncOptions, gitHubRepo *gitHubRepo, graphqlClient *graphql.Client) error {
+	deps := deps.FromContext(ctx)
+
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headRefName := headRef.Name()
+	if !headRefName.IsBranch() {
+		return errors.Errorf("HEAD is not a branch")
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s, err := stack.Load(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	if err != nil {
+		return err
+	}
+	if len(s) == 0 {
+		deps.InfoLog.Println("nothing to sync")
+		return nil
+	}
+
+	// Mirror the bottom up walk in syncStack. headMoves is "yes" once a
+	// review is known to bring in new commits, and "maybe" if that depends on
+	// the outcome of syncing a review with its parent.
+	plans := make([][]string, len(s))
+	headMoves := "no"
+	i := len(s) - 1
+walk:
+	for ; i >= 0; i-- {
+		ci := s[i]
+		status := ci.Status()
+		if status == stack.CommitStatusNew || status == stack.CommitStatusModified {
+			break
+		}
+		review := ci.Review
+		switch {
+		case review.Status == stack.ReviewStatusDeleted:
+			plans[i] = []string{"review deleted, skip"}
+		case review.Status == stack.ReviewStatusMerged && status == stack.CommitStatusCurrent:
+			plans[i] = []string{"review merged, skip"}
+		case review.Status == stack.ReviewStatusMerged && status != stack.CommitStatusBehind:
+			plans[i] = []string{"review merged but has local modifications, sync would fail here"}
+			headMoves = "no, sync would fail"
+			break walk
+		case review.Status == stack.ReviewStatusMerged:
+			plans[i] = []string{
+				"fetch and re-point branch " + review.LatestRevision.BaseBranch,
+				"restack onto merge commit " + shortSHA(review.LatestRevision.HeadCommitSHA),
+			}
+			headMoves = "yes"
+		case status == stack.CommitStatusBehind:
+			plans[i] = []string{
+				"sync review " + review.ID + " with its parent",
+				fmt.Sprintf(
+					"fetch and re-point branch %s to revision %d or later",
+					review.HeadBranch,
+					review.LatestRevision.Number,
+				),
+			}
+			headMoves = "yes"
+		default:
+			plans[i] = []string{
+				"sync review " + review.ID + " with its parent",
+				"if that creates a revision, fetch and re-point branch " + review.HeadBranch,
+			}
+			if headMoves == "no" {
+				headMoves = "maybe"
+			}
+		}
+	}
+	synced := !strings.HasPrefix(headMoves, "no")
+	for j := i; j >= 0; j-- {
+		if plans[j] != nil {
+			continue
+		}
+		switch {
+		case !synced:
+			plans[j] = []string{"leave alone"}
+		case options.NoRebase:
+			plans[j] = []string{"not published, print how to rebase it"}
+		default:
+			plans[j] = []string{"not published, rebase onto the synced stack"}
+		}
+	}
+	if synced && i >= 0 && options.NoRebase {
+		headMoves += ", but not past the unpublished commits"
+	}
+
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	for i := range s {
+		ci := s[i]
+		parts := strings.SplitN(ci.Commit.Message, "\n", 2)
+		title := strings.TrimSpace(parts[0])
+		if len(title) > 47 {
+			title = title[:47] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\n", shortSHA(ci.Commit.Hash.String()), title)
+		for _, step := range plans[i] {
+			fmt.Fprintf(w, "\t%s\n", step)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	deps.InfoLog.Printf("\nhard reset %s and the worktree: %s", headRefName.Short(), headMoves)
+	if isClean, err := isCleanWorktree(ctx); err != nil {
+		return err
+	} else if !isClean {
+		deps.InfoLog.Println("index is not clean, sync would refuse to run")
+	}
+	return nil
+}
+
+// describeBranchSync describes what plz sync --all would do to a single local
+// review branch, whose review is in the given state, for --dry-run.
+func describeBranchSync(
+	ref *plumbing.Reference,
+	state stack.ReviewState,
+	headRefName plumbing.ReferenceName,
+) string {
+	if state.Status != stack.ReviewStatusOpen {
+		return string(state.Status) + ", skip"
+	}
+	if ref.Name() == headRefName {
+		return "checked out, skip"
+	}
+	return "fetch " + state.HeadBranch + " from " + git.DefaultRemoteName + " and re-point"
+}
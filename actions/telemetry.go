@@ -0,0 +1,155 @@
+package actions
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/auth"
+	"github.com/bitcomplete/plz-cli/client/config"
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+// telemetryTimeout bounds how long plz waits to record usage, so that
+// telemetry never noticeably slows down a command.
+const telemetryTimeout = 2 * time.Second
+
+// Error classes recorded by telemetry. They say what kind of thing went wrong
+// without including the error message, which may mention repository data.
+const (
+	telemetryErrorNone     = "none"
+	telemetryErrorCanceled = "canceled"
+	telemetryErrorAuth     = "auth"
+	telemetryErrorTimeout  = "timeout"
+	telemetryErrorNetwork  = "network"
+	telemetryErrorExit     = "exit"
+	telemetryErrorOther    = "other"
+)
+
+// RecordUsageInput is the input to the recordUsage mutation. The name must
+// match the GraphQL type.
+type RecordUsageInput struct {
+	Command    string `json:"command"`
+	DurationMS int    `json:"durationMs"`
+	ErrorClass string `json:"errorClass"`
+	Version    string `json:"version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+}
+
+// Telemetry handles plz telemetry status, on and off.
+func Telemetry(c *cli.Context) error {
+	deps := deps.FromContext(c.Context)
+	switch action := c.Args().First(); action {
+	case "", "status":
+		if reason := telemetryDisabledByEnv(); reason != "" {
+			deps.InfoLog.Printf("telemetry is off because %s is set", reason)
+		} else if telemetryEnabled(deps.Config) {
+			deps.InfoLog.Println("telemetry is on, plz records the command, its duration and the class of any error, plz telemetry off turns it off")
+		} else {
+			deps.InfoLog.Println("telemetry is off, plz telemetry on turns it on")
+		}
+		return nil
+	case "on", "off":
+		// Set globally, since usage is the same whichever repository plz is
+		// run in.
+		if err := runGit(c.Context, "config", "--global", "plz.telemetry", action); err != nil {
+			return err
+		}
+		deps.InfoLog.Println("telemetry is", action)
+		if cfg, err := config.Load(); err == nil && cfg.GetBool("telemetry", false) != (action == "on") {
+			deps.ErrorLog.Printf(
+				"warning: plz.telemetry is set to %s in this repository, which takes precedence here",
+				cfg.Get("telemetry"),
+			)
+		}
+		return nil
+	default:
+		return errors.New("usage: plz telemetry [status|on|off]")
+	}
+}
+
+// telemetryEnabled returns whether the user has opted in to telemetry with
+// plz.telemetry, and hasn't opted out with PLZ_NO_TELEMETRY or DO_NOT_TRACK.
+func telemetryEnabled(cfg *config.Config) bool {
+	return cfg.GetBool("telemetry", false) && telemetryDisabledByEnv() == ""
+}
+
+// telemetryDisabledByEnv returns the environment variable that turns
+// telemetry off regardless of plz.telemetry, if any is set.
+func telemetryDisabledByEnv() string {
+	for _, name := range []string{"PLZ_NO_TELEMETRY", "DO_NOT_TRACK"} {
+		if v := os.Getenv(name); v != "" && v != "0" {
+			return name
+		}
+	}
+	return ""
+}
+
+// RecordTelemetry records that a command ran, if the user has opted in. Only
+// the command name, e.g. "review" or "stack squash", how long it took, the
+// class of error it failed with, and the plz version, OS and architecture are
+// sent, anonymously; never arguments, error messages or anything about the
+// repository. Failures are only logged, since telemetry must not get in the
+// way.
+func RecordTelemetry(ctx context.Context, command string, duration time.Duration, err error, version string) {
+	deps := deps.FromContext(ctx)
+	if deps.Config == nil || !telemetryEnabled(deps.Config) {
+		return
+	}
+	// The command's context may have been canceled, e.g. by Ctrl-C, which
+	// is worth recording too.
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+	defer cancel()
+	// The request is anonymous, so it doesn't carry credentials.
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: deps.Transport,
+	})
+	var mutation struct {
+		RecordUsage bool `graphql:"recordUsage(input: $input)"`
+	}
+	mutateErr := graphqlClient.Mutate(ctx, &mutation, map[string]interface{}{
+		"input": RecordUsageInput{
+			Command:    command,
+			DurationMS: int(duration / time.Millisecond),
+			ErrorClass: telemetryErrorClass(err),
+			Version:    version,
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+		},
+	})
+	if mutateErr != nil {
+		deps.APIDebugLog.Printf("failed to record telemetry: %v", mutateErr)
+	}
+}
+
+// telemetryErrorClass classifies an error for telemetry.
+func telemetryErrorClass(err error) string {
+	var netErr net.Error
+	var exitCoder cli.ExitCoder
+	switch {
+	case err == nil:
+		return telemetryErrorNone
+	case errors.Is(err, context.Canceled):
+		return telemetryErrorCanceled
+	case errors.Is(err, auth.ErrNoAuthCredentials):
+		return telemetryErrorAuth
+	case errors.Is(err, context.DeadlineExceeded):
+		return telemetryErrorTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return telemetryErrorTimeout
+		}
+		return telemetryErrorNetwork
+	case errors.As(err, &exitCoder):
+		return telemetryErrorExit
+	default:
+		return telemetryErrorOther
+	}
+}
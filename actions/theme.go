@@ -0,0 +1,118 @@
+package actions
+
+import (
+	"github.com/bitcomplete/plz-cli/client/config"
+	"github.com/pkg/errors"
+)
+
+// colorRole is the meaning conveyed by a piece of colored output.
+type colorRole int
+
+const (
+	// roleOK is used for reviews that are up to date.
+	roleOK colorRole = iota
+	// roleWarn is used for reviews that need attention, e.g. are behind.
+	roleWarn
+	// roleInfo is used for reviews that are done, e.g. merged.
+	roleInfo
+	// roleError is used for reviews that need to be published.
+	roleError
+)
+
+const (
+	asciiColorReset = "\033[m"
+	asciiBold       = "\033[1m"
+)
+
+// themes maps theme names, as set with plz.theme, to the colors for each role.
+var themes = map[string]map[colorRole]string{
+	"default": {
+		roleOK:    "\033[32m",
+		roleWarn:  "\033[33m",
+		roleInfo:  "\033[36m",
+		roleError: "\033[31m",
+	},
+	"high-contrast": {
+		roleOK:    "\033[1;92m",
+		roleWarn:  "\033[1;93m",
+		roleInfo:  "\033[1;96m",
+		roleError: "\033[1;91m",
+	},
+	// Blue and orange stay distinguishable with the common forms of color
+	// blindness, unlike green and red.
+	"color-blind": {
+		roleOK:    "\033[38;5;33m",
+		roleWarn:  "\033[38;5;220m",
+		roleInfo:  "\033[38;5;250m",
+		roleError: "\033[38;5;208m",
+	},
+}
+
+// roleSymbols are shown alongside colors when plz.symbols is enabled, so that
+// state can be told apart without relying on color.
+var roleSymbols = map[colorRole]string{
+	roleOK:    "✓",
+	roleWarn:  "~",
+	roleInfo:  "·",
+	roleError: "✗",
+}
+
+// theme controls how colored output is rendered. colors is nil if output isn't
+// colored.
+type theme struct {
+	colors  map[colorRole]string
+	symbols bool
+}
+
+// loadTheme returns the theme selected by the plz.theme and plz.symbols
+// settings, without colors if color is false.
+func loadTheme(cfg *config.Config, color bool) (*theme, error) {
+	name := cfg.Get("theme")
+	if name == "" {
+		name = "default"
+	}
+	colors, ok := themes[name]
+	if !ok {
+		return nil, errors.Errorf(
+			"invalid plz.theme value %q, must be one of default, high-contrast or color-blind",
+			name,
+		)
+	}
+	if !color {
+		colors = nil
+	}
+	return &theme{
+		colors:  colors,
+		symbols: cfg.GetBool("symbols", false),
+	}, nil
+}
+
+// color returns the escape sequence that starts text with the given role.
+func (t *theme) color(role colorRole) string {
+	return t.colors[role]
+}
+
+// reset returns the escape sequence that ends colored text.
+func (t *theme) reset() string {
+	if t.colors == nil {
+		return ""
+	}
+	return asciiColorReset
+}
+
+// symbol returns the symbol prefix for the given role, or an empty string if
+// symbols are disabled.
+func (t *theme) symbol(role colorRole) string {
+	if !t.symbols {
+		return ""
+	}
+	return roleSymbols[role] + " "
+}
+
+// bold returns text in bold if color is true.
+func bold(color bool, text string) string {
+	if !color {
+		return text
+	}
+	return asciiBold + text + asciiColorReset
+}
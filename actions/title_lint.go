@@ -0,0 +1,107 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/pkg/errors"
+)
+
+// Values for the plz.titleLint setting.
+const (
+	titleLintOff          = "off"
+	titleLintConventional = "conventional"
+)
+
+// defaultConventionalTypes are the commit types allowed by
+// plz.titleLint=conventional unless plz.conventionalTypes says otherwise.
+var defaultConventionalTypes = []string{
+	"build", "chore", "ci", "docs", "feat", "fix", "perf", "refactor", "revert", "style", "test",
+}
+
+// conventionalTitleRegex matches titles of the form type(scope)!: description,
+// where the scope and ! are optional.
+var conventionalTitleRegex = regexp.MustCompile(`^([A-Za-z]+)(\([^()]+\))?(!)?: (\S.*)$`)
+
+// lintTitles checks the titles of the commits that are new or modified
+// against plz.titleLint and plz.titlePattern, and reports every title that
+// fails before refusing to publish.
+func lintTitles(ctx context.Context, ris []*reviewInfo) error {
+	deps := deps.FromContext(ctx)
+
+	mode := deps.Config.Get("titleLint")
+	switch mode {
+	case "", titleLintOff, titleLintConventional:
+	default:
+		return errors.Errorf("invalid plz.titleLint value %q, must be off or conventional", mode)
+	}
+	var pattern *regexp.Regexp
+	if p := deps.Config.Get("titlePattern"); p != "" {
+		var err error
+		if pattern, err = regexp.Compile(p); err != nil {
+			return errors.Errorf("invalid plz.titlePattern: %v", err)
+		}
+	}
+	if mode != titleLintConventional && pattern == nil {
+		return nil
+	}
+	types := defaultConventionalTypes
+	if v := deps.Config.Get("conventionalTypes"); v != "" {
+		types = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	failures := 0
+	for _, ri := range ris {
+		if ri.Status() == stack.CommitStatusCurrent {
+			// Already published as is, so it's too late to complain.
+			continue
+		}
+		title := commitTitle(ri.Commit.Message)
+		var problems []string
+		if mode == titleLintConventional {
+			if problem := conventionalTitleProblem(title, types); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+		if pattern != nil && !pattern.MatchString(title) {
+			problems = append(problems, "doesn't match plz.titlePattern "+pattern.String())
+		}
+		for _, problem := range problems {
+			deps.ErrorLog.Printf("%s %q: %s", shortSHA(ri.Commit.Hash.String()), title, problem)
+		}
+		if len(problems) > 0 {
+			failures++
+		}
+	}
+	if failures == 1 {
+		return errors.New(
+			"1 commit title doesn't follow the rules, reword it, e.g. with git rebase -i, or use --no-verify to publish anyway",
+		)
+	}
+	if failures > 0 {
+		return errors.Errorf(
+			"%d commit titles don't follow the rules, reword them, e.g. with git rebase -i, or use --no-verify to publish anyway",
+			failures,
+		)
+	}
+	return nil
+}
+
+// conventionalTitleProblem returns what's wrong with title as a Conventional
+// Commits title with one of the given types, or an empty string if nothing is.
+func conventionalTitleProblem(title string, types []string) string {
+	matches := conventionalTitleRegex.FindStringSubmatch(title)
+	if matches == nil {
+		return "isn't of the form type(scope): description"
+	}
+	for _, t := range types {
+		if matches[1] == t {
+			return ""
+		}
+	}
+	return fmt.Sprintf("type %s isn't one of %s", matches[1], strings.Join(types, ", "))
+}
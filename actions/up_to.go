@@ -0,0 +1,75 @@
+package actions
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// resolveUpTo resolves the --up-to argument of plz review, which selects the
+// top of the part of the stack to publish. It may be a commit, a review ID or a
+// number of commits counting from the bottom of the stack. It returns the hash
+// of the selected commit and the commits above it, top first.
+func resolveUpTo(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	base string,
+	headHash plumbing.Hash,
+	upTo string,
+) (plumbing.Hash, []*object.Commit, error) {
+	repo := gitHubRepo.GitRepo()
+	headCommit, err := repo.CommitObject(headHash)
+	if err != nil {
+		return plumbing.ZeroHash, nil, errors.WithStack(err)
+	}
+	commits, err := stack.LocalCommits(ctx, repo, headCommit, base)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	index := -1
+	// Short numbers are counts. Anything longer is more likely to be an
+	// abbreviated commit hash.
+	if n, err := strconv.Atoi(upTo); err == nil && len(upTo) < 4 {
+		if n < 1 || n > len(commits) {
+			return plumbing.ZeroHash, nil, errors.Errorf(
+				"cannot publish %d commits, stack has %d",
+				n,
+				len(commits),
+			)
+		}
+		index = len(commits) - n
+	}
+	if index < 0 {
+		index, err = stackCommitIndex(repo, commits, upTo)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+	}
+	return commits[index].Hash, commits[:index], nil
+}
+
+// stackCommitIndex returns the index in commits of the commit identified by
+// arg, which may be a review ID or anything that resolves to a commit.
+func stackCommitIndex(repo *git.Repository, commits []*object.Commit, arg string) (int, error) {
+	for i, commit := range commits {
+		if stack.ReviewIDFromCommitMessage(commit.Message) == arg {
+			return i, nil
+		}
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(arg))
+	if err != nil {
+		return -1, errors.Errorf("cannot resolve %q to a commit", arg)
+	}
+	for i, commit := range commits {
+		if commit.Hash == *hash {
+			return i, nil
+		}
+	}
+	return -1, errors.Errorf("commit %s is not in the stack", hash)
+}
@@ -0,0 +1,101 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// Verify checks the attestations on the commits in the current stack, as added
+// by plz review when plz.attest is enabled.
+func Verify(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	if !c.Bool("attestations") {
+		return errors.New("nothing to verify, pass --attestations")
+	}
+
+	repo, err := openGitRepo()
+	if err != nil {
+		return err
+	}
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defaultBranch := remoteDefaultBranch(repo)
+	if defaultBranch == "" {
+		token, err := deps.Auth.Token()
+		if err != nil {
+			return err
+		}
+		gitHubRepo, err := newGitHubRepo(ctx, token)
+		if err != nil {
+			return err
+		}
+		defaultBranch = gitHubRepo.DefaultBranch()
+	}
+	commits, err := stack.LocalCommits(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return err
+	}
+
+	numFailed := 0
+	w := tabwriter.NewWriter(deps.InfoLog.Writer(), 0, 0, 1, ' ', 0)
+	for _, commit := range commits {
+		parts := strings.SplitN(commit.Message, "\n", 2)
+		title := strings.TrimSpace(parts[0])
+		if len(title) > 47 {
+			title = title[:47] + "..."
+		}
+		result, err := verifyCommitAttestation(commit.Message)
+		if err != nil {
+			result = "FAILED: " + err.Error()
+			numFailed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", commit.Hash.String()[:8], title, result)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	if numFailed > 0 {
+		return errors.Errorf("%d of %d attestations failed verification", numFailed, len(commits))
+	}
+	return nil
+}
+
+// verifyCommitAttestation verifies the attestation in a commit message and
+// describes the result.
+func verifyCommitAttestation(message string) (string, error) {
+	payload, sig, ok, err := attestationFromCommitMessage(message)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "no attestation", nil
+	}
+	signer, err := verifyAttestation(payload, sig)
+	if err != nil {
+		return "", err
+	}
+	reviewID := stack.ReviewIDFromCommitMessage(message)
+	if attested := attestationField(payload, "review"); attested != reviewID {
+		return "", errors.Errorf("attestation is for review %s, commit is for review %s", attested, reviewID)
+	}
+	return fmt.Sprintf(
+		"published by %s from %s, signed by %s",
+		attestationField(payload, "publisher"),
+		attestationField(payload, "host"),
+		signer,
+	), nil
+}
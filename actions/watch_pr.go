@@ -0,0 +1,279 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// revisionLabelPrefix prefixes the PR label that mirrors a review's latest
+	// revision number, e.g. revision-3.
+	revisionLabelPrefix = "revision-"
+	// statusCommentMarker identifies the PR comment that mirrors a review's
+	// revision history.
+	statusCommentMarker = "<!-- plz:watch-pr -->"
+)
+
+// WatchPR mirrors the plz review status of the current stack onto the GitHub
+// PRs, so that reviewers who only use GitHub can follow along. When
+// plz.watchPR is enabled this also happens automatically on review and sync.
+func WatchPR(c *cli.Context) error {
+	ctx := c.Context
+	deps := deps.FromContext(ctx)
+
+	token, err := deps.Auth.Token()
+	if err != nil {
+		return err
+	}
+	gitHubRepo, err := newGitHubRepo(ctx, token)
+	if err != nil {
+		return err
+	}
+	graphqlClient := graphql.NewClient(deps.PlzAPIBaseURL+"/api/v1", &http.Client{
+		Transport: &authTransport{Token: token},
+	})
+
+	repo := gitHubRepo.GitRepo()
+	headRef, err := repo.Head()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s, err := stack.LoadLocal(ctx, repo, graphqlClient, headCommit, gitHubRepo.DefaultBranch())
+	if err != nil {
+		return err
+	}
+	return mirrorStackToGitHub(ctx, gitHubRepo, graphqlClient, s)
+}
+
+// mirrorStackToGitHub mirrors the status of each open review in the stack onto
+// its PR.
+func mirrorStackToGitHub(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	s stack.CommitStack,
+) error {
+	for _, ci := range s {
+		if ci.Review == nil || ci.Review.Status != stack.ReviewStatusOpen {
+			continue
+		}
+		err := mirrorReviewToGitHub(ctx, gitHubRepo, graphqlClient, ci.Review.ID, ci.GitHubPR)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorReviewToGitHub labels the review's PR with its latest revision number
+// and maintains a comment listing the review's revisions.
+func mirrorReviewToGitHub(
+	ctx context.Context,
+	gitHubRepo *gitHubRepo,
+	graphqlClient *graphql.Client,
+	reviewID string,
+	prNumber int,
+) error {
+	deps := deps.FromContext(ctx)
+	var query struct {
+		Review struct {
+			RevisionList struct {
+				Revisions []stack.Revision `graphql:"revisions"`
+			} `graphql:"revisionList(options: {count: 100})"`
+		} `graphql:"review(id: $reviewId)"`
+	}
+	err := graphqlClient.Query(ctx, &query, map[string]interface{}{
+		"reviewId": graphql.ID(reviewID),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	revisions := query.Review.RevisionList.Revisions
+	if len(revisions) == 0 {
+		return nil
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	latest := revisions[len(revisions)-1]
+	deps.APIDebugLog.Printf("mirroring review %v revision %v to PR %v", reviewID, latest.Number, prNumber)
+
+	err = setRevisionLabel(ctx, gitHubRepo, prNumber, latest.Number)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\n", statusCommentMarker)
+	fmt.Fprintf(
+		&body,
+		"This PR is managed by [plz.review](https://plz.review/review/%s) and is at revision %d.\n\n",
+		reviewID,
+		latest.Number,
+	)
+	fmt.Fprintf(&body, "| Revision | Commit | Base |\n| --- | --- | --- |\n")
+	for i := len(revisions) - 1; i >= 0; i-- {
+		r := revisions[i]
+		fmt.Fprintf(
+			&body,
+			"| [%d](https://plz.review/review/%s/revision/%d) | %s | %s |\n",
+			r.Number,
+			reviewID,
+			r.Number,
+			shortSHA(r.HeadCommitSHA),
+			r.BaseBranch,
+		)
+	}
+	return upsertStatusComment(ctx, gitHubRepo, prNumber, body.String())
+}
+
+// setRevisionLabel makes sure that the PR's only revision label is the one for
+// the given revision number.
+func setRevisionLabel(ctx context.Context, gitHubRepo *gitHubRepo, prNumber int, revision int) error {
+	return setPrefixedLabels(ctx, gitHubRepo, prNumber, map[string]string{
+		revisionLabelPrefix: fmt.Sprintf("%s%d", revisionLabelPrefix, revision),
+	})
+}
+
+// isNumberedLabel returns whether the label name is prefix followed by a
+// number, e.g. revision-3 for the prefix revision-.
+func isNumberedLabel(name string, prefix string) bool {
+	number := strings.TrimPrefix(name, prefix)
+	if number == name || number == "" {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// setPrefixedLabels maintains labels that carry a number, such as revision-3.
+// For each prefix, the PR gets the wanted label, and any other labels made up
+// of the same prefix and a number are removed. Other labels that happen to
+// start with the prefix, e.g. revision-needed, aren't plz's and are left alone.
+func setPrefixedLabels(ctx context.Context, gitHubRepo *gitHubRepo, prNumber int, want map[string]string) error {
+	client := gitHubRepo.Client()
+	labels, _, err := client.Issues.ListLabelsByIssue(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		prNumber,
+		&github.ListOptions{PerPage: 100},
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	hasLabel := map[string]bool{}
+	for _, label := range labels {
+		name := label.GetName()
+		for prefix, wantName := range want {
+			if name == wantName {
+				hasLabel[name] = true
+			} else if isNumberedLabel(name, prefix) {
+				_, err := client.Issues.RemoveLabelForIssue(
+					ctx,
+					gitHubRepo.Owner(),
+					gitHubRepo.Name(),
+					prNumber,
+					name,
+				)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		}
+	}
+	var toAdd []string
+	for _, name := range want {
+		if !hasLabel[name] {
+			toAdd = append(toAdd, name)
+		}
+	}
+	if len(toAdd) > 0 {
+		sort.Strings(toAdd)
+		_, _, err := client.Issues.AddLabelsToIssue(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			prNumber,
+			toAdd,
+		)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// upsertStatusComment creates or updates the PR comment identified by
+// statusCommentMarker.
+func upsertStatusComment(ctx context.Context, gitHubRepo *gitHubRepo, prNumber int, body string) error {
+	client := gitHubRepo.Client()
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := client.Issues.ListComments(
+			ctx,
+			gitHubRepo.Owner(),
+			gitHubRepo.Name(),
+			prNumber,
+			opts,
+		)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, comment := range comments {
+			if !strings.HasPrefix(comment.GetBody(), statusCommentMarker) {
+				continue
+			}
+			if comment.GetBody() == body {
+				return nil
+			}
+			_, _, err := client.Issues.EditComment(
+				ctx,
+				gitHubRepo.Owner(),
+				gitHubRepo.Name(),
+				comment.GetID(),
+				&github.IssueComment{Body: &body},
+			)
+			return errors.WithStack(err)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	_, _, err := client.Issues.CreateComment(
+		ctx,
+		gitHubRepo.Owner(),
+		gitHubRepo.Name(),
+		prNumber,
+		&github.IssueComment{Body: &body},
+	)
+	return errors.WithStack(err)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
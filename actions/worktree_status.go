@@ -0,0 +1,415 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/bitcomplete/plz-cli/client/stack"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// isCleanWorktree returns whether the index and worktree match HEAD. Untracked
+// files count as changes unless Deps.IgnoreUntracked is set.
+func isCleanWorktree(ctx context.Context) (bool, error) {
+	deps := deps.FromContext(ctx)
+	repo, err := openGitRepo()
+	if err != nil {
+		return false, err
+	}
+	start := time.Now()
+	isClean, err := worktreeIsClean(repo, !deps.IgnoreUntracked)
+	deps.GitDebugLog.Printf("worktree clean: %v, checked in %v", isClean, time.Since(start))
+	return isClean, err
+}
+
+// worktreeIsClean is a fast, native version of checking that git status
+// --porcelain prints nothing. go-git's Worktree.Status hashes every file,
+// which is very slow in large repos (https://github.com/go-git/go-git/issues/181),
+// so like Git it trusts the stat information recorded in the index, and only
+// hashes files whose size and modification time are ambiguous. Files are
+// hashed without Git's clean filters and line ending conversion, so files that
+// look changed but may be converted, e.g. LFS files, or any file when
+// core.autocrlf is set, are checked with git status instead.
+func worktreeIsClean(repo *git.Repository, checkUntracked bool) (bool, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	root := worktree.Filesystem.Root()
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	tracked := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		// Unmerged entries have a non-zero stage. index.Merged is wrongly 1,
+		// the same as index.AncestorMode.
+		if e.Stage != 0 || e.IntentToAdd {
+			return false, nil
+		}
+		tracked[e.Name] = e
+	}
+
+	if isClean, err := indexMatchesHead(repo, tracked); err != nil || !isClean {
+		return false, err
+	}
+
+	// Files modified in the same instant as the index was written may have
+	// changed without their stat information changing, so they're hashed.
+	var indexModTime time.Time
+	if fs, ok := stack.DotGitFilesystem(repo); ok {
+		if fi, err := fs.Stat("index"); err == nil {
+			indexModTime = fi.ModTime()
+		}
+	}
+	// Files that look changed but that Git may convert, which are checked
+	// with git status once all the others are found to be unchanged.
+	var conversions *conversionMatcher
+	var converted []string
+	trustFileMode := true
+	if cfg, err := repo.Config(); err == nil {
+		trustFileMode = cfg.Raw.Section("core").Options.Get("filemode") != "false"
+	}
+	for _, e := range idx.Entries {
+		if e.SkipWorktree || e.Mode == filemode.Submodule {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(e.Name))
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, errors.WithStack(err)
+		}
+		changed, err := entryChanged(e, path, fi, indexModTime, trustFileMode)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			if conversions == nil {
+				conversions = newConversionMatcher(repo, root, idx)
+			}
+			if !conversions.mayConvert(e.Name) {
+				return false, nil
+			}
+			converted = append(converted, e.Name)
+		}
+	}
+	if len(converted) > 0 {
+		if isClean, err := gitStatusIsClean(root, converted); err != nil || !isClean {
+			return false, err
+		}
+	}
+
+	if checkUntracked {
+		hasUntracked, err := hasUntrackedFiles(repo, root, tracked)
+		if err != nil || hasUntracked {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// indexMatchesHead returns whether the index entries are exactly the files of
+// the HEAD commit, i.e. nothing is staged.
+func indexMatchesHead(repo *git.Repository, tracked map[string]*index.Entry) (bool, error) {
+	headRef, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// An unborn branch, so anything in the index is staged.
+		return len(tracked) == 0, nil
+	} else if err != nil {
+		return false, errors.WithStack(err)
+	}
+	headCommit, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	tree, err := headCommit.Tree()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	numFiles := 0
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return false, errors.WithStack(err)
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		e, ok := tracked[name]
+		if !ok || e.Hash != entry.Hash || e.Mode != entry.Mode {
+			return false, nil
+		}
+		numFiles++
+	}
+	return numFiles == len(tracked), nil
+}
+
+// entryChanged returns whether the file at path differs from its index entry.
+func entryChanged(
+	e *index.Entry,
+	path string,
+	fi os.FileInfo,
+	indexModTime time.Time,
+	trustFileMode bool,
+) (bool, error) {
+	isSymlink := fi.Mode()&os.ModeSymlink != 0
+	switch e.Mode {
+	case filemode.Symlink:
+		if !isSymlink {
+			return true, nil
+		}
+	case filemode.Regular, filemode.Executable, filemode.Deprecated:
+		if !fi.Mode().IsRegular() {
+			return true, nil
+		}
+		if trustFileMode && (fi.Mode()&0111 != 0) != (e.Mode == filemode.Executable) {
+			return true, nil
+		}
+	default:
+		return true, nil
+	}
+	// The index records sizes truncated to 32 bits. Git records a size of
+	// zero for racily clean files, to force their contents to be compared.
+	if uint32(fi.Size()) != e.Size && e.Size != 0 {
+		return true, nil
+	}
+	if fi.ModTime().Equal(e.ModifiedAt) && fi.ModTime().Before(indexModTime) {
+		return false, nil
+	}
+
+	if isSymlink {
+		// A symlink's blob is its target, and its size the target's length.
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return plumbing.ComputeHash(plumbing.BlobObject, []byte(filepath.ToSlash(target))) != e.Hash, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	defer f.Close()
+	h := plumbing.NewHasher(plumbing.BlobObject, fi.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return h.Sum() != e.Hash, nil
+}
+
+// conversionMatcher reports which files Git may convert between the worktree
+// and the index, with a clean filter such as LFS's or by converting line
+// endings, so that their raw contents can't be compared with the index.
+type conversionMatcher struct {
+	autocrlf   bool
+	attributes gitattributes.Matcher
+}
+
+// newConversionMatcher reads core.autocrlf and the repo's attributes files.
+// Only .gitattributes files in the index are read, rather than walking the
+// worktree for them. Unreadable files are skipped, since the worst that can
+// happen is that a converted file counts as changed.
+func newConversionMatcher(repo *git.Repository, root string, idx *index.Index) *conversionMatcher {
+	m := &conversionMatcher{}
+	if autocrlf, err := gitConfigValueIn(root, "core.autocrlf"); err == nil {
+		m.autocrlf = autocrlf != "" && autocrlf != "false"
+	}
+	rootFS := osfs.New("/")
+	var patterns []gitattributes.MatchAttribute
+	if ps, err := gitattributes.LoadSystemPatterns(rootFS); err == nil {
+		patterns = append(patterns, ps...)
+	}
+	if ps, err := gitattributes.LoadGlobalPatterns(rootFS); err == nil {
+		patterns = append(patterns, ps...)
+	}
+	// Deeper .gitattributes files take precedence, so they come later.
+	var dirs [][]string
+	for _, e := range idx.Entries {
+		if path.Base(e.Name) == ".gitattributes" {
+			dirs = append(dirs, strings.Split(path.Dir(e.Name), "/"))
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return len(dirs[i]) < len(dirs[j]) })
+	worktreeFS := osfs.New(root)
+	for _, dir := range dirs {
+		if len(dir) == 1 && dir[0] == "." {
+			dir = nil
+		}
+		ps, err := gitattributes.ReadAttributesFile(worktreeFS, dir, ".gitattributes", dir == nil)
+		if err == nil {
+			patterns = append(patterns, ps...)
+		}
+	}
+	if fs, ok := stack.DotGitFilesystem(repo); ok {
+		if ps, err := gitattributes.ReadAttributesFile(fs, nil, path.Join("info", "attributes"), true); err == nil {
+			patterns = append(patterns, ps...)
+		}
+	}
+	m.attributes = gitattributes.NewMatcher(patterns)
+	return m
+}
+
+// mayConvert returns whether Git may convert the file with the given name.
+func (m *conversionMatcher) mayConvert(name string) bool {
+	if m.autocrlf {
+		return true
+	}
+	attrs, _ := m.attributes.Match(strings.Split(name, "/"), []string{"filter", "text", "eol"})
+	for _, attr := range attrs {
+		if !attr.IsUnset() && !attr.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
+
+// gitStatusIsClean returns whether git status reports no changes to the given
+// tracked files, which it compares after applying any conversions.
+func gitStatusIsClean(root string, names []string) (bool, error) {
+	args := []string{"status", "--porcelain", "--untracked-files=no"}
+	// Past a point, checking everything is cheaper than a huge command line.
+	if len(names) <= 1000 {
+		args = append(args, "--")
+		for _, name := range names {
+			args = append(args, ":(literal)"+name)
+		}
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return false, errors.Errorf("git status failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Len() == 0, nil
+}
+
+// hasUntrackedFiles returns whether the worktree has files that are neither
+// tracked nor ignored. Ignored directories aren't descended into.
+func hasUntrackedFiles(repo *git.Repository, root string, tracked map[string]*index.Entry) (bool, error) {
+	rootFS := osfs.New("/")
+	var patterns []gitignore.Pattern
+	if ps, err := gitignore.LoadSystemPatterns(rootFS); err == nil {
+		patterns = append(patterns, ps...)
+	}
+	if ps, err := gitignore.LoadGlobalPatterns(rootFS); err == nil && ps != nil {
+		patterns = append(patterns, ps...)
+	} else if path := defaultGlobalIgnoreFile(); path != "" {
+		// Git's default when core.excludesFile isn't set.
+		patterns = append(patterns, readIgnoreFile(path, nil)...)
+	}
+	if fs, ok := stack.DotGitFilesystem(repo); ok {
+		// Opened through fs, which finds it in the common directory of
+		// linked worktrees.
+		if f, err := fs.Open("info/exclude"); err == nil {
+			patterns = append(patterns, parseIgnorePatterns(f, nil)...)
+			f.Close()
+		}
+	}
+	return walkUntracked(root, nil, patterns, tracked)
+}
+
+// walkUntracked looks for untracked files in the directory dir, relative to
+// root, which is split into its components.
+func walkUntracked(
+	root string,
+	dir []string,
+	patterns []gitignore.Pattern,
+	tracked map[string]*index.Entry,
+) (bool, error) {
+	path := filepath.Join(append([]string{root}, dir...)...)
+	// Copy before appending, since the caller reuses patterns for other
+	// directories.
+	patterns = append(patterns[:len(patterns):len(patterns)], readIgnoreFile(filepath.Join(path, ".gitignore"), dir)...)
+	matcher := gitignore.NewMatcher(patterns)
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == git.GitDirName {
+			continue
+		}
+		parts := append(dir[:len(dir):len(dir)], entry.Name())
+		name := strings.Join(parts, "/")
+		if _, ok := tracked[name]; ok {
+			continue
+		}
+		isDir := entry.IsDir()
+		if matcher.Match(parts, isDir) {
+			continue
+		}
+		if !isDir {
+			return true, nil
+		}
+		found, err := walkUntracked(root, parts, patterns, tracked)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// readIgnoreFile reads the gitignore patterns of the file at path, which apply
+// to the directory dir. A missing file has no patterns.
+func readIgnoreFile(path string, dir []string) []gitignore.Pattern {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return parseIgnorePatterns(f, dir)
+}
+
+// parseIgnorePatterns parses gitignore patterns that apply to the directory
+// dir.
+func parseIgnorePatterns(r io.Reader, dir []string) []gitignore.Pattern {
+	var patterns []gitignore.Pattern
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, dir))
+	}
+	return patterns
+}
+
+// defaultGlobalIgnoreFile returns $XDG_CONFIG_HOME/git/ignore, or
+// ~/.config/git/ignore.
+func defaultGlobalIgnoreFile() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "git", "ignore")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "git", "ignore")
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"time"
@@ -11,7 +12,6 @@ import (
 	"github.com/cli/oauth/device"
 	"github.com/pkg/browser"
 	"github.com/pkg/errors"
-	"github.com/zalando/go-keyring"
 )
 
 var ErrNoAuthCredentials = errors.New("no auth credentials")
@@ -27,60 +27,106 @@ type state struct {
 
 type Auth struct {
 	plzAPIBaseURL string
+	profile       string
+	httpClient    *http.Client
+	store         string
+	errorLog      *log.Logger
 	*state
 }
 
-func New(plzAPIBaseURL string) *Auth {
-	return &Auth{plzAPIBaseURL: plzAPIBaseURL}
+// New returns an Auth that sends its requests with transport, which may be nil
+// to use http.DefaultTransport.
+func New(plzAPIBaseURL string, transport http.RoundTripper, errorLog *log.Logger) *Auth {
+	if errorLog == nil {
+		errorLog = log.New(io.Discard, "", 0)
+	}
+	return &Auth{
+		plzAPIBaseURL: plzAPIBaseURL,
+		httpClient:    &http.Client{Transport: transport},
+		errorLog:      errorLog,
+	}
 }
 
-func Prompt(plzAPIBaseURL string) (*Auth, error) {
-	httpClient := http.DefaultClient
-	gitHubAppClientID, err := fetchGitHubAppClientID(httpClient, plzAPIBaseURL)
-	if err != nil {
+// SetProfile selects the profile whose credentials are used, see plz
+// --profile. The default profile has an empty name.
+func (a *Auth) SetProfile(profile string) {
+	a.profile = profile
+	a.state = nil
+}
+
+// Profile returns the name of the selected profile.
+func (a *Auth) Profile() string {
+	return a.profile
+}
+
+func (a *Auth) credentialsName() string {
+	return credentialsName(a.plzAPIBaseURL, a.profile)
+}
+
+// Prompt signs in to the default profile with GitHub's device flow, writing
+// instructions for the user to errorLog, colored if color is true.
+func Prompt(plzAPIBaseURL string, transport http.RoundTripper, errorLog *log.Logger, color bool) (*Auth, error) {
+	a := New(plzAPIBaseURL, transport, errorLog)
+	if err := a.Prompt(color); err != nil {
 		return nil, err
 	}
+	return a, nil
+}
+
+// Prompt signs in with GitHub's device flow, writing instructions for the user
+// to the error log, colored if color is true. Save stores the new
+// credentials.
+func (a *Auth) Prompt(color bool) error {
+	gitHubAppClientID, err := fetchGitHubAppClientID(a.httpClient, a.plzAPIBaseURL)
+	if err != nil {
+		return err
+	}
 	code, err := device.RequestCode(
-		httpClient,
+		a.httpClient,
 		"https://github.com/login/device/code",
 		gitHubAppClientID,
 		nil,
 	)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
-	fmt.Printf("\033[33m!\033[m First copy your one-time code: \033[1m%s\033[m\n", code.UserCode)
-	fmt.Println("Press Enter to open github.com in your browser...")
+	if color {
+		a.errorLog.Printf("\033[33m!\033[m First copy your one-time code: \033[1m%s\033[m", code.UserCode)
+	} else {
+		a.errorLog.Printf("! First copy your one-time code: %s", code.UserCode)
+	}
+	a.errorLog.Println("Press Enter to open github.com in your browser...")
 	fmt.Scanln()
 	if err = browser.OpenURL(code.VerificationURI); err != nil {
-		fmt.Println("Could not open a browser:", err)
-		fmt.Println("Please visit this URL in your browser manually:", code.VerificationURI)
+		a.errorLog.Println("Could not open a browser:", err)
+		a.errorLog.Println("Please visit this URL in your browser manually:", code.VerificationURI)
 	}
 	accessToken, err := device.PollToken(
-		httpClient,
+		a.httpClient,
 		"https://github.com/login/oauth/access_token",
 		gitHubAppClientID,
 		code,
 	)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 	// The device library doesn't return the expiry time, so we have to
 	// immediately refresh the token to get the expiry time.
-	state, err := loadStateFromRefreshToken(plzAPIBaseURL, accessToken.RefreshToken)
+	state, err := loadStateFromRefreshToken(a.httpClient, a.plzAPIBaseURL, accessToken.RefreshToken)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &Auth{
-		plzAPIBaseURL: plzAPIBaseURL,
-		state:         state,
-	}, nil
+	a.state = state
+	return nil
 }
 
 func (a *Auth) Token() (string, error) {
 	if a.state == nil {
-		state, err := loadStateFromKeyRing(a.plzAPIBaseURL)
-		if err != nil {
+		state, err := loadState(a.credentialsName())
+		var fileErr *credentialsFileError
+		if errors.Is(err, errKeyringUnavailable) || errors.As(err, &fileErr) {
+			return "", err
+		} else if err != nil {
 			return "", ErrNoAuthCredentials
 		}
 		a.state = state
@@ -91,12 +137,12 @@ func (a *Auth) Token() (string, error) {
 			// When refresh token is expired, we have to re-auth from scratch.
 			return "", ErrNoAuthCredentials
 		}
-		state, err := loadStateFromRefreshToken(a.plzAPIBaseURL, a.state.RefreshToken)
+		state, err := loadStateFromRefreshToken(a.httpClient, a.plzAPIBaseURL, a.state.RefreshToken)
 		if err != nil {
 			return "", errors.Wrap(err, "failed to refresh auth token")
 		}
 		a.state = state
-		err = a.SaveToKeyRing()
+		err = a.Save()
 		if err != nil {
 			return "", errors.Wrap(err, "failed to save new auth token while refreshing")
 		}
@@ -104,15 +150,33 @@ func (a *Auth) Token() (string, error) {
 	return a.state.Token, nil
 }
 
-func (a *Auth) SaveToKeyRing() error {
+// Scope returns the scopes granted to the token, once Token has been called.
+func (a *Auth) Scope() string {
+	if a.state == nil {
+		return ""
+	}
+	return a.state.Scope
+}
+
+// SetStore chooses where Save stores credentials, either StoreKeyring or
+// StoreFile. By default the keyring is used unless it's unavailable.
+func (a *Auth) SetStore(store string) error {
+	if store != StoreKeyring && store != StoreFile {
+		return errors.Errorf("invalid credential store %q, must be keyring or file", store)
+	}
+	a.store = store
+	return nil
+}
+
+func (a *Auth) Save() error {
 	stateJSON, err := json.Marshal(a.state)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	return errors.WithStack(keyring.Set("plz", "authState", string(stateJSON)))
+	return saveStateJSON(a.credentialsName(), a.store, string(stateJSON), a.errorLog)
 }
 
-func loadStateFromRefreshToken(plzAPIBaseURL, refreshToken string) (*state, error) {
+func loadStateFromRefreshToken(client *http.Client, plzAPIBaseURL, refreshToken string) (*state, error) {
 	params := url.Values{"refresh_token": {refreshToken}}
 	refreshURL := fmt.Sprintf(
 		"%s/auth/github/device/refresh?%s",
@@ -124,7 +188,7 @@ func loadStateFromRefreshToken(plzAPIBaseURL, refreshToken string) (*state, erro
 		return nil, errors.WithStack(err)
 	}
 	req.Header.Add("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -168,10 +232,10 @@ func fetchGitHubAppClientID(client *http.Client, plzAPIBaseURL string) (string,
 	return string(clientIDBytes), nil
 }
 
-func loadStateFromKeyRing(plzAPIBaseURL string) (*state, error) {
-	authInfoJSON, err := keyring.Get("plz", "authState")
+func loadState(name string) (*state, error) {
+	authInfoJSON, err := loadStateJSON(name)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 	var state state
 	err = json.Unmarshal([]byte(authInfoJSON), &state)
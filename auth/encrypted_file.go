@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase that the
+// file store encrypts credentials with. Without it, a key derived from the
+// machine and user is used, which keeps credentials from being usable if the
+// file is copied elsewhere but doesn't protect them from other programs run
+// by the same user.
+const PassphraseEnv = "PLZ_CREDENTIALS_PASSPHRASE"
+
+const (
+	keySourcePassphrase = "passphrase"
+	keySourceMachine    = "machine"
+)
+
+// credentialsFileError is returned when the file store exists but can't be
+// read, e.g. because the passphrase is missing, so that it's reported rather
+// than treated as not being signed in.
+type credentialsFileError struct {
+	message string
+}
+
+func (e *credentialsFileError) Error() string {
+	return e.message
+}
+
+func newCredentialsFileError(format string, args ...interface{}) error {
+	return errors.WithStack(&credentialsFileError{message: fmt.Sprintf(format, args...)})
+}
+
+// encryptedCredentials is the format of the file store.
+type encryptedCredentials struct {
+	Version    int    `json:"version"`
+	KeySource  string `json:"keySource"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// encryptCredentials encrypts stateJSON with AES-GCM, using a key derived
+// with scrypt from the passphrase or, if none is set, the machine.
+func encryptCredentials(stateJSON string) ([]byte, error) {
+	keySource, secret, err := credentialsSecret()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	aead, err := credentialsCipher(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	b, err := json.Marshal(&encryptedCredentials{
+		Version:    1,
+		KeySource:  keySource,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, []byte(stateJSON), nil),
+	})
+	return b, errors.WithStack(err)
+}
+
+// decryptCredentials reverses encryptCredentials. Files written before
+// credentials were encrypted are returned as is.
+func decryptCredentials(b []byte, path string) (string, error) {
+	var ec encryptedCredentials
+	if err := json.Unmarshal(b, &ec); err != nil {
+		return "", newCredentialsFileError("invalid credentials file %s, run plz auth", path)
+	}
+	if ec.Version == 0 {
+		return string(b), nil
+	}
+	keySource, secret, err := credentialsSecret()
+	if err != nil {
+		return "", err
+	}
+	if keySource != ec.KeySource {
+		if ec.KeySource == keySourcePassphrase {
+			return "", newCredentialsFileError("credentials in %s are encrypted with a passphrase, set %s", path, PassphraseEnv)
+		}
+		return "", newCredentialsFileError(
+			"credentials in %s aren't encrypted with a passphrase, unset %s or run plz auth again",
+			path,
+			PassphraseEnv,
+		)
+	}
+	aead, err := credentialsCipher(secret, ec.Salt)
+	if err != nil {
+		return "", err
+	}
+	stateJSON, err := aead.Open(nil, ec.Nonce, ec.Ciphertext, nil)
+	if err != nil {
+		if keySource == keySourcePassphrase {
+			return "", newCredentialsFileError("cannot decrypt credentials in %s, check %s", path, PassphraseEnv)
+		}
+		return "", newCredentialsFileError("cannot decrypt credentials in %s, they may be from another machine, run plz auth", path)
+	}
+	return string(stateJSON), nil
+}
+
+// credentialsSecret returns what the credentials key is derived from.
+func credentialsSecret() (string, []byte, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return keySourcePassphrase, []byte(passphrase), nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	machineID := ""
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if b, err := os.ReadFile(path); err == nil {
+			machineID = strings.TrimSpace(string(b))
+			break
+		}
+	}
+	if machineID == "" {
+		if machineID, err = os.Hostname(); err != nil {
+			return "", nil, errors.WithStack(err)
+		}
+	}
+	sum := sha256.Sum256([]byte(machineID + "\x00" + u.Uid + "\x00" + u.Username))
+	return keySourceMachine, sum[:], nil
+}
+
+func credentialsCipher(secret []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.WithStack(err)
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	// StoreKeyring stores credentials in the system keyring.
+	StoreKeyring = "keyring"
+	// StoreFile stores credentials in an encrypted file only readable by the
+	// current user, see PassphraseEnv.
+	StoreFile = "file"
+)
+
+// keyringTimeout bounds how long to wait for the system keyring. On macOS,
+// keychain access from some terminals shows password dialogs that may never
+// be answered, or is silently denied.
+const keyringTimeout = 5 * time.Second
+
+var errKeyringUnavailable = errors.New("system keyring unavailable")
+
+// DefaultPlzAPIBaseURL is the base URL of the plz.review API.
+const DefaultPlzAPIBaseURL = "https://api.plz.review"
+
+// credentialsName returns the name under which credentials for the plz API at
+// plzAPIBaseURL and the given profile are stored, so that signing in to
+// another plz server or with another profile doesn't replace the credentials
+// for plz.review. Those have an empty name, and are stored where they were
+// before credentials were kept per URL and profile.
+func credentialsName(plzAPIBaseURL string, profile string) string {
+	plzAPIBaseURL = strings.TrimSuffix(plzAPIBaseURL, "/")
+	if plzAPIBaseURL == DefaultPlzAPIBaseURL && profile == "" {
+		return ""
+	}
+	if profile != "" {
+		return plzAPIBaseURL + "#" + profile
+	}
+	return plzAPIBaseURL
+}
+
+// keyringUser returns the keyring entry holding the named credentials.
+func keyringUser(name string) string {
+	if name == "" {
+		return "authState"
+	}
+	return "authState " + name
+}
+
+// credentialsPath returns the path of the file-based store for the named
+// credentials.
+func credentialsPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	file := "auth.json"
+	if name != "" {
+		sum := sha256.Sum256([]byte(name))
+		file = "auth-" + hex.EncodeToString(sum[:8]) + ".json"
+	}
+	return filepath.Join(dir, "plz", file), nil
+}
+
+func readCredentialsFile(name string) (string, error) {
+	path, err := credentialsPath(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return decryptCredentials(b, path)
+}
+
+// credentialsFileExists returns whether the file store is in use.
+func credentialsFileExists(name string) bool {
+	path, err := credentialsPath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func writeCredentialsFile(name string, stateJSON string) error {
+	path, err := credentialsPath(name)
+	if err != nil {
+		return err
+	}
+	b, err := encryptCredentials(stateJSON)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(path, b, 0600))
+}
+
+func removeCredentialsFile(name string) error {
+	path, err := credentialsPath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// withKeyringTimeout runs a keyring operation, giving up with
+// errKeyringUnavailable if it doesn't finish in time. Errors other than
+// keyring.ErrNotFound, e.g. access being denied, are also reported as
+// errKeyringUnavailable.
+func withKeyringTimeout(f func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		if err == nil || errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+		return errors.Wrap(errKeyringUnavailable, err.Error())
+	case <-time.After(keyringTimeout):
+		return errors.Wrap(errKeyringUnavailable, "timed out")
+	}
+}
+
+// loadStateJSON reads the named credentials. The file store takes precedence
+// since it only exists if it was chosen explicitly or the keyring didn't work.
+func loadStateJSON(name string) (string, error) {
+	stateJSON, err := readCredentialsFile(name)
+	if err == nil {
+		return stateJSON, nil
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		return "", errors.WithStack(err)
+	}
+	err = withKeyringTimeout(func() error {
+		var err error
+		stateJSON, err = keyring.Get("plz", keyringUser(name))
+		return err
+	})
+	if errors.Is(err, errKeyringUnavailable) {
+		return "", errors.Wrap(err, "run plz auth --store=file to store credentials in a file instead")
+	}
+	return stateJSON, err
+}
+
+// saveStateJSON stores the named credentials in the given store. If no store is given,
+// the file store is used if it's already in use, and otherwise the keyring,
+// falling back to the file store if the keyring is unavailable, with a warning
+// to errorLog.
+func saveStateJSON(name string, store string, stateJSON string, errorLog *log.Logger) error {
+	switch store {
+	case StoreFile:
+		return writeCredentialsFile(name, stateJSON)
+	case StoreKeyring:
+		err := withKeyringTimeout(func() error {
+			return keyring.Set("plz", keyringUser(name), stateJSON)
+		})
+		if err != nil {
+			return err
+		}
+		return removeCredentialsFile(name)
+	}
+	if credentialsFileExists(name) {
+		return writeCredentialsFile(name, stateJSON)
+	}
+	err := withKeyringTimeout(func() error {
+		return keyring.Set("plz", keyringUser(name), stateJSON)
+	})
+	if !errors.Is(err, errKeyringUnavailable) {
+		return err
+	}
+	path, pathErr := credentialsPath(name)
+	if pathErr != nil {
+		return pathErr
+	}
+	errorLog.Printf(
+		"warning: %v, storing credentials in %s instead; run plz auth --store=keyring to switch back",
+		err,
+		path,
+	)
+	return writeCredentialsFile(name, stateJSON)
+}
+
+// Store returns where credentials are loaded from, StoreFile if the file store
+// exists and StoreKeyring otherwise.
+func (a *Auth) Store() string {
+	if credentialsFileExists(a.credentialsName()) {
+		return StoreFile
+	}
+	return StoreKeyring
+}
+
+// CheckKeyring returns an error if the system keyring can't be used, whether
+// or not it holds any credentials.
+func CheckKeyring() error {
+	err := withKeyringTimeout(func() error {
+		_, err := keyring.Get("plz", "authState")
+		return err
+	})
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bitcomplete/plz-cli/client/config"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// expandAlias replaces a user-defined alias in the command line with its
+// definition, like Git's [alias] section. Aliases are set with
+// plz config alias.<name> "<command> [<args>...]", and any arguments given
+// after the alias are appended to the definition. Aliases can't shadow
+// built-in commands. Definitions may also use the arguments given after the
+// alias as $1 to $9, or all of them as $@, see expandAliasArgs.
+func expandAlias(app *cli.App, cfg *config.Config, args []string) ([]string, error) {
+	// Find the command name, skipping global flags and their values.
+	valueFlags := map[string]bool{}
+	for _, flag := range app.Flags {
+		if _, ok := flag.(*cli.BoolFlag); ok {
+			continue
+		}
+		for _, name := range flag.Names() {
+			valueFlags[name] = true
+		}
+	}
+	i := 1
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if !strings.Contains(name, "=") && valueFlags[name] {
+			i++
+		}
+	}
+	if i >= len(args) || app.Command(args[i]) != nil {
+		return args, nil
+	}
+	definition := cfg.Get("alias." + args[i])
+	if definition == "" {
+		return args, nil
+	}
+	expansion, err := splitAlias(definition)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid alias %s", args[i])
+	}
+	if len(expansion) == 0 {
+		return nil, errors.Errorf("alias %s is empty", args[i])
+	}
+	expansion, err = expandAliasArgs(expansion, args[i+1:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "alias %s", args[i])
+	}
+	return append(append([]string{}, args[:i]...), expansion...), nil
+}
+
+// aliasArgRegex matches the placeholders for alias arguments: $1 to $9, $@,
+// and $$ for a literal $.
+var aliasArgRegex = regexp.MustCompile(`\$([1-9@$])`)
+
+// expandAliasArgs substitutes args, the arguments given after an alias, for
+// the placeholders in its definition. $@ on its own expands to all of the
+// arguments as separate words, and within a word to all of them joined by
+// spaces. Arguments that no placeholder refers to are appended, unless the
+// definition uses $@.
+func expandAliasArgs(definition []string, args []string) ([]string, error) {
+	var expanded []string
+	used := 0
+	usesAll := false
+	for _, word := range definition {
+		if word == "$@" {
+			expanded = append(expanded, args...)
+			usesAll = true
+			continue
+		}
+		var missing string
+		word = aliasArgRegex.ReplaceAllStringFunc(word, func(m string) string {
+			switch c := m[1]; c {
+			case '$':
+				return "$"
+			case '@':
+				usesAll = true
+				return strings.Join(args, " ")
+			default:
+				n := int(c - '0')
+				if n > used {
+					used = n
+				}
+				if n > len(args) {
+					missing = m
+					return ""
+				}
+				return args[n-1]
+			}
+		})
+		if missing != "" {
+			return nil, errors.Errorf("needs an argument for %s, got %d", missing, len(args))
+		}
+		expanded = append(expanded, word)
+	}
+	if !usesAll {
+		expanded = append(expanded, args[used:]...)
+	}
+	return expanded, nil
+}
+
+// splitAlias splits an alias definition into arguments the way a shell would,
+// honoring single and double quotes and backslash escapes.
+func splitAlias(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
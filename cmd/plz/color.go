@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// colorEnabled returns whether output should be colored, given the value of
+// --color or plz.color. In auto mode, the default, output is colored if it
+// goes to a terminal and NO_COLOR isn't set, see https://no-color.org.
+func colorEnabled(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+	default:
+		return false, errors.Errorf("invalid color mode %q, must be auto, always or never", mode)
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false, nil
+	}
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0, nil
+}
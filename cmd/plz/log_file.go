@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxLogFileSize is the size at which the log file is rotated.
+	maxLogFileSize = 5 << 20
+	// maxLogFiles is the number of rotated log files kept besides the current
+	// one, named <file>.1 to <file>.N from newest to oldest.
+	maxLogFiles = 3
+)
+
+// defaultLogFile returns where debug output is logged unless --log-file or
+// plz.logFile say otherwise.
+func defaultLogFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return filepath.Join(dir, "plz", "logs", "plz.log"), nil
+}
+
+// openLogFile opens the log file for appending, rotating it first if it has
+// grown too large, and writes a header for this run of plz.
+func openLogFile(path string, args []string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxLogFileSize {
+		for i := maxLogFiles - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		}
+		if err := os.Rename(path, path+".1"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fmt.Fprintf(
+		f,
+		"\n=== %s plz %s (pid %d): %s\n",
+		time.Now().Format(time.RFC3339),
+		Version,
+		os.Getpid(),
+		strings.Join(args, " "),
+	)
+	return f, nil
+}
+
+// logFileWriter returns the writer for the debug log file chosen by --log-file
+// or plz.logFile, or io.Discard if logging to a file is turned off with "off".
+// Failing to open the log file isn't fatal, since it's only there for bug
+// reports.
+func logFileWriter(path string, args []string) io.Writer {
+	if path == "off" {
+		return io.Discard
+	}
+	if path == "" {
+		var err error
+		path, err = defaultLogFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: not logging to a file: %v\n", err)
+			return io.Discard
+		}
+	}
+	f, err := openLogFile(path, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: not logging to %s: %v\n", path, err)
+		return io.Discard
+	}
+	return f
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
-	"io/ioutil"
+	"context"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/bitcomplete/plz-cli/client/actions"
 	"github.com/bitcomplete/plz-cli/client/auth"
+	"github.com/bitcomplete/plz-cli/client/config"
 	"github.com/bitcomplete/plz-cli/client/deps"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
@@ -14,25 +20,202 @@ import (
 
 var Version = "dev"
 
+const (
+	// defaultTimeout bounds how long to wait for each response from the plz
+	// API and GitHub, unless plz.timeout or --timeout say otherwise.
+	defaultTimeout = time.Minute
+	// defaultPushTimeout bounds each push and fetch of review branches,
+	// unless plz.pushTimeout says otherwise.
+	defaultPushTimeout = 10 * time.Minute
+)
+
 func main() {
+	var versionCheck *versionChecker
 	app := &cli.App{
 		Version: Version,
 		Usage:   "plz.review command-line companion",
 		Commands: []*cli.Command{
+			{
+				Name:      "approve",
+				Usage:     "approve the review of the HEAD commit or the given review",
+				ArgsUsage: "[<review-id>]",
+				Action:    actions.Approve,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "message",
+						Aliases: []string{"m"},
+						Usage:   "optional message to go with the approval",
+					},
+				},
+			},
 			{
 				Name:   "auth",
 				Usage:  "authorize GitHub access",
 				Action: actions.Auth,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "store",
+						Usage: "where to store credentials, keyring or file, defaults to the keyring if available",
+					},
+				},
 			},
 			{
-				Name:   "review",
-				Usage:  "start a review",
-				Action: actions.Review,
+				Name:   "doctor",
+				Usage:  "check that Git, the remote, credentials and network access are set up for plz, and say how to fix what isn't",
+				Action: actions.Doctor,
+			},
+			{
+				Name:      "request-changes",
+				Usage:     "request changes on the review of the HEAD commit or the given review",
+				ArgsUsage: "[<review-id>]",
+				Action:    actions.RequestChanges,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "message",
+						Aliases: []string{"m"},
+						Usage:   "optional message explaining the requested changes",
+					},
+				},
+			},
+			{
+				Name:      "review",
+				Usage:     "start a review",
+				ArgsUsage: "[<base>..<head>]",
+				Action:    actions.Review,
 				Flags: []cli.Flag{
 					&cli.StringSliceFlag{
 						Name:    "reviewer",
 						Aliases: []string{"r"},
-						Usage:   "add reviewer by GitHub username",
+						Usage:   "add reviewer by GitHub username or org/team-name",
+					},
+					&cli.StringSliceFlag{
+						Name:  "remove-reviewer",
+						Usage: "remove requested reviewer by GitHub username or org/team-name",
+					},
+					&cli.StringSliceFlag{
+						Name:  "assignee",
+						Usage: "assign the PRs to the given GitHub username, defaults to yourself",
+					},
+					&cli.StringSliceFlag{
+						Name:  "label",
+						Usage: "add label to the PRs, in addition to any plz-labels trailers",
+					},
+					&cli.StringFlag{
+						Name:  "milestone",
+						Usage: "set the milestone with the given title on the PRs",
+					},
+					&cli.GenericFlag{
+						Name:  "auto-merge",
+						Value: &actions.AutoMergeMethod{},
+						Usage: "enable auto-merge on the PRs, optionally with a method, e.g. --auto-merge=rebase (default: squash)",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "show what would be published without changing anything",
+					},
+					&cli.BoolFlag{
+						Name:  "confirm",
+						Usage: "show what will be pushed and which PRs will be opened or edited, and ask before publishing",
+					},
+					&cli.StringFlag{
+						Name:  "stack-name",
+						Usage: "name the stack, to make it easier to refer to and find with plz status --stack-name",
+					},
+					&cli.StringFlag{
+						Name:  "up-to",
+						Usage: "only publish the stack up to the given commit, review ID or number of commits",
+					},
+					&cli.StringFlag{
+						Name:  "base",
+						Usage: "base the stack on this branch on origin, e.g. a teammate's review branch, rather than the default branch; it's remembered for the branch until another is given",
+					},
+					&cli.StringFlag{
+						Name:  "title",
+						Usage: "PR title for the top commit, or the one given by --for, instead of the commit message's",
+					},
+					&cli.StringFlag{
+						Name:  "body",
+						Usage: "PR description for the top commit, or the one given by --for, instead of the commit message's",
+					},
+					&cli.StringFlag{
+						Name:  "body-file",
+						Usage: "read the PR description for --body from a file, or - for stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "draft",
+						Usage: "open new PRs as drafts, see plz publish",
+					},
+					&cli.BoolFlag{
+						Name:  "edit",
+						Usage: "edit the title and description of each new PR in your editor before creating it",
+					},
+					&cli.BoolFlag{
+						Name:  "autostash",
+						Usage: "stash uncommitted changes before publishing and restore them afterwards, defaults to plz.autostash",
+					},
+					&cli.BoolFlag{
+						Name:  "update-only",
+						Usage: "only update existing reviews, failing if any commit isn't part of one",
+					},
+					&cli.BoolFlag{
+						Name:  "no-verify",
+						Usage: "don't run the .plz/hooks/pre-review hook or check commit titles against plz.titleLint and plz.titlePattern",
+					},
+					&cli.StringFlag{
+						Name:  "for",
+						Usage: "commit or review ID whose PR --title and --body apply to",
+					},
+					&cli.StringFlag{
+						Name:  "branch",
+						Usage: "when HEAD is detached, create this branch at the published stack and check it out",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "overwrite review branches that someone else has pushed to since their latest revision",
+					},
+					&cli.BoolFlag{
+						Name:  "force-large",
+						Usage: "publish even if files exceed plz.largeFileLimit",
+					},
+					&cli.BoolFlag{
+						Name:  "no-secret-scan",
+						Usage: "publish even if the commits appear to contain secrets",
+					},
+					&cli.BoolFlag{
+						Name:  "porcelain",
+						Usage: "print the published reviews in a stable, machine-readable format",
+					},
+				},
+			},
+			{
+				Name:   "init-hooks",
+				Usage:  "install a commit-msg hook that checks plz review trailers",
+				Action: actions.InitHooks,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "reserve",
+						Usage: "add a review trailer with a newly reserved review ID to each new commit, so plz review doesn't need to rewrite it",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "replace an existing commit-msg hook",
+					},
+				},
+			},
+			{
+				Name:   "hook",
+				Usage:  "run a Git hook installed by plz init-hooks",
+				Hidden: true,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "commit-msg",
+						ArgsUsage: "<message file>",
+						Action:    actions.CommitMsgHook,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name: "reserve",
+							},
+						},
 					},
 				},
 			},
@@ -40,44 +223,487 @@ func main() {
 				Name:   "sync",
 				Usage:  "update local review branches",
 				Action: actions.Sync,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "update every local review branch rather than just the stack under HEAD",
+					},
+					&cli.BoolFlag{
+						Name:  "no-rebase",
+						Usage: "print how to rebase unpublished commits onto the synced stack rather than doing it",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print which reviews would be synced, which branches fetched and re-pointed and whether HEAD would move, without changing anything",
+					},
+					&cli.BoolFlag{
+						Name:  "continue",
+						Usage: "resume a sync that stopped on a conflict, once the conflict is resolved",
+					},
+					&cli.BoolFlag{
+						Name:  "abort",
+						Usage: "give up on a sync that stopped on a conflict and restore the branch",
+					},
+					&cli.BoolFlag{
+						Name:  "prune",
+						Usage: "delete the local review branches of merged and deleted reviews",
+					},
+					&cli.BoolFlag{
+						Name:  "prune-remote",
+						Usage: "with --prune, also delete their remote-tracking branches",
+					},
+					&cli.BoolFlag{
+						Name:  "no-lfs",
+						Usage: "skip fetching and checking out Git LFS files",
+					},
+					&cli.BoolFlag{
+						Name:  "autostash",
+						Usage: "stash uncommitted changes before syncing and restore them afterwards, defaults to plz.autostash",
+					},
+				},
+			},
+			{
+				Name:      "checkout",
+				Usage:     "fetch any review and check it out on a local branch",
+				ArgsUsage: "<review-id>",
+				Action:    actions.Checkout,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "branch",
+						Usage: "local branch to check out, defaults to plz/<review-id>",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "overwrite the local branch even if it has other commits",
+					},
+					&cli.BoolFlag{
+						Name:  "no-lfs",
+						Usage: "skip checking out Git LFS files",
+					},
+				},
+			},
+			{
+				Name:   "comment",
+				Usage:  "comment on the review of the HEAD commit",
+				Action: actions.Comment,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "message",
+						Aliases: []string{"m"},
+						Usage:   "comment text, otherwise read from stdin or an editor",
+					},
+					&cli.StringFlag{
+						Name:  "file",
+						Usage: "comment inline on the given file",
+					},
+					&cli.IntFlag{
+						Name:  "line",
+						Usage: "line of --file to comment on",
+					},
+				},
 			},
 			{
-				Name:   "status",
-				Usage:  "list local review status",
-				Action: actions.Status,
+				Name:   "demo",
+				Usage:  "walk through the stacked review workflow in a scratch repository",
+				Action: actions.Demo,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "remote",
+						Usage: "URL of an empty sandbox GitHub repo to publish the demo reviews to",
+					},
+					&cli.BoolFlag{
+						Name:  "keep",
+						Usage: "keep the scratch repository afterwards",
+					},
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "show the changes between two revisions of a review",
+				ArgsUsage: "<from> [<to>]",
+				Action:    actions.Diff,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "review",
+						Usage: "review ID, defaults to the review of the HEAD commit",
+					},
+					&cli.BoolFlag{
+						Name:  "latest",
+						Usage: "show the changes in the latest revision since the one before",
+					},
+				},
+			},
+			{
+				Name:   "log",
+				Usage:  "list the published revisions of a review",
+				Action: actions.Log,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "review",
+						Usage: "review ID, defaults to the review of the HEAD commit",
+					},
+					&cli.StringFlag{
+						Name:  "author",
+						Usage: "list the revisions of the open reviews authored by another GitHub user instead",
+					},
+				},
+			},
+			{
+				Name:      "handoff",
+				Usage:     "transfer the open reviews in the current stack to another GitHub user",
+				ArgsUsage: "<github-user>",
+				Action:    actions.Handoff,
+			},
+			{
+				Name:   "watch-pr",
+				Usage:  "mirror review status onto GitHub PRs for reviewers without plz",
+				Action: actions.WatchPR,
+			},
+			{
+				Name:   "verify",
+				Usage:  "verify the commits in the current stack",
+				Action: actions.Verify,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "attestations",
+						Usage: "verify the signed attestations added when plz.attest is enabled",
+					},
+				},
+			},
+			{
+				Name:  "admin",
+				Usage: "set up a repo for plz, requires admin access",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "protect-review-branches",
+						Usage:  "add a branch protection rule suited to plz review branches",
+						Action: actions.ProtectReviewBranches,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "app",
+								Usage: "only allow the GitHub App with the given slug, and the repo's writers, to push review branches",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:      "config",
+				Usage:     "get or set a plz setting, including aliases, e.g. plz config alias.st \"status --checks\"",
+				ArgsUsage: "<key> [<value>]",
+				Action:    actions.Config,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "global",
+						Usage: "set the global setting rather than the repository setting",
+					},
+					&cli.BoolFlag{
+						Name:  "unset",
+						Usage: "remove the setting",
+					},
+				},
+			},
+			{
+				Name:      "publish",
+				Usage:     "mark the PRs of reviews in the stack ready for review, or drafts with --draft",
+				ArgsUsage: "[<commit or review-id>...]",
+				Action:    actions.Publish,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "draft",
+						Usage: "convert the PRs to drafts instead",
+					},
+				},
+			},
+			{
+				Name:      "telemetry",
+				Usage:     "show whether plz records anonymous usage, or turn it on or off",
+				ArgsUsage: "[status|on|off]",
+				Action:    actions.Telemetry,
+			},
+			{
+				Name:  "stack",
+				Usage: "rearrange the reviews in the current stack",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "squash",
+						Usage:     "squash adjacent commits into one review and publish it, closing the reviews and PRs of the others",
+						ArgsUsage: "<bottom> <top>",
+						Action:    actions.StackSquash,
+					},
+				},
+			},
+			{
+				Name:      "rebase-onto",
+				Usage:     "move the stack, or the part of it from the given commit up, onto a new base and point the branch at the result",
+				ArgsUsage: "<newbase> [<first commit>]",
+				Action:    actions.RebaseOnto,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "no-lfs",
+						Usage: "skip checking out Git LFS files",
+					},
+					&cli.BoolFlag{
+						Name:  "autostash",
+						Usage: "stash uncommitted changes before rebasing and restore them afterwards, defaults to plz.autostash",
+					},
+				},
+			},
+			{
+				Name:   "absorb",
+				Usage:  "move each staged hunk into the commit in the stack that last changed the lines it touches",
+				Action: actions.Absorb,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "no-rebase",
+						Usage: "create fixup commits but leave squashing them to git rebase --autosquash",
+					},
+				},
+			},
+			{
+				Name:   "amend",
+				Usage:  "fold the staged changes into HEAD, or another commit in the stack, and rewrite the commits above it",
+				Action: actions.Amend,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "commit",
+						Usage: "commit or review ID to amend, defaults to HEAD",
+					},
+					&cli.BoolFlag{
+						Name:  "review",
+						Usage: "publish the stack with plz review afterwards",
+					},
+				},
+			},
+			{
+				Name:      "split",
+				Usage:     "split a commit into several reviews, by picking hunks or moving the changes to some paths into a commit below",
+				ArgsUsage: "[<path>...]",
+				Action:    actions.Split,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "commit",
+						Usage: "commit or review ID to split, defaults to HEAD",
+					},
+					&cli.StringSliceFlag{
+						Name:    "message",
+						Aliases: []string{"m"},
+						Usage:   "message of a new commit, bottom first, instead of opening an editor (may be repeated)",
+					},
+				},
+			},
+			{
+				Name:      "status",
+				Usage:     "list local review status",
+				ArgsUsage: "[<branch or commit>]",
+				Action:    actions.Status,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "cached",
+						Usage: "show possibly stale review status from the local cache without network access",
+					},
+					&cli.StringFlag{
+						Name:  "base",
+						Usage: "show the stack on top of this branch on origin or commit rather than the branch's --base or the default branch",
+					},
+					&cli.BoolFlag{
+						Name:  "checks",
+						Usage: "also fetch and show CI check status from GitHub",
+					},
+					&cli.StringFlag{
+						Name:  "author",
+						Usage: "show the open reviews authored by another GitHub user instead of the local stack",
+					},
+					&cli.StringFlag{
+						Name:  "stack-name",
+						Usage: "only show the stack with the given name",
+					},
+					&cli.BoolFlag{
+						Name:  "porcelain",
+						Usage: "print the status in a stable, machine-readable format",
+					},
+				},
 			},
 		},
 		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "only show errors, warnings and prompts",
+			},
 			&cli.BoolFlag{
 				Name:  "verbose",
 				Usage: "show verbose debug output",
 			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "use the credentials and plz.profile.<name>.* settings of the named profile, overrides plz.profile",
+			},
+			&cli.StringFlag{
+				Name:  "ca-bundle",
+				Usage: "PEM file of certificates to trust for the plz API and GitHub, in addition to the system's, overrides plz.caBundle",
+			},
+			&cli.BoolFlag{
+				Name:  "insecure-skip-verify",
+				Usage: "don't verify TLS certificates of the plz API and GitHub, only for debugging",
+			},
+			&cli.StringFlag{
+				Name:  "color",
+				Usage: "whether to color output: auto, always or never, overrides plz.color (default: auto)",
+			},
+			&cli.StringFlag{
+				Name:  "debug",
+				Usage: "show debug output for a comma separated list of topics: git, api, graphql, push, stack or all",
+			},
+			&cli.StringFlag{
+				Name:  "log-file",
+				Usage: "file to write debug output to for bug reports, or off, overrides plz.logFile (default: plz/logs/plz.log in the user cache directory)",
+			},
+			&cli.IntFlag{
+				Name:  "max-stack-depth",
+				Usage: "maximum number of commits between HEAD and the default branch, overrides plz.maxStackDepth (default: 200)",
+			},
+			&cli.BoolFlag{
+				Name:  "first-parent",
+				Value: true,
+				Usage: "allow merge commits, e.g. merges of the default branch, in stacks by following only their first parents, or reject them with --first-parent=false, overrides plz.firstParent",
+			},
+			&cli.BoolFlag{
+				Name:  "ignore-untracked",
+				Usage: "treat the worktree as clean even if it has untracked files, overrides plz.ignoreUntracked",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Value: defaultTimeout,
+				Usage: "how long to wait for each response from the plz API and GitHub, or 0 to wait indefinitely, overrides plz.timeout",
+			},
 			&cli.StringFlag{
 				Name:  "plz-api-base-url",
-				Value: "https://api.plz.review",
+				Value: auth.DefaultPlzAPIBaseURL,
 				Usage: "point to a different plz server",
 			},
 		},
 		Before: func(c *cli.Context) error {
-			debugWriter := ioutil.Discard
+			// Debug output always goes to the log file for bug reports, and
+			// to stderr when asked for, to keep it apart from regular output
+			// and prompts.
+			cfg, cfgErr := config.Load()
+			profile := c.String("profile")
+			if profile == "" {
+				profile = cfg.Get("profile")
+			}
+			cfg = cfg.WithProfile(profile)
+			logFilePath := c.String("log-file")
+			if logFilePath == "" {
+				logFilePath = cfg.Get("logFile")
+			}
+			logFile := logFileWriter(logFilePath, os.Args)
+			debugWriter := logFile
 			if c.Bool("verbose") {
-				debugWriter = os.Stdout
+				debugWriter = io.MultiWriter(os.Stderr, logFile)
+			}
+			// Regular output goes to stdout unless --quiet is given. Errors,
+			// warnings and prompts always go to stderr.
+			var infoWriter io.Writer = os.Stdout
+			if c.Bool("quiet") {
+				infoWriter = io.Discard
 			}
 			plzAPIBaseURL := c.String("plz-api-base-url")
-			c.Context = deps.ContextWithDeps(c.Context, &deps.Deps{
-				ErrorLog:      log.New(os.Stderr, "", 0),
-				InfoLog:       log.New(os.Stdout, "", 0),
+			errorLog := log.New(io.MultiWriter(os.Stderr, logFile), "", 0)
+			caBundle := c.String("ca-bundle")
+			if caBundle == "" {
+				caBundle = cfg.Get("caBundle")
+			}
+			timeout := cfg.GetDuration("timeout", defaultTimeout)
+			if c.IsSet("timeout") {
+				timeout = c.Duration("timeout")
+			}
+			var transport http.RoundTripper
+			t, transportErr := newTransport(caBundle, c.Bool("insecure-skip-verify"), timeout)
+			if transportErr == nil {
+				transport = t
+			}
+			d := &deps.Deps{
+				ErrorLog:      errorLog,
+				InfoLog:       log.New(infoWriter, "", 0),
 				DebugLog:      log.New(debugWriter, "[debug] ", log.Ldate|log.Lmicroseconds),
 				PlzAPIBaseURL: plzAPIBaseURL,
-				Auth:          auth.New(plzAPIBaseURL),
-			})
+				Transport:     transport,
+				// Auth's output includes the one-time device code, so it
+				// isn't copied to the log file.
+				Auth: auth.New(plzAPIBaseURL, transport, log.New(os.Stderr, "", 0)),
+			}
+			d.Auth.SetProfile(profile)
+			c.Context = deps.ContextWithDeps(c.Context, d)
+			debugLogs, err := newDebugLogs(c.String("debug"), c.Bool("verbose"), logFile)
+			if err != nil {
+				return err
+			}
+			d.GitDebugLog = debugLogs[deps.DebugGit]
+			d.APIDebugLog = debugLogs[deps.DebugAPI]
+			d.GraphQLDebugLog = debugLogs[deps.DebugGraphQL]
+			d.PushDebugLog = debugLogs[deps.DebugPush]
+			d.StackDebugLog = debugLogs[deps.DebugStack]
+			if cfgErr != nil {
+				return cfgErr
+			}
+			if transportErr != nil {
+				return transportErr
+			}
+			if c.Bool("insecure-skip-verify") {
+				d.ErrorLog.Println("warning: not verifying TLS certificates")
+			}
+			d.Config = cfg
+			colorMode := c.String("color")
+			if colorMode == "" {
+				colorMode = cfg.Get("color")
+			}
+			if d.Color, err = colorEnabled(colorMode); err != nil {
+				return err
+			}
+			d.PushTimeout = cfg.GetDuration("pushTimeout", defaultPushTimeout)
+			d.MaxStackDepth = cfg.GetInt("maxStackDepth", 0)
+			if c.IsSet("max-stack-depth") {
+				d.MaxStackDepth = c.Int("max-stack-depth")
+			}
+			d.RejectMerges = !cfg.GetBool("firstParent", true)
+			if c.IsSet("first-parent") {
+				d.RejectMerges = !c.Bool("first-parent")
+			}
+			d.IgnoreUntracked = cfg.GetBool("ignoreUntracked", false)
+			if c.IsSet("ignore-untracked") {
+				d.IgnoreUntracked = c.Bool("ignore-untracked")
+			}
+			versionCheck = startVersionCheck(c.Context)
 			return nil
 		},
+		// Only runs after commands that succeed, since failures exit in
+		// ExitErrHandler.
+		After: func(c *cli.Context) error {
+			versionCheck.printHint(c.Context)
+			return nil
+		},
+		// Commands that plz doesn't have are run as plugins, see
+		// actions.RunPlugin.
+		Action: func(c *cli.Context) error {
+			if !c.Args().Present() {
+				return cli.ShowAppHelp(c)
+			}
+			return actions.RunPlugin(c.Context, c.Args().First(), c.Args().Tail())
+		},
 		ExitErrHandler: func(c *cli.Context, err error) {
 			deps := deps.FromContext(c.Context)
+			var exitCoder cli.ExitCoder
+			if errors.As(err, &exitCoder) && err.Error() == "" {
+				// A plugin failed and has already said why.
+				os.Exit(exitCoder.ExitCode())
+			}
 			if err != nil {
 				if errors.Is(err, auth.ErrNoAuthCredentials) {
 					deps.ErrorLog.Println("no auth credentials, run plz auth")
+				} else if errors.Is(c.Context.Err(), context.Canceled) {
+					deps.ErrorLog.Println("interrupted")
+					deps.DebugLog.Println(err.Error())
 				} else {
 					deps.ErrorLog.Println(err.Error())
 					var stackTracer interface {
@@ -91,5 +717,60 @@ func main() {
 			}
 		},
 	}
-	_ = app.Run(os.Args)
+	instrumentCommands(app.Commands, nil)
+	// Plugins are recorded without their names, which may be private.
+	app.Action = instrumentAction("plugin", app.Action)
+	args := os.Args
+	if cfg, err := config.Load(); err == nil {
+		args, err = expandAlias(app, cfg, args)
+		if err != nil {
+			log.New(os.Stderr, "", 0).Fatalln(err)
+		}
+	}
+	// Ctrl-C cancels the context, so that requests and Git operations stop
+	// and plz exits through the usual error handling rather than being killed
+	// halfway through rewriting commits. A second Ctrl-C kills it right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	_ = app.RunContext(ctx, args)
+}
+
+// newDebugLogs returns loggers for the debug topics, which write to logFile
+// and, for the topics listed in the --debug flag, stderr. All topics are
+// enabled by --verbose.
+func newDebugLogs(topics string, verbose bool, logFile io.Writer) (map[deps.DebugTopic]*log.Logger, error) {
+	enabled := map[deps.DebugTopic]bool{}
+	for _, topic := range strings.Split(topics, ",") {
+		topic = strings.TrimSpace(topic)
+		switch {
+		case topic == "":
+		case topic == "all":
+			verbose = true
+		case isDebugTopic(deps.DebugTopic(topic)):
+			enabled[deps.DebugTopic(topic)] = true
+		default:
+			return nil, errors.Errorf("unknown debug topic %q", topic)
+		}
+	}
+	logs := map[deps.DebugTopic]*log.Logger{}
+	for _, topic := range deps.DebugTopics {
+		w := logFile
+		if verbose || enabled[topic] {
+			w = io.MultiWriter(os.Stderr, logFile)
+		}
+		logs[topic] = log.New(w, "[debug "+string(topic)+"] ", log.Ldate|log.Lmicroseconds)
+	}
+	return logs, nil
+}
+
+func isDebugTopic(topic deps.DebugTopic) bool {
+	for _, t := range deps.DebugTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/actions"
+	"github.com/urfave/cli/v2"
+)
+
+// instrumentCommands wraps the actions of commands and their subcommands so
+// that each run is recorded with actions.RecordTelemetry, which does nothing
+// unless the user has opted in. parents are the names of the enclosing
+// commands.
+func instrumentCommands(commands []*cli.Command, parents []string) {
+	for _, command := range commands {
+		path := append(parents[:len(parents):len(parents)], command.Name)
+		instrumentCommands(command.Subcommands, path)
+		if command.Action != nil {
+			command.Action = instrumentAction(strings.Join(path, " "), command.Action)
+		}
+	}
+}
+
+// instrumentAction wraps action so that its runs are recorded as the named
+// command.
+func instrumentAction(name string, action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		start := time.Now()
+		err := action(c)
+		actions.RecordTelemetry(c.Context, name, time.Since(start), err, Version)
+		return err
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newTransport returns the transport for requests to the plz API and GitHub.
+// Like http.DefaultTransport, it uses the proxy given by the HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables. caBundle is a PEM file of
+// certificates to trust in addition to the system's, e.g. for a TLS
+// intercepting corporate proxy or a self-hosted plz deployment. timeout bounds
+// how long to wait for each response, zero meaning no limit.
+func newTransport(caBundle string, insecureSkipVerify bool, timeout time.Duration) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.ResponseHeaderTimeout = timeout
+	if caBundle == "" && !insecureSkipVerify {
+		return transport, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA bundle %s", caBundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/pkg/errors"
+)
+
+const (
+	// latestReleaseURL is where the latest released version of plz is found.
+	latestReleaseURL = "https://api.github.com/repos/bitcomplete/plz-cli/releases/latest"
+	// versionCheckInterval is how often plz checks for a new version.
+	versionCheckInterval = 24 * time.Hour
+	// versionCheckTimeout bounds the check, which runs in the background.
+	versionCheckTimeout = 5 * time.Second
+	// versionCheckWait is how long plz waits after a command for a check that
+	// is still running, so that checks get done even if commands are quick.
+	versionCheckWait = 500 * time.Millisecond
+)
+
+// versionCheckCache is what's stored between runs of plz about the latest
+// version.
+type versionCheckCache struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Latest    string    `json:"latest"`
+}
+
+// versionChecker looks for a newer version of plz than Version once a day, in
+// the background, and prints a hint to upgrade after commands when there is
+// one. It's turned off with plz.updateCheck=false, and in CI.
+type versionChecker struct {
+	path string
+	// done is closed once the background check is over, or is nil if no
+	// check was needed.
+	done chan struct{}
+}
+
+// startVersionCheck starts checking for a new version in the background if the
+// last check was more than versionCheckInterval ago. It returns nil if
+// checking is turned off.
+func startVersionCheck(ctx context.Context) *versionChecker {
+	deps := deps.FromContext(ctx)
+	if !deps.Config.GetBool("updateCheck", true) || os.Getenv("CI") != "" || parseVersion(Version) == nil {
+		return nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	vc := &versionChecker{path: filepath.Join(dir, "plz", "version-check.json")}
+	if cache, err := vc.load(); err == nil && time.Since(cache.CheckedAt) < versionCheckInterval {
+		return vc
+	}
+	vc.done = make(chan struct{})
+	go func() {
+		defer close(vc.done)
+		if err := vc.check(ctx); err != nil {
+			deps.DebugLog.Printf("failed to check for a new version: %v", err)
+		}
+	}()
+	return vc
+}
+
+// check fetches the latest version and caches it. Failures are cached too, so
+// that an unreachable GitHub isn't asked again until the next interval.
+func (vc *versionChecker) check(ctx context.Context) error {
+	deps := deps.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, versionCheckTimeout)
+	defer cancel()
+	cache := versionCheckCache{CheckedAt: time.Now()}
+	if previous, err := vc.load(); err == nil {
+		cache.Latest = previous.Latest
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, fetchErr := (&http.Client{Transport: deps.Transport}).Do(req)
+	if fetchErr == nil {
+		defer resp.Body.Close()
+		var release struct {
+			TagName string `json:"tag_name"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			fetchErr = errors.Errorf("GET %s: %s", latestReleaseURL, resp.Status)
+		} else if fetchErr = json.NewDecoder(resp.Body).Decode(&release); fetchErr == nil {
+			cache.Latest = strings.TrimPrefix(release.TagName, "v")
+			deps.DebugLog.Println("latest version is", cache.Latest)
+		}
+	}
+	if err := vc.save(cache); err != nil {
+		return err
+	}
+	return errors.WithStack(fetchErr)
+}
+
+// printHint waits briefly for a background check and then prints a hint to
+// upgrade if a newer version is known.
+func (vc *versionChecker) printHint(ctx context.Context) {
+	if vc == nil {
+		return
+	}
+	if vc.done != nil {
+		select {
+		case <-vc.done:
+		case <-time.After(versionCheckWait):
+		}
+	}
+	cache, err := vc.load()
+	if err != nil || !isNewerVersion(cache.Latest, Version) {
+		return
+	}
+	deps.FromContext(ctx).ErrorLog.Printf(
+		"plz %s is available, you have %s, see https://github.com/bitcomplete/plz-cli/releases/latest (plz config --global updateCheck false to stop these hints)",
+		cache.Latest,
+		Version,
+	)
+}
+
+func (vc *versionChecker) load() (*versionCheckCache, error) {
+	b, err := os.ReadFile(vc.path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var cache versionCheckCache
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &cache, nil
+}
+
+func (vc *versionChecker) save(cache versionCheckCache) error {
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(vc.path), 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	// Write and rename, since concurrent runs of plz may check at once.
+	tmp := vc.path + "." + strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, vc.path))
+}
+
+// parseVersion parses a release version like 1.2.3, returning nil for
+// anything else, e.g. dev builds and snapshots like 1.2.4-next.
+func parseVersion(v string) []int {
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		nums[i] = n
+	}
+	return nums
+}
+
+// isNewerVersion returns whether release version a is newer than b.
+func isNewerVersion(a, b string) bool {
+	av, bv := parseVersion(a), parseVersion(b)
+	if av == nil || bv == nil {
+		return false
+	}
+	for i := 0; i < len(av) || i < len(bv); i++ {
+		var x, y int
+		if i < len(av) {
+			x = av[i]
+		}
+		if i < len(bv) {
+			y = bv[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
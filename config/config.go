@@ -0,0 +1,156 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/gitrepo"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/pkg/errors"
+)
+
+// section is the Git config section holding plz settings, e.g. settings are
+// set with `git config plz.<key> <value>`.
+const section = "plz"
+
+// Config holds plz settings read from the Git config. Repository settings take
+// precedence over global settings, which take precedence over system settings.
+type Config struct {
+	layers  []*config.Config
+	profile string
+}
+
+// Load reads plz settings for the Git repository containing the current
+// directory, if any, along with the global and system Git config.
+func Load() (*Config, error) {
+	var layers []*config.Config
+	repo, err := gitrepo.Open()
+	if err == nil {
+		local, err := repo.Config()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		layers = append(layers, local.Raw)
+	} else if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, errors.WithStack(err)
+	}
+	for _, scope := range []gitconfig.Scope{gitconfig.GlobalScope, gitconfig.SystemScope} {
+		c, err := gitconfig.LoadConfig(scope)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		layers = append(layers, c.Raw)
+	}
+	return &Config{layers: layers}, nil
+}
+
+// WithProfile returns a copy of the config in which the settings of the given
+// profile, set as plz.profile.<profile>.<key>, take precedence over the same
+// settings outside of the profile. An empty profile leaves the config as is.
+func (c *Config) WithProfile(profile string) *Config {
+	if c == nil {
+		return nil
+	}
+	return &Config{layers: c.layers, profile: profile}
+}
+
+// Get returns the value of the given key, or an empty string if it isn't set.
+// Keys are relative to the plz section and may include a subsection, e.g.
+// "prBodySync" or "alias.st".
+func (c *Config) Get(key string) string {
+	if c == nil {
+		return ""
+	}
+	if c.profile != "" {
+		if v := c.get("profile." + c.profile + "." + key); v != "" {
+			return v
+		}
+	}
+	return c.get(key)
+}
+
+func (c *Config) get(key string) string {
+	subsection, name := splitKey(key)
+	for _, layer := range c.layers {
+		if !layer.HasSection(section) {
+			continue
+		}
+		s := layer.Section(section)
+		if subsection == "" {
+			if s.HasOption(name) {
+				return s.Option(name)
+			}
+		} else if s.HasSubsection(subsection) {
+			if ss := s.Subsection(subsection); ss.HasOption(name) {
+				return ss.Option(name)
+			}
+		}
+	}
+	return ""
+}
+
+// GetBool returns the boolean value of the given key, or def if it isn't set
+// or isn't a valid boolean.
+func (c *Config) GetBool(key string, def bool) bool {
+	switch strings.ToLower(c.Get(key)) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+	return def
+}
+
+// GetInt returns the integer value of the given key, or def if it isn't set or
+// isn't a valid integer.
+func (c *Config) GetInt(key string, def int) int {
+	v, err := strconv.Atoi(c.Get(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// GetBytes returns the size in bytes of the given key, or def if it isn't set
+// or isn't a valid size. Like Git, sizes may have a k, m or g suffix.
+func (c *Config) GetBytes(key string, def int64) int64 {
+	v := strings.ToLower(c.Get(key))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(v, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(v, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(v, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return def
+	}
+	return n * multiplier
+}
+
+// GetDuration returns the duration value of the given key, e.g. "30s" or
+// "5m", or def if it isn't set or isn't a valid duration.
+func (c *Config) GetDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(c.Get(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func splitKey(key string) (string, string) {
+	i := strings.LastIndex(key, ".")
+	if i < 0 {
+		return "", key
+	}
+	return key[:i], key[i+1:]
+}
@@ -2,24 +2,94 @@ package deps
 
 import (
 	"context"
+	"io"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/bitcomplete/plz-cli/client/auth"
+	"github.com/bitcomplete/plz-cli/client/config"
 )
 
 type depsKeyType int
 
 var depsKey depsKeyType
 
+// DebugTopic is a category of debug output that can be enabled on its own with
+// --debug.
+type DebugTopic string
+
+const (
+	// DebugGit covers local Git operations such as writing commits and
+	// updating references.
+	DebugGit DebugTopic = "git"
+	// DebugAPI covers GitHub API requests.
+	DebugAPI DebugTopic = "api"
+	// DebugGraphQL covers GraphQL requests to the plz API and GitHub.
+	DebugGraphQL DebugTopic = "graphql"
+	// DebugPush covers pushing review branches.
+	DebugPush DebugTopic = "push"
+	// DebugStack covers walking the stack and matching commits to reviews.
+	DebugStack DebugTopic = "stack"
+)
+
+// DebugTopics lists all debug topics.
+var DebugTopics = []DebugTopic{DebugGit, DebugAPI, DebugGraphQL, DebugPush, DebugStack}
+
 type Deps struct {
 	ErrorLog *log.Logger
 	InfoLog  *log.Logger
 	DebugLog *log.Logger
+	// Debug output for each DebugTopic.
+	GitDebugLog     *log.Logger
+	APIDebugLog     *log.Logger
+	GraphQLDebugLog *log.Logger
+	PushDebugLog    *log.Logger
+	StackDebugLog   *log.Logger
 	*auth.Auth
 	PlzAPIBaseURL string
+	// Transport makes the requests to the plz API and GitHub.
+	Transport http.RoundTripper
+	Config    *config.Config
+	// Color enables colored output.
+	Color bool
+	// PushTimeout bounds each push and fetch of review branches. Zero means
+	// no timeout.
+	PushTimeout time.Duration
+	// MaxStackDepth limits how many commits are walked to find the stack. If
+	// zero, stack.DefaultMaxStackDepth is used.
+	MaxStackDepth int
+	// RejectMerges rejects stacks containing merge commits, rather than
+	// following only their first parents.
+	RejectMerges bool
+	// IgnoreUntracked lets commands that require a clean worktree run with
+	// untracked files present.
+	IgnoreUntracked bool
 }
 
+// ContextWithDeps returns a context carrying deps, which is how actions get
+// their dependencies. Programs embedding plz must set Auth and PlzAPIBaseURL,
+// and a nil Config behaves as if nothing is configured. Loggers left nil are
+// set to discard their output, and a nil Transport is set to
+// http.DefaultTransport.
 func ContextWithDeps(ctx context.Context, deps *Deps) context.Context {
+	for _, l := range []**log.Logger{
+		&deps.ErrorLog,
+		&deps.InfoLog,
+		&deps.DebugLog,
+		&deps.GitDebugLog,
+		&deps.APIDebugLog,
+		&deps.GraphQLDebugLog,
+		&deps.PushDebugLog,
+		&deps.StackDebugLog,
+	} {
+		if *l == nil {
+			*l = log.New(io.Discard, "", 0)
+		}
+	}
+	if deps.Transport == nil {
+		deps.Transport = http.DefaultTransport
+	}
 	return context.WithValue(ctx, depsKey, deps)
 }
 
@@ -0,0 +1,96 @@
+// Package gitrepo opens the Git repository that plz commands act on.
+package gitrepo
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/pkg/errors"
+)
+
+// Open opens the Git repository for the current directory, finding it the way
+// git does. Usually that's a .git directory or file in the current directory
+// or one of its parents, which is found without running git. Otherwise, e.g.
+// when GIT_DIR or GIT_WORK_TREE is set, or for a bare repository with a
+// core.worktree, git rev-parse is asked. It returns git.ErrRepositoryNotExists
+// if there's no repository.
+func Open() (*git.Repository, error) {
+	if os.Getenv("GIT_DIR") == "" && os.Getenv("GIT_WORK_TREE") == "" {
+		repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{
+			DetectDotGit:          true,
+			EnableDotGitCommonDir: true,
+		})
+		if err == nil {
+			return repo, nil
+		}
+		if !errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return openWithRevParse()
+}
+
+// openWithRevParse opens the repository at the Git and work tree directories
+// reported by git rev-parse.
+func openWithRevParse() (*git.Repository, error) {
+	out, err := revParse("--absolute-git-dir", "--git-common-dir", "--is-bare-repository")
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != 3 {
+		return nil, errors.Errorf("unexpected git rev-parse output %q", out)
+	}
+	gitDir, commonDir, bare := out[0], out[1], out[2] == "true"
+	if !filepath.IsAbs(commonDir) {
+		// Unlike --absolute-git-dir, --git-common-dir is relative to the
+		// current directory.
+		if commonDir, err = filepath.Abs(commonDir); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	var dotGitFs billy.Filesystem = osfs.New(gitDir)
+	if filepath.Clean(commonDir) != filepath.Clean(gitDir) {
+		// A linked worktree, whose objects and most refs are in the
+		// repository it was added to.
+		dotGitFs = dotgit.NewRepositoryFilesystem(dotGitFs, osfs.New(commonDir))
+	}
+	var worktreeFs billy.Filesystem
+	if !bare {
+		out, err := revParse("--show-toplevel")
+		if err != nil {
+			return nil, err
+		}
+		if len(out) == 1 {
+			worktreeFs = osfs.New(out[0])
+		}
+	}
+	storage := filesystem.NewStorage(dotGitFs, cache.NewObjectLRUDefault())
+	repo, err := git.Open(storage, worktreeFs)
+	return repo, errors.WithStack(err)
+}
+
+// revParse runs git rev-parse with the given arguments and returns its output
+// lines. Failures, including git not being installed, are reported as
+// git.ErrRepositoryNotExists, since that's almost always the cause.
+func revParse(args ...string) ([]string, error) {
+	cmd := exec.Command("git", append([]string{"rev-parse"}, args...)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, errors.WithStack(git.ErrRepositoryNotExists)
+	}
+	output := strings.TrimRight(stdout.String(), "\n")
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
@@ -0,0 +1,134 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReviewActivity summarizes what's happening on a review. Only plz status
+// shows it, so it's left out of the review query that every command runs and
+// loaded separately with LoadActivity.
+type ReviewActivity struct {
+	// Approvals and ChangesRequested count the reviewers whose latest review
+	// approves or requests changes.
+	Approvals         int `graphql:"approvalCount"`
+	ChangesRequested  int `graphql:"changesRequestedCount"`
+	UnresolvedThreads int `graphql:"unresolvedThreadCount"`
+}
+
+type reviewStackName struct {
+	StackName string `graphql:"stackName"`
+}
+
+// LoadActivity sets the Activity of the reviews in the stack.
+func LoadActivity(ctx context.Context, graphqlClient *graphql.Client, s CommitStack) error {
+	reviews := s.reviews()
+	results, err := queryReviewFields(ctx, graphqlClient, reviews, reflect.TypeOf(ReviewActivity{}))
+	if err != nil {
+		return err
+	}
+	for i, review := range reviews {
+		activity := results[i].Interface().(ReviewActivity)
+		review.Activity = &activity
+	}
+	return nil
+}
+
+// LoadStackNames sets the StackName of the reviews in the stack.
+func LoadStackNames(ctx context.Context, graphqlClient *graphql.Client, s CommitStack) error {
+	reviews := s.reviews()
+	results, err := queryReviewFields(ctx, graphqlClient, reviews, reflect.TypeOf(reviewStackName{}))
+	if err != nil {
+		return err
+	}
+	for i, review := range reviews {
+		review.StackName = results[i].Interface().(reviewStackName).StackName
+	}
+	return nil
+}
+
+// ReviewState is the status and head branch of a review, for commands that
+// deal with review branches rather than whole stacks.
+type ReviewState struct {
+	Status     ReviewStatus `graphql:"status"`
+	HeadBranch string       `graphql:"headBranch"`
+}
+
+// LoadReviewStates returns the state of each of the given reviews, in the
+// same order, batched like the reviews of a stack.
+func LoadReviewStates(ctx context.Context, graphqlClient *graphql.Client, reviewIDs []string) ([]ReviewState, error) {
+	reviews := make([]*Review, len(reviewIDs))
+	for i, reviewID := range reviewIDs {
+		reviews[i] = &Review{baseReview: baseReview{ID: reviewID}}
+	}
+	results, err := queryReviewFields(ctx, graphqlClient, reviews, reflect.TypeOf(ReviewState{}))
+	if err != nil {
+		return nil, err
+	}
+	states := make([]ReviewState, len(reviewIDs))
+	for i := range reviewIDs {
+		states[i] = results[i].Interface().(ReviewState)
+	}
+	return states, nil
+}
+
+func (s CommitStack) reviews() []*Review {
+	var reviews []*Review
+	for _, ci := range s {
+		if ci.Review != nil && ci.CachedAt == nil {
+			reviews = append(reviews, ci.Review)
+		}
+	}
+	return reviews
+}
+
+// queryReviewFields queries the fields of the given struct type for each of
+// the reviews, batched like queryReviews. The results are in the same order as
+// the reviews.
+func queryReviewFields(
+	ctx context.Context,
+	graphqlClient *graphql.Client,
+	reviews []*Review,
+	t reflect.Type,
+) ([]reflect.Value, error) {
+	results := make([]reflect.Value, len(reviews))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentQueries)
+	for start := 0; start < len(reviews); start += maxReviewsPerQuery {
+		end := start + maxReviewsPerQuery
+		if end > len(reviews) {
+			end = len(reviews)
+		}
+		start := start
+		batch := reviews[start:end]
+		g.Go(func() error {
+			fields := make([]reflect.StructField, len(batch))
+			variables := map[string]interface{}{}
+			for i, review := range batch {
+				fields[i] = reflect.StructField{
+					Name: fmt.Sprintf("Review%d", i),
+					Type: t,
+					Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"review%[1]d: review(id: $reviewId%[1]d)"`, i)),
+				}
+				variables[fmt.Sprintf("reviewId%d", i)] = graphql.ID(review.ID)
+			}
+			query := reflect.New(reflect.StructOf(fields))
+			if err := graphqlClient.Query(gctx, query.Interface(), variables); err != nil {
+				return errors.WithStack(err)
+			}
+			for i := range batch {
+				results[start+i] = query.Elem().Field(i)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,135 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/pkg/errors"
+)
+
+// cacheDir is the directory, relative to the .git directory, where review
+// metadata is cached keyed by commit SHA.
+const cacheDir = "plz/cache"
+
+type cacheEntry struct {
+	CachedAt time.Time `json:"cachedAt"`
+	Review   *Review   `json:"review"`
+}
+
+// LoadCached returns the review stack starting at the given head commit using
+// only review metadata recorded by previous calls to Save. No
+// network requests are made, so the result may be stale. Commits with a review
+// ID but no cache entry have status CommitStatusUncached.
+func LoadCached(
+	ctx context.Context,
+	repo *git.Repository,
+	headCommit *object.Commit,
+	defaultBranch string,
+) (CommitStack, error) {
+	fs, ok := DotGitFilesystem(repo)
+	if !ok {
+		return nil, errors.New("review cache is not supported for this repository")
+	}
+	walked, err := walk(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	s := make(CommitStack, len(walked))
+	for i, wc := range walked {
+		ci := CommitInfo{Commit: wc.commit}
+		if wc.reviewID != "" {
+			entry, err := readCacheEntry(fs, wc.commit.Hash.String())
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil || entry.Review.ID != wc.reviewID {
+				ci.uncached = true
+			} else {
+				ci.Review = entry.Review
+				ci.CachedAt = &entry.CachedAt
+			}
+		}
+		s[i] = ci
+	}
+	return s, nil
+}
+
+// Save records the review metadata of the stack in the local cache, for
+// LoadCached, and in Git notes. Loading a stack never writes to the repo, so
+// commands that publish or sync reviews call this once they've succeeded.
+func Save(ctx context.Context, repo *git.Repository, s CommitStack) {
+	saveCache(ctx, repo, s)
+	saveNotes(ctx, repo, s)
+}
+
+// SaveCache records the review metadata of the stack in the local cache only,
+// for read-only commands such as plz status that refresh the cache as a side
+// benefit but shouldn't write notes.
+func SaveCache(ctx context.Context, repo *git.Repository, s CommitStack) {
+	saveCache(ctx, repo, s)
+}
+
+// saveCache records the review metadata for each commit in the stack. Failures
+// are logged rather than returned since the cache is only an optimization.
+func saveCache(ctx context.Context, repo *git.Repository, s CommitStack) {
+	deps := deps.FromContext(ctx)
+	fs, ok := DotGitFilesystem(repo)
+	if !ok {
+		return
+	}
+	if err := fs.MkdirAll(cacheDir, 0o755); err != nil {
+		deps.StackDebugLog.Printf("failed to create review cache: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, ci := range s {
+		if ci.Review == nil || ci.CachedAt != nil {
+			continue
+		}
+		b, err := json.Marshal(cacheEntry{CachedAt: now, Review: ci.Review})
+		if err != nil {
+			deps.StackDebugLog.Printf("failed to encode cache entry: %v", err)
+			continue
+		}
+		filename := path.Join(cacheDir, ci.Commit.Hash.String()+".json")
+		if err := util.WriteFile(fs, filename, b, 0o644); err != nil {
+			deps.StackDebugLog.Printf("failed to write cache entry: %v", err)
+		}
+	}
+}
+
+func readCacheEntry(fs billy.Filesystem, sha string) (*cacheEntry, error) {
+	b, err := util.ReadFile(fs, path.Join(cacheDir, sha+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil || entry.Review == nil {
+		// Treat corrupt entries as missing; they'll be rewritten the next time
+		// the stack is published, synced or shown by plz status.
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// DotGitFilesystem returns the filesystem rooted at the repo's .git directory,
+// if the repo is backed by one.
+func DotGitFilesystem(repo *git.Repository) (billy.Filesystem, bool) {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, false
+	}
+	return storage.Filesystem(), true
+}
@@ -0,0 +1,193 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitcomplete/plz-cli/client/deps"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// NotesRef is the ref holding the Git notes that plz writes for published
+// commits, e.g. for use with git log --notes=plz.
+const NotesRef plumbing.ReferenceName = "refs/notes/plz"
+
+// Note is the review metadata recorded for a published commit.
+type Note struct {
+	ReviewID string
+	// Revision is the revision number of the commit, or zero if it isn't
+	// known yet, e.g. right after publishing.
+	Revision int
+	GitHubPR int
+	Status   ReviewStatus
+	// StackName is the name of the review's stack, if it has one.
+	StackName string
+}
+
+func (n Note) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "plz-review-url: https://plz.review/review/%s\n", n.ReviewID)
+	if n.Revision > 0 {
+		fmt.Fprintf(&b, "revision: %d\n", n.Revision)
+	}
+	if n.GitHubPR > 0 {
+		fmt.Fprintf(&b, "pr: %d\n", n.GitHubPR)
+	}
+	fmt.Fprintf(&b, "status: %s\n", n.Status)
+	if n.StackName != "" {
+		fmt.Fprintf(&b, "stack: %s\n", n.StackName)
+	}
+	return b.String()
+}
+
+// WriteNotes records the given notes under NotesRef in a single notes commit,
+// replacing any existing notes for the same commits.
+func WriteNotes(repo *git.Repository, notes map[plumbing.Hash]Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	entries := map[string]plumbing.Hash{}
+	var parents []plumbing.Hash
+	ref, err := repo.Reference(NotesRef, true)
+	if err == nil {
+		parents = append(parents, ref.Hash())
+		notesCommit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		tree, err := notesCommit.Tree()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		// Notes trees may fan out into subdirectories, e.g. ab/cdef..., so
+		// strip the separators to recover the annotated commit SHAs.
+		err = tree.Files().ForEach(func(f *object.File) error {
+			entries[strings.ReplaceAll(f.Name, "/", "")] = f.Hash
+			return nil
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return errors.WithStack(err)
+	}
+
+	changed := false
+	for commitHash, note := range notes {
+		text := note.String()
+		if entries[commitHash.String()] == plumbing.ComputeHash(plumbing.BlobObject, []byte(text)) {
+			continue
+		}
+		changed = true
+		blob := repo.Storer.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := w.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+		blobHash, err := repo.Storer.SetEncodedObject(blob)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		entries[commitHash.String()] = blobHash
+	}
+
+	if !changed {
+		return nil
+	}
+
+	// Write a flat tree, which Git reads regardless of the fanout it would
+	// have used itself.
+	tree := &object.Tree{}
+	for name, hash := range entries {
+		tree.Entries = append(tree.Entries, object.TreeEntry{
+			Name: name,
+			Mode: filemode.Regular,
+			Hash: hash,
+		})
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].Name < tree.Entries[j].Name
+	})
+	treeObj := repo.Storer.NewEncodedObject()
+	if err := tree.Encode(treeObj); err != nil {
+		return errors.WithStack(err)
+	}
+	treeHash, err := repo.Storer.SetEncodedObject(treeObj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	signature := notesSignature(repo)
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      "Notes added by plz\n",
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	commitObj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(commitObj); err != nil {
+		return errors.WithStack(err)
+	}
+	commitHash, err := repo.Storer.SetEncodedObject(commitObj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(repo.Storer.SetReference(plumbing.NewHashReference(NotesRef, commitHash)))
+}
+
+// notesSignature returns the user's Git identity for notes commits, falling
+// back to a generic plz identity. Like Git, the repo's own config takes
+// precedence over the global and system config.
+func notesSignature(repo *git.Repository) object.Signature {
+	signature := object.Signature{Name: "plz", Email: "plz@plz.review", When: time.Now()}
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		// Still use the repo's identity if e.g. the global config can't be
+		// read.
+		cfg, err = repo.Config()
+	}
+	if err == nil && cfg.User.Name != "" && cfg.User.Email != "" {
+		signature.Name = cfg.User.Name
+		signature.Email = cfg.User.Email
+	}
+	return signature
+}
+
+// saveNotes records notes for the commits in the stack that match a published
+// revision. Like saveCache, failures are only logged.
+func saveNotes(ctx context.Context, repo *git.Repository, s CommitStack) {
+	deps := deps.FromContext(ctx)
+	notes := map[plumbing.Hash]Note{}
+	for _, ci := range s {
+		if ci.Review == nil || ci.Review.LocalRevision == nil || ci.CachedAt != nil {
+			continue
+		}
+		notes[ci.Commit.Hash] = Note{
+			ReviewID:  ci.Review.ID,
+			Revision:  ci.Review.LocalRevision.Number,
+			GitHubPR:  ci.Review.GitHubPR,
+			Status:    ci.Review.Status,
+			StackName: ci.Review.StackName,
+		}
+	}
+	if err := WriteNotes(repo, notes); err != nil {
+		deps.GitDebugLog.Printf("failed to write notes: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shurcooL/graphql"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxConcurrentQueries bounds the number of review queries that are issued
+	// to the API at once.
+	maxConcurrentQueries = 8
+
+	// maxReviewsPerQuery bounds the number of reviews that are resolved in a
+	// single batched query.
+	maxReviewsPerQuery = 50
+)
+
+type revisionWithParent struct {
+	Revision
+	Parent *Revision `graphql:"parent"`
+}
+
+// reviewQueryResult is the review metadata fetched for a single commit in the
+// stack.
+type reviewQueryResult struct {
+	baseReview
+	LatestRevisionList struct {
+		Revisions []revisionWithParent `graphql:"revisions"`
+	} `graphql:"latestRevisionList: revisionList(options: {count: 1})"`
+	LocalRevisionList struct {
+		Revisions []revisionWithParent `graphql:"revisions"`
+	} `graphql:"localRevisionList: revisionList(options: {count: 2}, filterOptions: {headCommitSha: $headCommitSha})"`
+}
+
+// reviewLookup identifies a review to resolve along with the SHA of the local
+// commit that references it.
+type reviewLookup struct {
+	reviewID      string
+	headCommitSHA string
+}
+
+// reviewQueryResultFields are the fields of reviewQueryResult with embedded
+// structs flattened, suitable for building batched query types.
+var reviewQueryResultFields = flattenFields(reflect.TypeOf(reviewQueryResult{}))
+
+// queryReviews resolves the given reviews using as few round trips as
+// possible. Each batch is sent as a single GraphQL request with one aliased
+// review field per lookup, and batches are issued concurrently. The results
+// are in the same order as the lookups.
+func queryReviews(
+	ctx context.Context,
+	graphqlClient *graphql.Client,
+	lookups []reviewLookup,
+) ([]*reviewQueryResult, error) {
+	results := make([]*reviewQueryResult, len(lookups))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentQueries)
+	for start := 0; start < len(lookups); start += maxReviewsPerQuery {
+		end := start + maxReviewsPerQuery
+		if end > len(lookups) {
+			end = len(lookups)
+		}
+		start := start
+		g.Go(func() error {
+			batch, err := queryReviewBatch(gctx, graphqlClient, lookups[start:end])
+			if err != nil {
+				return err
+			}
+			copy(results[start:], batch)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func queryReviewBatch(
+	ctx context.Context,
+	graphqlClient *graphql.Client,
+	lookups []reviewLookup,
+) ([]*reviewQueryResult, error) {
+	// The GraphQL client derives queries from struct types, so build a struct
+	// type on the fly with one aliased review field per lookup. Each field
+	// needs its own headCommitSha variable, so the nested struct types are
+	// rebuilt per field too.
+	fields := make([]reflect.StructField, len(lookups))
+	variables := map[string]interface{}{}
+	for i, lookup := range lookups {
+		reviewFields := make([]reflect.StructField, len(reviewQueryResultFields))
+		for j, f := range reviewQueryResultFields {
+			f.Tag = reflect.StructTag(strings.ReplaceAll(
+				string(f.Tag),
+				"$headCommitSha",
+				fmt.Sprintf("$headCommitSha%d", i),
+			))
+			reviewFields[j] = f
+		}
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Review%d", i),
+			Type: reflect.StructOf(reviewFields),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"review%[1]d: review(id: $reviewId%[1]d)"`, i)),
+		}
+		variables[fmt.Sprintf("reviewId%d", i)] = graphql.ID(lookup.reviewID)
+		variables[fmt.Sprintf("headCommitSha%d", i)] = graphql.String(lookup.headCommitSHA)
+	}
+	query := reflect.New(reflect.StructOf(fields))
+	err := graphqlClient.Query(ctx, query.Interface(), variables)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The batched fields have the same shape as reviewQueryResult, so convert
+	// them back by round-tripping through JSON.
+	results := make([]*reviewQueryResult, len(lookups))
+	for i := range lookups {
+		b, err := json.Marshal(query.Elem().Field(i).Interface())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var result reviewQueryResult
+		if err := json.Unmarshal(b, &result); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		results[i] = &result
+	}
+	return results, nil
+}
+
+func flattenFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			fields = append(fields, flattenFields(f.Type)...)
+			continue
+		}
+		fields = append(fields, reflect.StructField{
+			Name: f.Name,
+			Type: f.Type,
+			Tag:  f.Tag,
+		})
+	}
+	return fields
+}
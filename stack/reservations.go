@@ -0,0 +1,117 @@
+package stack
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+)
+
+// reservationsFile is the file, relative to the .git directory, listing the
+// review IDs that have been reserved but not yet published, one per line,
+// each followed by when it was reserved as a Unix time.
+const reservationsFile = "plz/reservations"
+
+// Reservation is a review ID recorded by AddReservations.
+type Reservation struct {
+	ID string
+	// ReservedAt is zero for reservations recorded before the time was.
+	ReservedAt time.Time
+}
+
+// Reservations returns the review IDs recorded by AddReservations that haven't
+// been removed since.
+func Reservations(repo *git.Repository) ([]Reservation, error) {
+	fs, ok := DotGitFilesystem(repo)
+	if !ok {
+		return nil, nil
+	}
+	b, err := util.ReadFile(fs, reservationsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	var reservations []Reservation
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		r := Reservation{ID: fields[0]}
+		if len(fields) > 1 {
+			if sec, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				r.ReservedAt = time.Unix(sec, 0)
+			}
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+// AddReservations records newly reserved review IDs, so that they can be
+// released if plz review fails before publishing them.
+func AddReservations(repo *git.Repository, ids []string) error {
+	existing, err := Reservations(repo)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		existing = append(existing, Reservation{ID: id, ReservedAt: now})
+	}
+	return writeReservations(repo, existing)
+}
+
+// RemoveReservations forgets the given review IDs, once they have been
+// published or released.
+func RemoveReservations(repo *git.Repository, ids []string) error {
+	existing, err := Reservations(repo)
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, id := range ids {
+		removed[id] = true
+	}
+	var remaining []Reservation
+	for _, r := range existing {
+		if !removed[r.ID] {
+			remaining = append(remaining, r)
+		}
+	}
+	return writeReservations(repo, remaining)
+}
+
+func writeReservations(repo *git.Repository, reservations []Reservation) error {
+	fs, ok := DotGitFilesystem(repo)
+	if !ok {
+		return nil
+	}
+	if len(reservations) == 0 {
+		err := fs.Remove(reservationsFile)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].ID < reservations[j].ID
+	})
+	var b strings.Builder
+	for _, r := range reservations {
+		fmt.Fprintf(&b, "%s %d\n", r.ID, r.ReservedAt.Unix())
+	}
+	if err := fs.MkdirAll("plz", 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	err := util.WriteFile(fs, reservationsFile, []byte(b.String()), 0o644)
+	return errors.WithStack(err)
+}
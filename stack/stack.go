@@ -5,6 +5,7 @@ import (
 	"context"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/bitcomplete/plz-cli/client/deps"
 	"github.com/go-git/go-git/v5"
@@ -18,8 +19,30 @@ var (
 	reviewTrailerRegex = regexp.MustCompile(
 		`^\s*((?i)plz-review-url)\s*:\s+https://plz.review/review/(\w+)\s*$`,
 	)
+	// changeIDTrailerRegex matches the Change-Id trailers that plz writes with
+	// plz.reviewTrailer set to change-id or both, which hold Iplz- followed by
+	// the review ID. The plz- marks them apart from the Change-Ids of Gerrit
+	// and other tools, which aren't review IDs.
+	changeIDTrailerRegex = regexp.MustCompile(`^\s*((?i)change-id)\s*:\s+Iplz-(\w+)\s*$`)
+	// commitSHARegex matches full or abbreviated commit SHAs.
+	commitSHARegex = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
 )
 
+// Styles of trailers identifying a commit's review, see plz.reviewTrailer.
+const (
+	// ReviewTrailerURL is a plz-review-url trailer with the review's URL.
+	ReviewTrailerURL = "url"
+	// ReviewTrailerChangeID is a Gerrit style Change-Id trailer.
+	ReviewTrailerChangeID = "change-id"
+	// ReviewTrailerBoth is both of the above.
+	ReviewTrailerBoth = "both"
+)
+
+// DefaultMaxStackDepth is the default limit on the number of commits between
+// HEAD and the merge base with the default branch. It guards against walking
+// very long histories, e.g. of long-lived feature branches.
+const DefaultMaxStackDepth = 200
+
 type Revision struct {
 	ReviewID      string `graphql:"reviewID"`
 	Number        int    `graphql:"number"`
@@ -48,6 +71,11 @@ type Review struct {
 	baseReview
 	LatestRevision Revision
 	LocalRevision  *Revision
+	// StackName is the name given to the review's stack with plz review
+	// --stack-name, if any. It's only set by LoadStackNames.
+	StackName string
+	// Activity is only set by LoadActivity.
+	Activity *ReviewActivity `json:",omitempty"`
 }
 
 type CommitStatus string
@@ -57,14 +85,22 @@ const (
 	CommitStatusCurrent  CommitStatus = "current"
 	CommitStatusModified CommitStatus = "modified"
 	CommitStatusNew      CommitStatus = "new"
+	CommitStatusUncached CommitStatus = "uncached"
 )
 
 type CommitInfo struct {
 	Commit *object.Commit
 	*Review
+	// CachedAt is set when the review was loaded from the local cache rather
+	// than the API, in which case it may be stale.
+	CachedAt *time.Time
+	uncached bool
 }
 
 func (ci *CommitInfo) Status() CommitStatus {
+	if ci.uncached {
+		return CommitStatusUncached
+	}
 	review := ci.Review
 	if review == nil {
 		return CommitStatusNew
@@ -80,6 +116,15 @@ func (ci *CommitInfo) Status() CommitStatus {
 
 type CommitStack []CommitInfo
 
+// walkedCommit is a commit visited while walking from the head commit down to
+// the merge base, along with its first parent and the review ID parsed from its
+// message, if any.
+type walkedCommit struct {
+	commit   *object.Commit
+	parent   *object.Commit
+	reviewID string
+}
+
 // Load returns the review stack starting at the given head commit.
 func Load(
 	ctx context.Context,
@@ -88,106 +133,45 @@ func Load(
 	headCommit *object.Commit,
 	defaultBranch string,
 ) (CommitStack, error) {
-	deps := deps.FromContext(ctx)
-
-	// Find the merge base of the head commit and the default branch.
-	defaultBranchRefName := plumbing.NewRemoteReferenceName(
-		git.DefaultRemoteName,
-		defaultBranch,
-	)
-	defaultBranchRef, err := repo.Reference(defaultBranchRefName, true)
+	walked, err := walk(ctx, repo, headCommit, defaultBranch)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
-	defaultBranchCommit, err := repo.CommitObject(defaultBranchRef.Hash())
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	baseCommits, err := headCommit.MergeBase(defaultBranchCommit)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	if len(baseCommits) != 1 {
-		return nil, errors.New("cannot find a unique merge base")
-	}
-	baseCommit := baseCommits[0]
-	deps.DebugLog.Printf("merge base commit is %v", baseCommit.Hash)
 
-	// Walk up the commit history until we find a commit matching a revision or
-	// we hit the default branch. Everything up to that point will consist of
+	// Everything up to the first commit matching a revision will consist of
 	// new or modified reviews. Everything after that will consist existing
-	// review revisions that we will fetch via linked revisions.
+	// review revisions that we will fetch via linked revisions. Reviews are
+	// resolved a batch at a time so that long histories below the first match
+	// aren't queried at all.
 	s := CommitStack{}
 	visitedReviews := map[string]struct{}{}
 	var localRevisionParent, latestRevisionParent *Revision
-	for commit := headCommit; commit.Hash != baseCommit.Hash; {
-		ci := CommitInfo{Commit: commit}
-		deps.DebugLog.Printf("processing commit %v", commit.Hash)
-		deps.DebugLog.Printf("commit %v has parents %v", commit.Hash, commit.ParentHashes)
-		nextCommit, err := repo.CommitObject(commit.ParentHashes[0])
-		if err != nil {
-			return nil, errors.WithStack(err)
+	matched := false
+	for start := 0; start < len(walked) && !matched; start += maxReviewsPerQuery {
+		end := start + maxReviewsPerQuery
+		if end > len(walked) {
+			end = len(walked)
 		}
-		reviewID := readReviewIDFromCommitMessage(commit.Message)
-		if reviewID == "" {
-			// This is a new review.
-			s = append(s, ci)
-			commit = nextCommit
-			continue
-		}
-		var query struct {
-			Review struct {
-				baseReview
-				LatestRevisionList struct {
-					Revisions []struct {
-						Revision
-						Parent *Revision `graphql:"parent"`
-					} `graphql:"revisions"`
-				} `graphql:"latestRevisionList: revisionList(options: {count: 1})"`
-				LocalRevisionList struct {
-					Revisions []struct {
-						Revision
-						Parent *Revision `graphql:"parent"`
-					} `graphql:"revisions"`
-				} `graphql:"localRevisionList: revisionList(options: {count: 2}, filterOptions: {headCommitSha: $headCommitSha})"`
-			} `graphql:"review(id: $reviewId)"`
-		}
-		deps.DebugLog.Printf("loading review %v", reviewID)
-		err = graphqlClient.Query(ctx, &query, map[string]interface{}{
-			"reviewId":      graphql.ID(reviewID),
-			"headCommitSha": graphql.String(commit.Hash.String()),
-		})
+		reviews, err := resolve(ctx, graphqlClient, walked[start:end])
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, err
 		}
-		review := query.Review
-		latestRevision := review.LatestRevisionList.Revisions[0]
-		latestRevisionParent = latestRevision.Parent
-		var localRevision *Revision
-		// The LocalRevisionList has all of the revisions whose head commit SHA
-		// matches the current commit's SHA. The best match among those is the
-		// latest revision having a base commit SHA the same as the current
-		// commit's parent's SHA.
-		for _, r := range review.LocalRevisionList.Revisions {
-			if r.BaseCommitSHA == nextCommit.Hash.String() {
-				localRevision = &r.Revision
-				localRevisionParent = r.Parent
+		for i, wc := range walked[start:end] {
+			ci, localRevision := newCommitInfo(wc, reviews[i])
+			s = append(s, ci)
+			if ci.Review == nil {
+				continue
+			}
+			latestRevisionParent = reviews[i].LatestRevisionList.Revisions[0].Parent
+			visitedReviews[wc.reviewID] = struct{}{}
+			if localRevision != nil {
+				// The current commit matches a revision that exists in this
+				// review. Subsequent commits will come from linked revisions.
+				localRevisionParent = localRevision.Parent
+				matched = true
 				break
 			}
 		}
-		ci.Review = &Review{
-			baseReview:     review.baseReview,
-			LatestRevision: latestRevision.Revision,
-			LocalRevision:  localRevision,
-		}
-		s = append(s, ci)
-		visitedReviews[reviewID] = struct{}{}
-		if localRevision != nil {
-			// The current commit matches a revision that exists in this review.
-			// Subsequent commits will come from linked revisions.
-			break
-		}
-		commit = nextCommit
 	}
 
 	// Determine the starting point for loading linked revisions, defaulting to
@@ -217,83 +201,460 @@ func Load(
 		startRevision = &query.Review.LatestRevisionList.Revisions[0]
 	}
 
-	if startRevision != nil {
-		// We have a starting point so load the linked revisions.
-		var query struct {
-			LinkedRevisions []struct {
-				Review struct {
-					baseReview
-					LatestRevisionList struct {
-						Revisions []Revision `graphql:"revisions"`
-					} `graphql:"latestRevisionList: revisionList(options: {count: 1})"`
-				} `graphql:"review"`
-				Revision `graphql:"revision"`
-			} `graphql:"linkedRevisions(reviewID: $reviewId, revisionNumber: $revisionNumber, direction: ancestors)"`
+	ancestors, err := loadLinkedAncestors(ctx, repo, graphqlClient, startRevision, reachedBase, visitedReviews)
+	if err != nil {
+		return nil, err
+	}
+	return append(s, ancestors...), nil
+}
+
+// loadLinkedAncestors returns the reviews below startRevision in its stack,
+// following linked revisions, bottom last. Reviews in visitedReviews are
+// skipped. If reachedBase is set, startRevision's stack didn't include the
+// local commits' base, so open reviews are dropped since they're no longer
+// part of the stack.
+func loadLinkedAncestors(
+	ctx context.Context,
+	repo *git.Repository,
+	graphqlClient *graphql.Client,
+	startRevision *Revision,
+	reachedBase bool,
+	visitedReviews map[string]struct{},
+) (CommitStack, error) {
+	deps := deps.FromContext(ctx)
+	if startRevision == nil {
+		return nil, nil
+	}
+	var s CommitStack
+	var query struct {
+		LinkedRevisions []struct {
+			Review struct {
+				baseReview
+				LatestRevisionList struct {
+					Revisions []Revision `graphql:"revisions"`
+				} `graphql:"latestRevisionList: revisionList(options: {count: 1})"`
+			} `graphql:"review"`
+			Revision `graphql:"revision"`
+		} `graphql:"linkedRevisions(reviewID: $reviewId, revisionNumber: $revisionNumber, direction: ancestors)"`
+	}
+	deps.StackDebugLog.Printf(
+		"loading linkedRevisions for review %v revision %v",
+		startRevision.ReviewID,
+		startRevision.Number,
+	)
+	err := graphqlClient.Query(ctx, &query, map[string]interface{}{
+		"reviewId":       graphql.ID(startRevision.ReviewID),
+		"revisionNumber": graphql.Int(startRevision.Number),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	linkedRevisions := query.LinkedRevisions
+	for i := len(linkedRevisions) - 1; i >= 0; i-- {
+		linkedRevision := linkedRevisions[i]
+		if reachedBase && linkedRevision.Review.Status == ReviewStatusOpen {
+			// We reached the base commit without encountering this review
+			// meaning it's no longer part of the stack, so drop it.
+			continue
 		}
-		deps.DebugLog.Printf(
-			"loading linkedRevisions for review %v revision %v",
-			startRevision.ReviewID,
-			startRevision.Number,
-		)
-		err := graphqlClient.Query(ctx, &query, map[string]interface{}{
-			"reviewId":       graphql.ID(startRevision.ReviewID),
-			"revisionNumber": graphql.Int(startRevision.Number),
+		if _, ok := visitedReviews[linkedRevision.Review.ID]; ok {
+			// This review has been visited before which most likely means
+			// that the stack has been reordered.
+			//
+			// TODO: One situation where this is OK is if a review above the
+			// default branch was a child of this review, but then the
+			// commits were reordered. In this case we should just skip this
+			// review since it will be sorted out when plz review is run.
+			// However, there are certainly other, more problematic cases,
+			// so this needs more careful thought.
+			continue
+		}
+		headCommitHash := plumbing.NewHash(linkedRevision.Revision.HeadCommitSHA)
+		commit, err := repo.CommitObject(headCommitHash)
+		if err != nil {
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				// If we haven't yet fetched the commit from the remote then
+				// we fabricate a commit and hope downstream code doesn't
+				// try to access anything other than the hash.
+				commit = &object.Commit{Hash: headCommitHash}
+			} else {
+				return nil, errors.WithStack(err)
+			}
+		}
+		review := &linkedRevision.Review
+		s = append(s, CommitInfo{
+			Commit: commit,
+			Review: &Review{
+				baseReview:     review.baseReview,
+				LatestRevision: review.LatestRevisionList.Revisions[0],
+				LocalRevision:  &linkedRevision.Revision,
+			},
 		})
+	}
+	return s, nil
+}
+
+// LoadLocal returns the review stack made up of the commits between the given
+// head commit and the default branch, followed by the reviews they're stacked
+// on that aren't local, e.g. ones that have landed. Unlike Load, the local
+// commits are all resolved with a single bulk query rather than batch by
+// batch, and the reviews below them with at most one more query for their
+// linked revisions. This makes it suitable for quick, read-only views of the
+// stack.
+func LoadLocal(
+	ctx context.Context,
+	repo *git.Repository,
+	graphqlClient *graphql.Client,
+	headCommit *object.Commit,
+	defaultBranch string,
+) (CommitStack, error) {
+	walked, err := walk(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	reviews, err := resolve(ctx, graphqlClient, walked)
+	if err != nil {
+		return nil, err
+	}
+	s := make(CommitStack, len(walked))
+	visitedReviews := map[string]struct{}{}
+	// The reviews below the stack are the ancestors of the bottom review's
+	// revision. If the bottom commit doesn't match a revision, its latest
+	// revision is used instead, as Load does, except that the latest revision
+	// of its parent isn't looked up, to save a round trip, so an outdated
+	// parent may be shown.
+	var startRevision *Revision
+	reachedBase := false
+	for i, wc := range walked {
+		var localRevision *revisionWithParent
+		s[i], localRevision = newCommitInfo(wc, reviews[i])
+		if s[i].Review == nil {
+			continue
+		}
+		visitedReviews[wc.reviewID] = struct{}{}
+		if localRevision != nil {
+			startRevision, reachedBase = localRevision.Parent, false
+		} else {
+			startRevision, reachedBase = reviews[i].LatestRevisionList.Revisions[0].Parent, true
+		}
+	}
+	ancestors, err := loadLinkedAncestors(ctx, repo, graphqlClient, startRevision, reachedBase, visitedReviews)
+	if err != nil {
+		return nil, err
+	}
+	return append(s, ancestors...), nil
+}
+
+// RemoteCommit is a review commit known only from the remote, e.g. the head of
+// a review branch that hasn't been fetched. The commits may be fabricated with
+// only their hash and message set.
+type RemoteCommit struct {
+	ReviewID string
+	Commit   *object.Commit
+	Parent   *object.Commit
+}
+
+// LoadRemote resolves the reviews for the given remote commits with a single
+// bulk query, without walking the local repo.
+func LoadRemote(
+	ctx context.Context,
+	graphqlClient *graphql.Client,
+	commits []RemoteCommit,
+) (CommitStack, error) {
+	walked := make([]walkedCommit, len(commits))
+	for i, rc := range commits {
+		walked[i] = walkedCommit{
+			commit:   rc.Commit,
+			parent:   rc.Parent,
+			reviewID: rc.ReviewID,
+		}
+	}
+	reviews, err := resolve(ctx, graphqlClient, walked)
+	if err != nil {
+		return nil, err
+	}
+	s := make(CommitStack, len(walked))
+	for i, wc := range walked {
+		s[i], _ = newCommitInfo(wc, reviews[i])
+	}
+	return s, nil
+}
+
+// LocalCommits returns the commits from the head commit down to, but not
+// including, the merge base of the head commit and the default branch, with the
+// head commit first.
+func LocalCommits(
+	ctx context.Context,
+	repo *git.Repository,
+	headCommit *object.Commit,
+	defaultBranch string,
+) ([]*object.Commit, error) {
+	walked, err := walk(ctx, repo, headCommit, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]*object.Commit, len(walked))
+	for i, wc := range walked {
+		commits[i] = wc.commit
+	}
+	return commits, nil
+}
+
+// resolveBase resolves what a stack is based on, which is usually a branch on
+// origin but may be a commit SHA, for stacks built on top of someone else's
+// unmerged commits. Other revisions, such as local branches, aren't used, even
+// if the branch is missing on origin, since the stack would then silently
+// include whatever is only on the local branch.
+func resolveBase(repo *git.Repository, base string) (plumbing.Hash, error) {
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, base), true)
+	if err == nil {
+		return ref.Hash(), nil
+	}
+	if err != plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, errors.WithStack(err)
+	}
+	if commitSHARegex.MatchString(base) {
+		if hash, err := repo.ResolveRevision(plumbing.Revision(base)); err == nil {
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, errors.Errorf(
+		"cannot find %s/%s, run git fetch %[1]s, or use a commit SHA as the base",
+		git.DefaultRemoteName,
+		base,
+	)
+}
+
+// walk returns the commits from the head commit down to, but not including, the
+// merge base of the head commit and the default branch, or the revision that
+// defaultBranch names if there's no such branch on origin, see resolveBase.
+// This only touches the local repo so it's cheap compared to the API lookups.
+func walk(
+	ctx context.Context,
+	repo *git.Repository,
+	headCommit *object.Commit,
+	defaultBranch string,
+) ([]walkedCommit, error) {
+	deps := deps.FromContext(ctx)
+
+	// Find the merge base of the head commit and the default branch.
+	defaultBranchHash, err := resolveBase(repo, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	defaultBranchCommit, err := repo.CommitObject(defaultBranchHash)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	baseCommit, err := mergeBase(headCommit, defaultBranchCommit)
+	if err != nil {
+		return nil, err
+	}
+	deps.StackDebugLog.Printf("merge base commit is %v", baseCommit.Hash)
+
+	maxDepth := deps.MaxStackDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxStackDepth
+	}
+	var walked []walkedCommit
+	for commit := headCommit; commit.Hash != baseCommit.Hash; {
+		if len(walked) == maxDepth {
+			return nil, errors.Errorf(
+				"HEAD is more than %d commits ahead of %s/%s, which is more than expected for a stack; "+
+					"rebase onto a more recent %[3]s, or raise the limit with --max-stack-depth or plz.maxStackDepth",
+				maxDepth,
+				git.DefaultRemoteName,
+				defaultBranch,
+			)
+		}
+		deps.StackDebugLog.Printf("processing commit %v", commit.Hash)
+		deps.StackDebugLog.Printf("commit %v has parents %v", commit.Hash, commit.ParentHashes)
+		if len(commit.ParentHashes) == 0 {
+			return nil, errors.Errorf("HEAD has no merge base with %s", defaultBranch)
+		}
+		if len(commit.ParentHashes) > 1 && deps.RejectMerges {
+			return nil, errors.Errorf(
+				"%.8s is a merge commit, which plz.firstParent set to false rejects; use --first-parent to follow only the first parents of merge commits",
+				commit.Hash.String(),
+			)
+		}
+		nextCommit, err := repo.CommitObject(commit.ParentHashes[0])
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		linkedRevisions := query.LinkedRevisions
-		for i := len(linkedRevisions) - 1; i >= 0; i-- {
-			linkedRevision := linkedRevisions[i]
-			if reachedBase && linkedRevision.Review.Status == ReviewStatusOpen {
-				// We reached the base commit without encountering this review
-				// meaning it's no longer part of the stack, so drop it.
-				continue
-			}
-			if _, ok := visitedReviews[linkedRevision.Review.ID]; ok {
-				// This review has been visited before which most likely means
-				// that the stack has been reordered.
-				//
-				// TODO: One situation where this is OK is if a review above the
-				// default branch was a child of this review, but then the
-				// commits were reordered. In this case we should just skip this
-				// review since it will be sorted out when plz review is run.
-				// However, there are certainly other, more problematic cases,
-				// so this needs more careful thought.
-				continue
-			}
-			headCommitHash := plumbing.NewHash(linkedRevision.Revision.HeadCommitSHA)
-			commit, err := repo.CommitObject(headCommitHash)
+		if len(commit.ParentHashes) > 1 {
+			// The merge base may have come from the other parents, e.g. from
+			// merging in the default branch, in which case the stack ends
+			// where the first parent's history meets the default branch.
+			baseCommit, err = mergeBase(nextCommit, defaultBranchCommit)
 			if err != nil {
-				if errors.Is(err, plumbing.ErrObjectNotFound) {
-					// If we haven't yet fetched the commit from the remote then
-					// we fabricate a commit and hope downstream code doesn't
-					// try to access anything other than the hash.
-					commit = &object.Commit{Hash: headCommitHash}
-				} else {
-					return nil, errors.WithStack(err)
-				}
+				return nil, err
 			}
-			review := &linkedRevision.Review
-			s = append(s, CommitInfo{
-				Commit: commit,
-				Review: &Review{
-					baseReview:     review.baseReview,
-					LatestRevision: review.LatestRevisionList.Revisions[0],
-					LocalRevision:  &linkedRevision.Revision,
-				},
+			deps.StackDebugLog.Printf("merge base commit of first parent is %v", baseCommit.Hash)
+		}
+		walked = append(walked, walkedCommit{
+			commit:   commit,
+			parent:   nextCommit,
+			reviewID: ReviewIDFromCommitMessage(commit.Message),
+		})
+		commit = nextCommit
+	}
+	return walked, nil
+}
+
+func mergeBase(commit *object.Commit, other *object.Commit) (*object.Commit, error) {
+	baseCommits, err := commit.MergeBase(other)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(baseCommits) != 1 {
+		return nil, errors.New("cannot find a unique merge base")
+	}
+	return baseCommits[0], nil
+}
+
+// resolve fetches the review metadata for every walked commit that has a
+// review ID in one go rather than a commit at a time. The result is parallel
+// to walked, with nil entries for commits without a review ID.
+func resolve(
+	ctx context.Context,
+	graphqlClient *graphql.Client,
+	walked []walkedCommit,
+) ([]*reviewQueryResult, error) {
+	deps := deps.FromContext(ctx)
+	var lookups []reviewLookup
+	for _, wc := range walked {
+		if wc.reviewID != "" {
+			deps.StackDebugLog.Printf("loading review %v", wc.reviewID)
+			lookups = append(lookups, reviewLookup{
+				reviewID:      wc.reviewID,
+				headCommitSHA: wc.commit.Hash.String(),
 			})
 		}
 	}
-	return s, nil
+	results, err := queryReviews(ctx, graphqlClient, lookups)
+	if err != nil {
+		return nil, err
+	}
+	reviews := make([]*reviewQueryResult, len(walked))
+	for i, wc := range walked {
+		if wc.reviewID != "" {
+			reviews[i], results = results[0], results[1:]
+		}
+	}
+	return reviews, nil
+}
+
+// newCommitInfo combines a walked commit with its resolved review, if any. It
+// also returns the revision matching the local commit, or nil if the commit
+// doesn't match any revision.
+func newCommitInfo(
+	wc walkedCommit,
+	review *reviewQueryResult,
+) (CommitInfo, *revisionWithParent) {
+	ci := CommitInfo{Commit: wc.commit}
+	if review == nil || len(review.LatestRevisionList.Revisions) == 0 {
+		// This is a new review, or one whose ID was reserved in advance but
+		// that hasn't been published yet.
+		return ci, nil
+	}
+	// The LocalRevisionList has all of the revisions whose head commit SHA
+	// matches the current commit's SHA. The best match among those is the
+	// latest revision having a base commit SHA the same as the current
+	// commit's parent's SHA.
+	var localRevision *revisionWithParent
+	for i, r := range review.LocalRevisionList.Revisions {
+		if r.BaseCommitSHA == wc.parent.Hash.String() {
+			localRevision = &review.LocalRevisionList.Revisions[i]
+			break
+		}
+	}
+	ci.Review = &Review{
+		baseReview:     review.baseReview,
+		LatestRevision: review.LatestRevisionList.Revisions[0].Revision,
+	}
+	if localRevision != nil {
+		ci.Review.LocalRevision = &localRevision.Revision
+	}
+	return ci, localRevision
 }
 
-func readReviewIDFromCommitMessage(message string) string {
+// ReviewIDFromCommitMessage returns the review ID from the plz-review-url or
+// Change-Id trailer in the given commit message, or an empty string if there
+// isn't one.
+func ReviewIDFromCommitMessage(message string) string {
 	s := bufio.NewScanner(strings.NewReader(message))
 	for s.Scan() {
-		matches := reviewTrailerRegex.FindStringSubmatch(s.Text())
-		if len(matches) == 3 {
-			return matches[2]
+		if reviewID := reviewIDFromTrailer(s.Text()); reviewID != "" {
+			return reviewID
+		}
+	}
+	return ""
+}
+
+// ReviewIDsFromCommitMessage returns the distinct review IDs from all trailers
+// identifying a review in the given commit message, in order. A message should
+// have at most one, but may have more, e.g. after squashing commits by hand.
+func ReviewIDsFromCommitMessage(message string) []string {
+	var reviewIDs []string
+	seen := map[string]bool{}
+	s := bufio.NewScanner(strings.NewReader(message))
+	for s.Scan() {
+		if reviewID := reviewIDFromTrailer(s.Text()); reviewID != "" && !seen[reviewID] {
+			seen[reviewID] = true
+			reviewIDs = append(reviewIDs, reviewID)
+		}
+	}
+	return reviewIDs
+}
+
+// reviewIDFromTrailer returns the review ID if line is a trailer identifying
+// a review, and otherwise an empty string.
+func reviewIDFromTrailer(line string) string {
+	if matches := reviewTrailerRegex.FindStringSubmatch(line); len(matches) == 3 {
+		return matches[2]
+	}
+	if matches := changeIDTrailerRegex.FindStringSubmatch(line); len(matches) == 3 {
+		return matches[2]
+	}
+	return ""
+}
+
+// ReviewTrailers returns the trailer lines identifying the given review in
+// the given style, one of the ReviewTrailer constants.
+func ReviewTrailers(reviewID string, style string) string {
+	urlTrailer := "plz-review-url: https://plz.review/review/" + reviewID
+	changeIDTrailer := "Change-Id: Iplz-" + reviewID
+	switch style {
+	case ReviewTrailerChangeID:
+		return changeIDTrailer
+	case ReviewTrailerBoth:
+		return urlTrailer + "\n" + changeIDTrailer
+	}
+	return urlTrailer
+}
+
+// StripReviewID removes any trailers identifying a review from the given
+// commit message.
+func StripReviewID(message string) string {
+	var b strings.Builder
+	s := bufio.NewScanner(strings.NewReader(message))
+	for s.Scan() {
+		if reviewIDFromTrailer(s.Text()) != "" {
+			continue
+		}
+		b.WriteString(s.Text())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Name returns the name of the stack, taken from the topmost review that has
+// one, or an empty string if the stack is unnamed.
+func (s CommitStack) Name() string {
+	for _, ci := range s {
+		if ci.Review != nil && ci.Review.StackName != "" {
+			return ci.Review.StackName
 		}
 	}
 	return ""